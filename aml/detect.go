@@ -0,0 +1,265 @@
+package aml
+
+import (
+	"fmt"
+	"paygo/config"
+	"paygo/currency"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PatternStructuring = "structuring"
+	PatternFanIn       = "fan_in"
+	PatternFanOut      = "fan_out"
+	PatternCircular    = "circular"
+)
+
+// maxCyclesPerWallet stops the search for circular flows through a wallet
+// once this many were found; more wouldn't change the case.
+const maxCyclesPerWallet = 50
+
+// maxPathsPerWallet bounds the paths explored from one wallet, which grow
+// exponentially with CycleMaxLength through busy wallets.
+const maxPathsPerWallet = 10_000
+
+// Transfer is a completed deposit or payment the scan looks at.
+type Transfer struct {
+	ID           uuid.UUID
+	Type         string    // 'deposit' or 'payment'
+	FromWalletID uuid.UUID // uuid.Nil for deposits
+	ToWalletID   uuid.UUID
+	Amount       int64
+	Currency     string
+	CreatedAt    time.Time
+}
+
+// Finding is a pattern found on a wallet, with the transfers that show it.
+type Finding struct {
+	Pattern      string
+	WalletID     uuid.UUID
+	Summary      string
+	Transactions []uuid.UUID
+}
+
+// Detect runs every detector over transfers, oldest first.
+func Detect(cfg config.AMLConfig, transfers []Transfer) []Finding {
+	var findings []Finding
+	findings = append(findings, detectStructuring(cfg, transfers)...)
+	findings = append(findings, detectFan(cfg, transfers)...)
+	findings = append(findings, detectCycles(cfg, transfers)...)
+	return findings
+}
+
+// group collects transfers by wallet, remembering the order wallets were
+// first seen in so findings come out in a stable order.
+type group struct {
+	order     []uuid.UUID
+	transfers map[uuid.UUID][]Transfer
+}
+
+func (g *group) add(walletId uuid.UUID, t Transfer) {
+	if g.transfers == nil {
+		g.transfers = map[uuid.UUID][]Transfer{}
+	}
+	if _, seen := g.transfers[walletId]; !seen {
+		g.order = append(g.order, walletId)
+	}
+	g.transfers[walletId] = append(g.transfers[walletId], t)
+}
+
+// detectStructuring finds wallets receiving several deposits each just under
+// the reporting threshold, as if to keep every one of them from being
+// reported.
+func detectStructuring(cfg config.AMLConfig, transfers []Transfer) []Finding {
+	if len(cfg.StructuringThresholds) == 0 || cfg.StructuringMinCount <= 0 {
+		return nil
+	}
+
+	var deposits group
+	for _, t := range transfers {
+		threshold, ok := cfg.StructuringThresholds[t.Currency]
+		if !ok || t.Type != "deposit" {
+			continue
+		}
+		if t.Amount >= structuringFloor(cfg, threshold) && t.Amount < threshold {
+			deposits.add(t.ToWalletID, t)
+		}
+	}
+
+	var findings []Finding
+	for _, walletId := range deposits.order {
+		matched := deposits.transfers[walletId]
+		if len(matched) < cfg.StructuringMinCount {
+			continue
+		}
+		code := matched[0].Currency
+		threshold := cfg.StructuringThresholds[code]
+		findings = append(findings, Finding{
+			Pattern:  PatternStructuring,
+			WalletID: walletId,
+			Summary: fmt.Sprintf("%d deposits totalling %s %s, each between %s and %s",
+				len(matched), formatAmount(total(matched), code), code,
+				formatAmount(structuringFloor(cfg, threshold), code), formatAmount(threshold, code)),
+			Transactions: ids(matched),
+		})
+	}
+	return findings
+}
+
+// structuringFloor is the smallest deposit counted as just under threshold.
+func structuringFloor(cfg config.AMLConfig, threshold int64) int64 {
+	return threshold - threshold*cfg.StructuringMarginBps/10_000
+}
+
+// detectFan finds wallets paid by many distinct wallets (fan-in, e.g. a
+// collection account) or paying many (fan-out, e.g. distributing funds to
+// mules).
+func detectFan(cfg config.AMLConfig, transfers []Transfer) []Finding {
+	if cfg.FanMinCounterparties <= 0 {
+		return nil
+	}
+
+	var in, out group
+	for _, t := range transfers {
+		if t.Type == "payment" {
+			in.add(t.ToWalletID, t)
+			out.add(t.FromWalletID, t)
+		}
+	}
+
+	var findings []Finding
+	scan := func(g group, pattern, verb string, counterparty func(Transfer) uuid.UUID) {
+		for _, walletId := range g.order {
+			payments := g.transfers[walletId]
+			counterparties := map[uuid.UUID]bool{}
+			for _, t := range payments {
+				counterparties[counterparty(t)] = true
+			}
+			if len(counterparties) < cfg.FanMinCounterparties {
+				continue
+			}
+			code := payments[0].Currency
+			findings = append(findings, Finding{
+				Pattern:  pattern,
+				WalletID: walletId,
+				Summary: fmt.Sprintf("%s %d distinct wallets in %d payments totalling %s %s",
+					verb, len(counterparties), len(payments), formatAmount(total(payments), code), code),
+				Transactions: ids(payments),
+			})
+		}
+	}
+	scan(in, PatternFanIn, "paid by", func(t Transfer) uuid.UUID { return t.FromWalletID })
+	scan(out, PatternFanOut, "paid", func(t Transfer) uuid.UUID { return t.ToWalletID })
+	return findings
+}
+
+// detectCycles finds money that left a wallet and came back to it through
+// other wallets, each payment made after the one before. A cycle is reported
+// on the wallet its earliest payment left from. The search from each wallet
+// stops after maxCyclesPerWallet cycles or maxPathsPerWallet paths.
+func detectCycles(cfg config.AMLConfig, transfers []Transfer) []Finding {
+	if cfg.CycleMaxLength < 2 {
+		return nil
+	}
+
+	var outgoing group
+	for _, t := range transfers {
+		if t.Type == "payment" && t.Amount >= cfg.CycleMinAmount && t.FromWalletID != t.ToWalletID {
+			outgoing.add(t.FromWalletID, t)
+		}
+	}
+
+	var findings []Finding
+	for _, start := range outgoing.order {
+		var (
+			cycles int
+			paths  int
+			linked []uuid.UUID
+			seen   = map[uuid.UUID]bool{}
+		)
+		exhausted := func() bool {
+			return cycles >= maxCyclesPerWallet || paths >= maxPathsPerWallet
+		}
+
+		var walk func(path []Transfer)
+		walk = func(path []Transfer) {
+			paths++
+			last := path[len(path)-1]
+			if last.ToWalletID == start {
+				cycles++
+				for _, t := range path {
+					if !seen[t.ID] {
+						seen[t.ID] = true
+						linked = append(linked, t.ID)
+					}
+				}
+				return
+			}
+			if len(path) == cfg.CycleMaxLength {
+				return
+			}
+
+		next:
+			for _, t := range outgoing.transfers[last.ToWalletID] {
+				if exhausted() {
+					return
+				}
+				if t.CreatedAt.Before(last.CreatedAt) {
+					continue
+				}
+				// Only the start may be visited twice, to close the cycle.
+				for _, hop := range path[1:] {
+					if hop.FromWalletID == t.ToWalletID {
+						continue next
+					}
+				}
+				walk(append(path[:len(path):len(path)], t))
+			}
+		}
+
+		for _, first := range outgoing.transfers[start] {
+			if exhausted() {
+				break
+			}
+			walk([]Transfer{first})
+		}
+
+		if cycles > 0 {
+			findings = append(findings, Finding{
+				Pattern:  PatternCircular,
+				WalletID: start,
+				Summary: fmt.Sprintf("payment cycles returning funds to the wallet: %d, of at most %d payments each",
+					cycles, cfg.CycleMaxLength),
+				Transactions: linked,
+			})
+		}
+	}
+	return findings
+}
+
+func total(transfers []Transfer) (sum int64) {
+	for _, t := range transfers {
+		sum += t.Amount
+	}
+	return sum
+}
+
+func ids(transfers []Transfer) []uuid.UUID {
+	ids := make([]uuid.UUID, len(transfers))
+	for i, t := range transfers {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// formatAmount renders minor units as a decimal amount of code, or as is for
+// a currency that is no longer supported.
+func formatAmount(amount int64, code string) string {
+	c, err := currency.Lookup(code)
+	if err != nil {
+		return fmt.Sprint(amount)
+	}
+	return c.Format(amount)
+}
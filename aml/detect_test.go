@@ -0,0 +1,200 @@
+package aml
+
+import (
+	"fmt"
+	"paygo/config"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var t0 = time.Date(2025, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+// id returns a readable UUID for wallet or transaction n.
+func id(n int) uuid.UUID {
+	return uuid.UUID{14: byte(n >> 8), 15: byte(n)}
+}
+
+func deposit(n, to int, amount int64, code string) Transfer {
+	return Transfer{ID: id(n), Type: "deposit", ToWalletID: id(to), Amount: amount, Currency: code,
+		CreatedAt: t0.Add(time.Duration(n) * time.Minute)}
+}
+
+// payment n is made n minutes after t0.
+func payment(n, from, to int, amount int64) Transfer {
+	return Transfer{ID: id(n), Type: "payment", FromWalletID: id(from), ToWalletID: id(to), Amount: amount,
+		Currency: "USD", CreatedAt: t0.Add(time.Duration(n) * time.Minute)}
+}
+
+// found is a finding without its summary: the wallet and transactions.
+type found struct {
+	wallet int
+	txs    []int
+}
+
+func checkFindings(t *testing.T, pattern string, got []Finding, want []found) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d findings %+v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		var txs []uuid.UUID
+		for _, n := range w.txs {
+			txs = append(txs, id(n))
+		}
+		if got[i].Pattern != pattern || got[i].WalletID != id(w.wallet) || !slices.Equal(got[i].Transactions, txs) {
+			t.Errorf("finding %d = %s on %s with %v, want %s on %s with %v", i,
+				got[i].Pattern, got[i].WalletID, got[i].Transactions, pattern, id(w.wallet), txs)
+		}
+	}
+}
+
+func TestDetectStructuring(t *testing.T) {
+	cfg := config.AMLConfig{
+		StructuringThresholds: map[string]int64{"USD": 1_000_000, "EUR": 500_000, "JPY": 1_000_000},
+		StructuringMarginBps:  1_000, // floors at 900_000 USD and JPY, 450_000 EUR
+		StructuringMinCount:   3,
+	}
+
+	tests := []struct {
+		name      string
+		transfers []Transfer
+		want      []found
+	}{
+		{"deposits just under the threshold", []Transfer{
+			deposit(1, 1, 990_000, "USD"), deposit(2, 1, 950_000, "USD"), deposit(3, 1, 999_999, "USD"),
+		}, []found{{1, []int{1, 2, 3}}}},
+		{"too few deposits", []Transfer{
+			deposit(1, 1, 990_000, "USD"), deposit(2, 1, 990_000, "USD"),
+		}, nil},
+		{"at the threshold", []Transfer{
+			deposit(1, 1, 990_000, "USD"), deposit(2, 1, 990_000, "USD"), deposit(3, 1, 1_000_000, "USD"),
+		}, nil},
+		{"the floor counts", []Transfer{
+			deposit(1, 1, 900_000, "USD"), deposit(2, 1, 900_000, "USD"), deposit(3, 1, 900_000, "USD"),
+		}, []found{{1, []int{1, 2, 3}}}},
+		{"below the floor", []Transfer{
+			deposit(1, 1, 900_000, "USD"), deposit(2, 1, 900_000, "USD"), deposit(3, 1, 899_999, "USD"),
+		}, nil},
+		{"each currency has its own threshold", []Transfer{
+			deposit(1, 1, 460_000, "EUR"), deposit(2, 1, 460_000, "EUR"), deposit(3, 1, 460_000, "EUR"),
+			deposit(4, 2, 460_000, "USD"), deposit(5, 2, 460_000, "USD"), deposit(6, 2, 460_000, "USD"),
+		}, []found{{1, []int{1, 2, 3}}}},
+		{"thresholds are in minor units of their currency", []Transfer{
+			deposit(1, 1, 950_000, "JPY"), deposit(2, 1, 950_000, "JPY"), deposit(3, 1, 950_000, "JPY"),
+		}, []found{{1, []int{1, 2, 3}}}},
+		{"currency without a threshold", []Transfer{
+			deposit(1, 1, 950_000, "GBP"), deposit(2, 1, 950_000, "GBP"), deposit(3, 1, 950_000, "GBP"),
+		}, nil},
+		{"payments are not deposits", []Transfer{
+			payment(1, 2, 1, 950_000), payment(2, 3, 1, 950_000), payment(3, 4, 1, 950_000),
+		}, nil},
+		{"counted per wallet", []Transfer{
+			deposit(1, 1, 950_000, "USD"), deposit(2, 2, 950_000, "USD"), deposit(3, 1, 950_000, "USD"),
+			deposit(4, 2, 950_000, "USD"), deposit(5, 2, 950_000, "USD"),
+		}, []found{{2, []int{2, 4, 5}}}},
+		{"wallets in the order first seen", []Transfer{
+			deposit(1, 2, 950_000, "USD"), deposit(2, 1, 950_000, "USD"), deposit(3, 1, 950_000, "USD"),
+			deposit(4, 2, 950_000, "USD"), deposit(5, 1, 950_000, "USD"), deposit(6, 2, 950_000, "USD"),
+		}, []found{{2, []int{1, 4, 6}}, {1, []int{2, 3, 5}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFindings(t, PatternStructuring, detectStructuring(cfg, tt.transfers), tt.want)
+		})
+	}
+}
+
+func TestDetectCycles(t *testing.T) {
+	cfg := config.AMLConfig{CycleMaxLength: 3, CycleMinAmount: 1_000}
+
+	tests := []struct {
+		name      string
+		transfers []Transfer
+		want      []found
+	}{
+		{"back and forth", []Transfer{
+			payment(1, 1, 2, 5_000), payment(2, 2, 1, 5_000),
+		}, []found{{1, []int{1, 2}}}},
+		{"through two other wallets", []Transfer{
+			payment(1, 1, 2, 5_000), payment(2, 2, 3, 5_000), payment(3, 3, 1, 5_000),
+		}, []found{{1, []int{1, 2, 3}}}},
+		{"longer than the maximum", []Transfer{
+			payment(1, 1, 2, 5_000), payment(2, 2, 3, 5_000), payment(3, 3, 4, 5_000), payment(4, 4, 1, 5_000),
+		}, nil},
+		{"reported where the earliest payment left", []Transfer{
+			payment(2, 1, 2, 5_000), payment(1, 2, 1, 5_000),
+		}, []found{{2, []int{1, 2}}}},
+		{"payments out of order don't chain", []Transfer{
+			payment(3, 1, 2, 5_000), payment(1, 2, 3, 5_000), payment(2, 3, 1, 5_000),
+		}, []found{{2, []int{1, 2, 3}}}},
+		{"below the minimum amount", []Transfer{
+			payment(1, 1, 2, 999), payment(2, 2, 1, 5_000),
+		}, nil},
+		{"deposits are not payments", []Transfer{
+			deposit(1, 1, 5_000, "USD"), payment(2, 1, 2, 5_000),
+		}, nil},
+		{"paying yourself", []Transfer{
+			payment(1, 1, 1, 5_000),
+		}, nil},
+		{"an inner loop is its own cycle", []Transfer{
+			payment(1, 1, 2, 5_000), payment(2, 2, 3, 5_000), payment(3, 3, 2, 5_000), payment(4, 2, 1, 5_000),
+		}, []found{{1, []int{1, 4}}, {2, []int{2, 3}}}},
+		{"transactions listed once across cycles", []Transfer{
+			payment(1, 1, 2, 5_000), payment(2, 2, 1, 5_000), payment(3, 2, 1, 5_000),
+		}, []found{{1, []int{1, 2, 3}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFindings(t, PatternCircular, detectCycles(cfg, tt.transfers), tt.want)
+		})
+	}
+}
+
+func TestDetectCyclesBounded(t *testing.T) {
+	cfg := config.AMLConfig{CycleMaxLength: 6, CycleMinAmount: 1}
+
+	t.Run("cycles per wallet", func(t *testing.T) {
+		// Every wallet pays every other at the same time: cycles everywhere.
+		var transfers []Transfer
+		for from := 1; from <= 30; from++ {
+			for to := 1; to <= 30; to++ {
+				if from != to {
+					transfers = append(transfers, Transfer{ID: id(len(transfers) + 1), Type: "payment",
+						FromWalletID: id(from), ToWalletID: id(to), Amount: 1, Currency: "USD", CreatedAt: t0})
+				}
+			}
+		}
+
+		findings := detectCycles(cfg, transfers)
+		if len(findings) != 30 {
+			t.Fatalf("got %d findings, want one per wallet", len(findings))
+		}
+		prefix := fmt.Sprintf("payment cycles returning funds to the wallet: %d,", maxCyclesPerWallet)
+		for _, f := range findings {
+			if !strings.HasPrefix(f.Summary, prefix) {
+				t.Errorf("finding on %s: %q, want at most %d cycles", f.WalletID, f.Summary, maxCyclesPerWallet)
+			}
+		}
+	})
+
+	t.Run("paths per wallet", func(t *testing.T) {
+		// Every wallet pays every later one, so nothing comes back and the
+		// paths from the first wallets run into the millions.
+		var transfers []Transfer
+		for from := 1; from <= 40; from++ {
+			for to := from + 1; to <= 40; to++ {
+				transfers = append(transfers, payment(len(transfers)+1, from, to, 1))
+			}
+		}
+
+		if findings := detectCycles(cfg, transfers); len(findings) != 0 {
+			t.Errorf("got %d findings, want none", len(findings))
+		}
+	})
+}
@@ -0,0 +1,13 @@
+package aml
+
+import "errors"
+
+var (
+	ErrCaseNotFound      = errors.New("No AML case found with the ID passed")
+	ErrCaseClosed        = errors.New("AML case is already closed")
+	ErrCaseEscalated     = errors.New("AML case has already been escalated")
+	ErrInvalidCaseStatus = errors.New("status must be open, escalated or closed")
+	ErrInvalidResolution = errors.New("resolution must be reported or no_action")
+	ErrNoteRequired      = errors.New("A note is required")
+	ErrScanRunning       = errors.New("An AML scan is already running")
+)
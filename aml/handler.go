@@ -0,0 +1,211 @@
+package aml
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"paygo/models"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AMLServiceInterface interface {
+	Scan(ctx context.Context) (models.AMLScanReport, error)
+	ListCases(ctx context.Context, status string, limit int) ([]models.AMLCase, error)
+	GetCase(ctx context.Context, caseId int64) (models.AMLCaseDetail, error)
+	AddNote(ctx context.Context, caseId int64, authorId uuid.UUID, note string) (models.AMLCase, error)
+	EscalateCase(ctx context.Context, caseId int64, actorId uuid.UUID, note string) (models.AMLCase, error)
+	CloseCase(ctx context.Context, caseId int64, actorId uuid.UUID, resolution, note string) (models.AMLCase, error)
+}
+
+type AMLHandler struct {
+	service AMLServiceInterface
+}
+
+func NewAMLHandler(s AMLServiceInterface) *AMLHandler {
+	return &AMLHandler{service: s}
+}
+
+// RunScan scans for suspicious activity now instead of waiting for the
+// scheduler.
+func (h *AMLHandler) RunScan(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.Scan(r.Context())
+	if errors.Is(err, ErrScanRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("handler: error running AML scan: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListCases lists the cases in ?status=, open and escalated ones by default.
+func (h *AMLHandler) ListCases(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	cases, err := h.service.ListCases(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCaseStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("handler: error listing AML cases: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cases)
+}
+
+// GetCase returns a case with its transactions and history.
+func (h *AMLHandler) GetCase(w http.ResponseWriter, r *http.Request) {
+	detail, ok := h.getCase(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// ExportCase downloads a case's transactions as CSV, one row per
+// transaction, for filing with a suspicious activity report.
+func (h *AMLHandler) ExportCase(w http.ResponseWriter, r *http.Request) {
+	detail, ok := h.getCase(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="aml-case-%d.csv"`, detail.ID))
+
+	resolution := ""
+	if detail.Resolution != nil {
+		resolution = *detail.Resolution
+	}
+	wallet := func(id *uuid.UUID) string {
+		if id == nil {
+			return ""
+		}
+		return id.String()
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"case_id", "pattern", "case_status", "resolution", "subject_user_id", "subject_wallet_id",
+		"transaction_id", "created_at", "type", "status", "from_wallet_id", "to_wallet_id", "amount", "currency",
+	})
+	for _, t := range detail.Transactions {
+		out.Write([]string{
+			strconv.FormatInt(detail.ID, 10), detail.Pattern, detail.Status, resolution,
+			detail.UserID.String(), detail.WalletID.String(),
+			t.ID.String(), t.CreatedAt.UTC().Format(time.RFC3339), t.Type, t.Status,
+			wallet(t.FromWalletID), wallet(t.ToWalletID), formatAmount(t.Amount, t.Currency), t.Currency,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("handler: error writing AML case export: %v", err)
+	}
+}
+
+func (h *AMLHandler) getCase(w http.ResponseWriter, r *http.Request) (models.AMLCaseDetail, bool) {
+	caseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid AML case ID", http.StatusBadRequest)
+		return models.AMLCaseDetail{}, false
+	}
+
+	detail, err := h.service.GetCase(r.Context(), caseId)
+	if err != nil {
+		if errors.Is(err, ErrCaseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return models.AMLCaseDetail{}, false
+		}
+		log.Printf("handler: error reading AML case: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return models.AMLCaseDetail{}, false
+	}
+	return detail, true
+}
+
+// AddNote annotates a case.
+func (h *AMLHandler) AddNote(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, func(ctx context.Context, caseId int64, actorId uuid.UUID, body models.AMLCaseAction) (models.AMLCase, error) {
+		return h.service.AddNote(ctx, caseId, actorId, body.Note)
+	})
+}
+
+// EscalateCase escalates an open case.
+func (h *AMLHandler) EscalateCase(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, func(ctx context.Context, caseId int64, actorId uuid.UUID, body models.AMLCaseAction) (models.AMLCase, error) {
+		return h.service.EscalateCase(ctx, caseId, actorId, body.Note)
+	})
+}
+
+// CloseCase closes a case with its resolution.
+func (h *AMLHandler) CloseCase(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, func(ctx context.Context, caseId int64, actorId uuid.UUID, body models.AMLCaseAction) (models.AMLCase, error) {
+		return h.service.CloseCase(ctx, caseId, actorId, body.Resolution, body.Note)
+	})
+}
+
+func (h *AMLHandler) act(w http.ResponseWriter, r *http.Request,
+	act func(ctx context.Context, caseId int64, actorId uuid.UUID, body models.AMLCaseAction) (models.AMLCase, error)) {
+
+	actorId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	caseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid AML case ID", http.StatusBadRequest)
+		return
+	}
+
+	var body models.AMLCaseAction
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed parsing request", http.StatusBadRequest)
+		return
+	}
+
+	c, err := act(r.Context(), caseId, actorId, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoteRequired), errors.Is(err, ErrInvalidResolution):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrCaseNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrCaseClosed), errors.Is(err, ErrCaseEscalated):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("handler: error updating AML case: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
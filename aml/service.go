@@ -0,0 +1,159 @@
+package aml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"paygo/config"
+	"paygo/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AMLStoreInterface interface {
+	LockScan(ctx context.Context) (unlock func(), ok bool, err error)
+	GetTransfers(ctx context.Context, window time.Duration) ([]Transfer, error)
+	SaveFinding(ctx context.Context, finding Finding) (opened, updated bool, err error)
+	ListCases(ctx context.Context, statuses []string, limit int) ([]models.AMLCase, error)
+	GetCase(ctx context.Context, caseId int64) (models.AMLCaseDetail, error)
+	AddNote(ctx context.Context, caseId int64, authorId uuid.UUID, note string) (models.AMLCase, error)
+	EscalateCase(ctx context.Context, caseId int64, actorId uuid.UUID, note string) (models.AMLCase, error)
+	CloseCase(ctx context.Context, caseId int64, actorId uuid.UUID, resolution, note string) (models.AMLCase, error)
+}
+
+type AMLService struct {
+	store AMLStoreInterface
+	cfg   config.AMLConfig
+}
+
+func NewAMLService(store AMLStoreInterface, cfg config.AMLConfig) *AMLService {
+	return &AMLService{store: store, cfg: cfg}
+}
+
+// Scan looks for suspicious patterns in the transactions of the configured
+// window and files what it finds as cases. Only one scan runs at a time
+// across instances; ErrScanRunning is returned while another one does.
+func (s *AMLService) Scan(ctx context.Context) (models.AMLScanReport, error) {
+	report := models.AMLScanReport{StartedAt: time.Now()}
+
+	unlock, ok, err := s.store.LockScan(ctx)
+	if err != nil {
+		return models.AMLScanReport{}, fmt.Errorf("service: locking scan: %w", err)
+	}
+	if !ok {
+		return models.AMLScanReport{}, ErrScanRunning
+	}
+	defer unlock()
+
+	transfers, err := s.store.GetTransfers(ctx, s.cfg.Window)
+	if err != nil {
+		return models.AMLScanReport{}, fmt.Errorf("service: loading transfers: %w", err)
+	}
+	report.Transactions = len(transfers)
+
+	findings := Detect(s.cfg, transfers)
+	report.Findings = len(findings)
+	for _, finding := range findings {
+		opened, updated, err := s.store.SaveFinding(ctx, finding)
+		if err != nil {
+			return models.AMLScanReport{}, fmt.Errorf("service: filing %s finding on wallet %s: %w", finding.Pattern, finding.WalletID, err)
+		}
+		if opened {
+			report.CasesOpened++
+		}
+		if updated {
+			report.CasesUpdated++
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// StartScheduler runs the scan every interval until ctx is cancelled. The
+// returned channel is closed once it has stopped, after finishing any scan in
+// flight. A zero interval disables it.
+func (s *AMLService) StartScheduler(ctx context.Context, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	if interval <= 0 {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := s.Scan(ctx)
+				if errors.Is(err, ErrScanRunning) {
+					log.Printf("aml: skipping scan, another instance is running one")
+					continue
+				}
+				if err != nil {
+					log.Printf("aml: scan failed: %v", err)
+					continue
+				}
+				log.Printf("aml: scanned %d transactions, %d findings, %d cases opened, %d updated",
+					report.Transactions, report.Findings, report.CasesOpened, report.CasesUpdated)
+			}
+		}
+	}()
+	return stopped
+}
+
+// ListCases returns the cases in status, or the ones still being worked,
+// open and escalated, by default.
+func (s *AMLService) ListCases(ctx context.Context, status string, limit int) ([]models.AMLCase, error) {
+	statuses := []string{"open", "escalated"}
+	if status != "" {
+		if !slices.Contains([]string{"open", "escalated", "closed"}, status) {
+			return nil, ErrInvalidCaseStatus
+		}
+		statuses = []string{status}
+	}
+	return s.store.ListCases(ctx, statuses, limit)
+}
+
+func (s *AMLService) GetCase(ctx context.Context, caseId int64) (models.AMLCaseDetail, error) {
+	return s.store.GetCase(ctx, caseId)
+}
+
+func (s *AMLService) AddNote(ctx context.Context, caseId int64, authorId uuid.UUID, note string) (models.AMLCase, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return models.AMLCase{}, ErrNoteRequired
+	}
+	return s.store.AddNote(ctx, caseId, authorId, note)
+}
+
+// EscalateCase escalates an open case; the note says why.
+func (s *AMLService) EscalateCase(ctx context.Context, caseId int64, actorId uuid.UUID, note string) (models.AMLCase, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return models.AMLCase{}, ErrNoteRequired
+	}
+	return s.store.EscalateCase(ctx, caseId, actorId, note)
+}
+
+// CloseCase closes a case as reported to the authorities or as needing no
+// action, with a note on the reasoning.
+func (s *AMLService) CloseCase(ctx context.Context, caseId int64, actorId uuid.UUID, resolution, note string) (models.AMLCase, error) {
+	if resolution != "reported" && resolution != "no_action" {
+		return models.AMLCase{}, ErrInvalidResolution
+	}
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return models.AMLCase{}, ErrNoteRequired
+	}
+	return s.store.CloseCase(ctx, caseId, actorId, resolution, note)
+}
@@ -0,0 +1,405 @@
+package aml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"paygo/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AMLStore struct {
+	db *pgxpool.Pool
+}
+
+func NewAMLStore(db *pgxpool.Pool) *AMLStore {
+	return &AMLStore{db: db}
+}
+
+// scanLock is the advisory lock held for the duration of a scan.
+const scanLock = `hashtextextended('aml:scan', 0)`
+
+// LockScan takes the lock that keeps instances from scanning at the same
+// time, on a connection of its own for as long as the scan runs. ok is false
+// when another scan holds it; otherwise unlock must be called once done.
+func (s *AMLStore) LockScan(ctx context.Context) (unlock func(), ok bool, err error) {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(`+scanLock+`)`).Scan(&ok)
+	if err != nil || !ok {
+		conn.Release()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to lock scan: %w", err)
+		}
+		return nil, false, nil
+	}
+
+	return func() {
+		ctx := context.WithoutCancel(ctx)
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock(`+scanLock+`)`); err != nil {
+			// Closing the session is the only other way to let go of the lock.
+			log.Printf("store: failed to unlock AML scan, closing its connection: %v", err)
+			conn.Hijack().Close(ctx)
+			return
+		}
+		conn.Release()
+	}, true, nil
+}
+
+// GetTransfers returns the deposits and payments that moved money within
+// window, oldest first. Refunded payments count: the money did move before
+// it was returned.
+func (s *AMLStore) GetTransfers(ctx context.Context, window time.Duration) ([]Transfer, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, type, from_wallet_id, to_wallet_id, amount, currency, created_at
+		FROM transactions
+		WHERE type IN ('deposit', 'payment')
+			AND status IN ('completed', 'refunded')
+			AND created_at >= CURRENT_TIMESTAMP - $1::interval
+		ORDER BY created_at, id
+	`, window)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to load transfers: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []Transfer
+	for rows.Next() {
+		var (
+			t    Transfer
+			from *uuid.UUID
+		)
+		if err := rows.Scan(&t.ID, &t.Type, &from, &t.ToWalletID, &t.Amount, &t.Currency, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("store: failed to scan transfer: %w", err)
+		}
+		if from != nil {
+			t.FromWalletID = *from
+		}
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// SaveFinding files a finding. It is added to the wallet's case for the
+// pattern if one is still being worked, and opens a new case otherwise.
+// Findings whose transactions all belong to a case for the pattern already,
+// as when the next scan sees the same activity, are dropped.
+func (s *AMLStore) SaveFinding(ctx context.Context, finding Finding) (opened, updated bool, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, false, fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var unseen int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM unnest($1::uuid[]) AS f(transaction_id)
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM aml_case_transactions ct
+			JOIN aml_cases c ON c.id = ct.case_id
+			WHERE ct.transaction_id = f.transaction_id AND c.pattern = $2
+		)
+	`, finding.Transactions, finding.Pattern).Scan(&unseen)
+	if err != nil {
+		return false, false, fmt.Errorf("store: failed to check known transactions: %w", err)
+	}
+	if unseen == 0 {
+		return false, false, nil
+	}
+
+	caseId, opened, err := activeCase(ctx, tx, finding)
+	if err != nil {
+		return false, false, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO aml_case_transactions (case_id, transaction_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT DO NOTHING
+	`, caseId, finding.Transactions)
+	if err != nil {
+		return false, false, fmt.Errorf("store: failed to link case transactions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE aml_cases c
+		SET summary = $2,
+			updated_at = CURRENT_TIMESTAMP,
+			(total_amount, transaction_count) = (
+				SELECT COALESCE(SUM(t.amount), 0), COUNT(*)
+				FROM aml_case_transactions ct
+				JOIN transactions t ON t.id = ct.transaction_id
+				WHERE ct.case_id = c.id
+			)
+		WHERE c.id = $1
+	`, caseId, finding.Summary)
+	if err != nil {
+		return false, false, fmt.Errorf("store: failed to update case totals: %w", err)
+	}
+
+	action := "updated"
+	if opened {
+		action = "opened"
+	}
+	if err = addEvent(ctx, tx, caseId, nil, action, finding.Summary); err != nil {
+		return false, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, false, fmt.Errorf("store: failed to commit finding: %w", err)
+	}
+	return opened, !opened, nil
+}
+
+// activeCase locks the open or escalated case for the finding's pattern and
+// wallet, opening one if there is none.
+func activeCase(ctx context.Context, tx pgx.Tx, finding Finding) (caseId int64, opened bool, err error) {
+	for range 2 {
+		err = tx.QueryRow(ctx, `
+			SELECT id FROM aml_cases
+			WHERE pattern = $1 AND wallet_id = $2 AND status IN ('open', 'escalated')
+			FOR UPDATE
+		`, finding.Pattern, finding.WalletID).Scan(&caseId)
+		if err == nil {
+			return caseId, false, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, fmt.Errorf("store: failed to find active case: %w", err)
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO aml_cases (pattern, wallet_id, user_id, currency, summary)
+			SELECT $1, w.id, w.user_id, w.currency, $3
+			FROM wallets w
+			WHERE w.id = $2
+			ON CONFLICT (pattern, wallet_id) WHERE status IN ('open', 'escalated') DO NOTHING
+			RETURNING id
+		`, finding.Pattern, finding.WalletID, finding.Summary).Scan(&caseId)
+		if err == nil {
+			return caseId, true, nil
+		}
+		// No row: a concurrent scan opened the case first, so look again.
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, fmt.Errorf("store: failed to open case: %w", err)
+		}
+	}
+	return 0, false, fmt.Errorf("store: no case could be opened for wallet %s", finding.WalletID)
+}
+
+func addEvent(ctx context.Context, tx pgx.Tx, caseId int64, actorId *uuid.UUID, action, note string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO aml_case_events (case_id, actor_id, action, note)
+		VALUES ($1, $2, $3, $4)
+	`, caseId, actorId, action, note)
+	if err != nil {
+		return fmt.Errorf("store: failed to record case event: %w", err)
+	}
+	return nil
+}
+
+const caseColumns = `id, pattern, wallet_id, user_id, summary, total_amount, currency, transaction_count,
+	status, resolution, escalated_by, escalated_at, closed_by, closed_at, created_at, updated_at`
+
+func scanCase(row pgx.Row) (c models.AMLCase, err error) {
+	err = row.Scan(
+		&c.ID,
+		&c.Pattern,
+		&c.WalletID,
+		&c.UserID,
+		&c.Summary,
+		&c.TotalAmount,
+		&c.Currency,
+		&c.TransactionCount,
+		&c.Status,
+		&c.Resolution,
+		&c.EscalatedBy,
+		&c.EscalatedAt,
+		&c.ClosedBy,
+		&c.ClosedAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	return c, err
+}
+
+// ListCases returns the cases in any of statuses, oldest first.
+func (s *AMLStore) ListCases(ctx context.Context, statuses []string, limit int) ([]models.AMLCase, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+caseColumns+`
+		FROM aml_cases
+		WHERE status = ANY($1)
+		ORDER BY created_at, id
+		LIMIT $2
+	`, statuses, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to list AML cases: %w", err)
+	}
+	defer rows.Close()
+
+	cases := []models.AMLCase{}
+	for rows.Next() {
+		c, err := scanCase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("store: failed to scan AML case: %w", err)
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating AML cases: %w", err)
+	}
+	return cases, nil
+}
+
+// GetCase returns a case with its transactions, oldest first, and its
+// history.
+func (s *AMLStore) GetCase(ctx context.Context, caseId int64) (models.AMLCaseDetail, error) {
+	c, err := scanCase(s.db.QueryRow(ctx, `SELECT `+caseColumns+` FROM aml_cases WHERE id = $1`, caseId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AMLCaseDetail{}, ErrCaseNotFound
+	}
+	if err != nil {
+		return models.AMLCaseDetail{}, fmt.Errorf("store: failed to read AML case: %w", err)
+	}
+	detail := models.AMLCaseDetail{AMLCase: c, Transactions: []models.Transaction{}, Events: []models.AMLCaseEvent{}}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT t.id, t.from_wallet_id, t.to_wallet_id, t.amount, t.currency, t.status, t.type, t.reference_id, t.created_at
+		FROM aml_case_transactions ct
+		JOIN transactions t ON t.id = ct.transaction_id
+		WHERE ct.case_id = $1
+		ORDER BY t.created_at, t.id
+	`, caseId)
+	if err != nil {
+		return models.AMLCaseDetail{}, fmt.Errorf("store: failed to load case transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.Transaction
+		err := rows.Scan(&t.ID, &t.FromWalletID, &t.ToWalletID, &t.Amount, &t.Currency, &t.Status, &t.Type, &t.ReferenceID, &t.CreatedAt)
+		if err != nil {
+			return models.AMLCaseDetail{}, fmt.Errorf("store: failed to scan case transaction: %w", err)
+		}
+		detail.Transactions = append(detail.Transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return models.AMLCaseDetail{}, fmt.Errorf("store: error iterating case transactions: %w", err)
+	}
+
+	rows, err = s.db.Query(ctx, `
+		SELECT id, actor_id, action, note, created_at
+		FROM aml_case_events
+		WHERE case_id = $1
+		ORDER BY created_at, id
+	`, caseId)
+	if err != nil {
+		return models.AMLCaseDetail{}, fmt.Errorf("store: failed to load case events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AMLCaseEvent
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.Note, &e.CreatedAt); err != nil {
+			return models.AMLCaseDetail{}, fmt.Errorf("store: failed to scan case event: %w", err)
+		}
+		detail.Events = append(detail.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return models.AMLCaseDetail{}, fmt.Errorf("store: error iterating case events: %w", err)
+	}
+	return detail, nil
+}
+
+// AddNote annotates a case, closed ones included.
+func (s *AMLStore) AddNote(ctx context.Context, caseId int64, authorId uuid.UUID, note string) (models.AMLCase, error) {
+	return s.act(ctx, caseId, authorId, "note", note, func(tx pgx.Tx, status string) error {
+		return nil
+	})
+}
+
+// EscalateCase hands an open case on for senior review.
+func (s *AMLStore) EscalateCase(ctx context.Context, caseId int64, actorId uuid.UUID, note string) (models.AMLCase, error) {
+	return s.act(ctx, caseId, actorId, "escalated", note, func(tx pgx.Tx, status string) error {
+		switch status {
+		case "escalated":
+			return ErrCaseEscalated
+		case "closed":
+			return ErrCaseClosed
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE aml_cases
+			SET status = 'escalated', escalated_by = $2, escalated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, caseId, actorId)
+		return err
+	})
+}
+
+// CloseCase closes an open or escalated case with its resolution. Later
+// findings on the wallet open a new case.
+func (s *AMLStore) CloseCase(ctx context.Context, caseId int64, actorId uuid.UUID, resolution, note string) (models.AMLCase, error) {
+	return s.act(ctx, caseId, actorId, "closed", note, func(tx pgx.Tx, status string) error {
+		if status == "closed" {
+			return ErrCaseClosed
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE aml_cases
+			SET status = 'closed', resolution = $2, closed_by = $3, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, caseId, resolution, actorId)
+		return err
+	})
+}
+
+// act locks a case, lets apply change it given its status, records the event
+// and returns the case as it is afterwards.
+func (s *AMLStore) act(ctx context.Context, caseId int64, actorId uuid.UUID, action, note string,
+	apply func(tx pgx.Tx, status string) error) (models.AMLCase, error) {
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.AMLCase{}, fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, `SELECT status FROM aml_cases WHERE id = $1 FOR UPDATE`, caseId).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AMLCase{}, ErrCaseNotFound
+	}
+	if err != nil {
+		return models.AMLCase{}, fmt.Errorf("store: failed to lock AML case: %w", err)
+	}
+
+	if err = apply(tx, status); err != nil {
+		if errors.Is(err, ErrCaseClosed) || errors.Is(err, ErrCaseEscalated) {
+			return models.AMLCase{}, err
+		}
+		return models.AMLCase{}, fmt.Errorf("store: failed to update AML case: %w", err)
+	}
+	if err = addEvent(ctx, tx, caseId, &actorId, action, note); err != nil {
+		return models.AMLCase{}, err
+	}
+
+	c, err := scanCase(tx.QueryRow(ctx, `SELECT `+caseColumns+` FROM aml_cases WHERE id = $1`, caseId))
+	if err != nil {
+		return models.AMLCase{}, fmt.Errorf("store: failed to read AML case: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.AMLCase{}, fmt.Errorf("store: failed to commit AML case: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"paygo/mailer"
+	"time"
+)
+
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposePasswordReset = "password_reset"
+
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+func verificationMessage(to, link string) mailer.Message {
+	return mailer.Message{
+		To:      to,
+		Subject: "Verify your PayGo email address",
+		Body: fmt.Sprintf(`Welcome to PayGo!
+
+Confirm your email address by opening the link below:
+
+%s
+
+The link expires in %s. If you did not create a PayGo account you can ignore
+this email.
+`, link, EmailVerificationTTL),
+	}
+}
+
+func passwordResetMessage(to, link string) mailer.Message {
+	return mailer.Message{
+		To:      to,
+		Subject: "Reset your PayGo password",
+		Body: fmt.Sprintf(`Someone asked to reset the password of your PayGo account.
+
+Choose a new password by opening the link below:
+
+%s
+
+The link expires in %s and can only be used once. If this wasn't you, you can
+ignore this email; your password stays the same.
+`, link, PasswordResetTTL),
+	}
+}
+
+// tokenLink points at the client app page that completes a flow, e.g.
+// https://app.example.com/verify-email?token=...
+func tokenLink(baseURL, path, token string) string {
+	return baseURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
@@ -0,0 +1,23 @@
+package auth
+
+import "errors"
+
+var (
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrEmailTaken           = errors.New("email already registered")
+	ErrPasswordTooShort     = errors.New("password must be at least 6 characters long")
+	ErrInvalidRefreshToken  = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected, session revoked")
+	ErrTokenRevoked         = errors.New("token has been revoked")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrKeysNotConfigured    = errors.New("signing keys not configured")
+	ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrTOTPAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled      = errors.New("no pending two-factor enrollment")
+	ErrInvalidTOTPCode      = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+	ErrInvalidUserToken     = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrTooManyAttempts      = errors.New("too many failed login attempts")
+	ErrUserNotFound         = errors.New("user not found")
+)
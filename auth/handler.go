@@ -1,29 +1,55 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type AuthServiceInterface interface {
-	Login(username, password string) (string, error)
-	Register(username, email, password string) (string, error)
+	Login(ctx context.Context, email, password, ip string) (TokenPair, *LoginChallenge, error)
+	CompleteLogin(ctx context.Context, challengeToken, code, ip string) (TokenPair, error)
+	UnlockLogin(ctx context.Context, userId uuid.UUID) error
+	Register(ctx context.Context, name, email, password string) (string, TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (TokenPair, error)
+	Logout(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time, refreshToken string) error
+	LogoutAll(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time) error
+	EnrollTOTP(ctx context.Context, userId string) (TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userId, code string) error
+	SendVerificationEmail(ctx context.Context, userId string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
 }
 
 type AuthHandler struct {
-	service AuthServiceInterface
+	service    AuthServiceInterface
+	trustProxy bool
 }
 
-func NewAuthHandler(s AuthServiceInterface) *AuthHandler {
+// NewAuthHandler builds the handler. With trustProxy set the client IP used
+// for login throttling is taken from X-Forwarded-For, which is only safe
+// behind a proxy that sets it.
+func NewAuthHandler(s AuthServiceInterface, trustProxy bool) *AuthHandler {
 	return &AuthHandler{
-		service: s,
+		service:    s,
+		trustProxy: trustProxy,
 	}
 }
 
 func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var creds struct {
-		Username string `json:"username"`
+		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
@@ -32,27 +58,58 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if creds.Username == "" || creds.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+	if creds.Email == "" || creds.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
 		return
 	}
 
-	user_id, err := h.service.Login(creds.Username, creds.Password)
+	tokens, challenge, err := h.service.Login(r.Context(), creds.Email, creds.Password, h.clientIP(r))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Login failed: %v", err), http.StatusUnauthorized)
+		writeLoginError(w, err)
 		return
 	}
 
-	token, err := CreateToken(creds.Username, user_id)
-	r.Header.Add("Authorization", token)
+	w.Header().Set("Content-Type", "application/json")
+	if challenge != nil {
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// HandleLoginTOTP completes a login that returned a challenge, using a TOTP
+// code or a recovery code.
+func (h *AuthHandler) HandleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if body.ChallengeToken == "" || body.Code == "" {
+		http.Error(w, "challenge_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.CompleteLogin(r.Context(), body.ChallengeToken, body.Code, h.clientIP(r))
+	if err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			writeLoginError(w, err)
+			return
+		}
+		writeTOTPError(w, err, "completing login")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
 }
 
 func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	var creds struct {
-		Username string `json:"username"`
+		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
@@ -60,21 +117,362 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	if creds.Username == "" || creds.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+	if creds.Name == "" || creds.Email == "" || creds.Password == "" {
+		http.Error(w, "Name, email and password are required", http.StatusBadRequest)
+		return
+	}
+	userId, tokens, err := h.service.Register(r.Context(), creds.Name, creds.Email, creds.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPasswordTooShort):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrEmailTaken):
+			http.Error(w, "Email already registered", http.StatusConflict)
+		default:
+			log.Printf("handler: error registering user: %v", err)
+			http.Error(w, "Registration failed", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		UserID string `json:"user_id"`
+		TokenPair
+	}{userId, tokens})
+}
+
+func (h *AuthHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), body.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidRefreshToken), errors.Is(err, ErrRefreshTokenReused):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			log.Printf("handler: error refreshing token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// HandleLogout revokes the access token used for the request and the refresh
+// token passed in the body, if any. It must be wrapped by AuthMiddleware.
+func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	userId, jti, expiresAt, ok := sessionFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.service.Logout(r.Context(), userId.String(), jti, expiresAt, body.RefreshToken); err != nil {
+		log.Printf("handler: error logging out: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleLogoutAll logs the user out of every device. It must be wrapped by
+// AuthMiddleware.
+func (h *AuthHandler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userId, jti, expiresAt, ok := sessionFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.LogoutAll(r.Context(), userId.String(), jti, expiresAt); err != nil {
+		log.Printf("handler: error logging out of all sessions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEnrollTOTP starts two-factor enrollment for the authenticated user and
+// returns the secret and otpauth:// URI to load into an authenticator app.
+func (h *AuthHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(r.Context(), userId.String())
+	if err != nil {
+		writeTOTPError(w, err, "enrolling totp")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// HandleConfirmTOTP enables two-factor authentication once the user proves
+// their app produces valid codes, and returns their recovery codes.
+func (h *AuthHandler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.service.ConfirmTOTP(r.Context(), userId.String(), code)
+	if err != nil {
+		writeTOTPError(w, err, "confirming totp")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{recoveryCodes})
+}
+
+func (h *AuthHandler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	code, ok := decodeCode(w, r)
+	if !ok {
 		return
 	}
-	user_id, err := h.service.Register(creds.Username, creds.Email, creds.Password)
+
+	if err := h.service.DisableTOTP(r.Context(), userId.String(), code); err != nil {
+		writeTOTPError(w, err, "disabling totp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnlockLogin lifts a login lockout on the user's account.
+func (h *AuthHandler) HandleUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Registration failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UnlockLogin(r.Context(), userId); err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("handler: error unlocking login: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
-	token, err := CreateToken(creds.Username, user_id)
+
+	actorId, _ := r.Context().Value("user_id").(uuid.UUID)
+	log.Printf("auth: login lockout of user %s lifted by %s", userId, actorId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLoginError answers failed logins the same way whatever the reason, so
+// responses don't reveal whether an account exists.
+func writeLoginError(w http.ResponseWriter, err error) {
+	var throttled *LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	case errors.Is(err, ErrInvalidCredentials):
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	default:
+		log.Printf("handler: error logging in: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// clientIP returns the address logins are throttled by.
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	if h.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating token: %v", err), http.StatusInternalServerError)
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return "", false
+	}
+	return body.Code, true
+}
+
+func writeTOTPError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, ErrInvalidTOTPCode), errors.Is(err, ErrInvalidChallenge):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrTOTPAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrTOTPNotEnabled), errors.Is(err, ErrTOTPNotEnrolled):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("handler: error %s: %v", action, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleResendVerification sends the authenticated user a new verification
+// email. It must be wrapped by AuthMiddleware.
+func (h *AuthHandler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
 		return
 	}
-	r.Header.Add("Authorization", token)
+
+	if err := h.service.SendVerificationEmail(r.Context(), userId.String()); err != nil {
+		switch {
+		case errors.Is(err, ErrEmailAlreadyVerified):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("handler: error sending verification email: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), body.Token); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidUserToken):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("handler: error verifying email: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRequestPasswordReset always answers 202 so it can't be used to find
+// out which emails have an account.
+func (h *AuthHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(r.Context(), body.Email); err != nil {
+		log.Printf("handler: error requesting password reset: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if body.Token == "" || body.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), body.Token, body.Password); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidUserToken), errors.Is(err, ErrPasswordTooShort):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("handler: error resetting password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sessionFromContext(ctx context.Context) (userId uuid.UUID, jti string, expiresAt time.Time, ok bool) {
+	userId, ok = ctx.Value("user_id").(uuid.UUID)
+	if !ok {
+		return uuid.Nil, "", time.Time{}, false
+	}
+	jti, ok = ctx.Value("token_id").(string)
+	if !ok {
+		return uuid.Nil, "", time.Time{}, false
+	}
+	expiresAt, ok = ctx.Value("token_expires_at").(time.Time)
+	return userId, jti, expiresAt, ok
+}
+
+// HandleJWKS publishes the public signing keys so other services can verify
+// paygo access tokens.
+func (h *AuthHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if keys == nil {
+		http.Error(w, "Signing keys not configured", http.StatusServiceUnavailable)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keys.JWKS())
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -8,20 +9,34 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-var secretKey = []byte("secret-key")
+// AccessTokenTTL is kept short since access tokens are only revocable through
+// the jti revocation list; long-lived sessions use refresh tokens.
+const AccessTokenTTL = 15 * time.Minute
+
+// RevocationList reports whether an access token was revoked before expiring.
+type RevocationList interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+var revocations RevocationList
+
+// SetRevocationList makes ValidateToken reject tokens found in list.
+func SetRevocationList(list RevocationList) {
+	revocations = list
+}
 
 type UserClaims struct {
 	Username string `json:"username"`
+	Access
 	jwt.StandardClaims
 }
 
-func ValidateToken(token string) (claims *UserClaims, err error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return secretKey, nil
-	})
+func ValidateToken(ctx context.Context, token string) (claims *UserClaims, err error) {
+	if keys == nil {
+		return &UserClaims{}, ErrKeysNotConfigured
+	}
+
+	parsedToken, err := jwt.ParseWithClaims(token, &UserClaims{}, keys.verificationKey)
 
 	if err != nil {
 		return &UserClaims{}, err
@@ -41,24 +56,42 @@ func ValidateToken(token string) (claims *UserClaims, err error) {
 		return &UserClaims{}, errors.New("failed to cast claims to UserClaims")
 	}
 
+	if claims.Id == "" {
+		return &UserClaims{}, errors.New("token has no jti")
+	}
+
+	if revocations != nil {
+		revoked, err := revocations.IsTokenRevoked(ctx, claims.Id)
+		if err != nil {
+			return &UserClaims{}, fmt.Errorf("checking revocation list: %w", err)
+		}
+		if revoked {
+			return &UserClaims{}, ErrTokenRevoked
+		}
+	}
+
 	return claims, nil
 }
 
-func CreateToken(username, user_id string) (string, error) {
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		UserClaims{
-			Username: username,
-			StandardClaims: jwt.StandardClaims{
-				Subject:   user_id,
-				ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-				IssuedAt:  time.Now().Unix(),
-				Issuer:    "paygo",
-				Audience:  "paygo_users",
-			},
-		},
-	)
+// CreateToken signs an access token identified by jti, which is what
+// revocation and refresh token rotation refer to, with the active key.
+func CreateToken(username, user_id, jti string, access Access) (string, error) {
+	if keys == nil {
+		return "", ErrKeysNotConfigured
+	}
 
-	token, err := claims.SignedString(secretKey)
+	token, err := keys.sign(UserClaims{
+		Username: username,
+		Access:   access,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   user_id,
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "paygo",
+			Audience:  "paygo_users",
+		},
+	})
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
 	}
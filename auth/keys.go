@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"paygo/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any // nil for verify-only keys
+	verify any
+}
+
+// KeySet holds every key tokens may be verified with, identified by kid, and
+// the active one new tokens are signed with.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	order  []string
+}
+
+var keys *KeySet
+
+// SetKeySet installs the keys used by CreateToken and ValidateToken.
+func SetKeySet(ks *KeySet) {
+	keys = ks
+}
+
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*signingKey)}
+
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.Kid == "" {
+			return nil, errors.New("every signing key needs a kid")
+		}
+		if _, dup := ks.keys[keyCfg.Kid]; dup {
+			return nil, fmt.Errorf("duplicate signing key %q", keyCfg.Kid)
+		}
+
+		key, err := parseSigningKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", keyCfg.Kid, err)
+		}
+		ks.keys[key.kid] = key
+		ks.order = append(ks.order, key.kid)
+	}
+
+	active, ok := ks.keys[cfg.ActiveKid]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", cfg.ActiveKid)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", cfg.ActiveKid)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+func parseSigningKey(cfg config.SigningKey) (*signingKey, error) {
+	key := &signingKey{kid: cfg.Kid}
+	var err error
+
+	switch cfg.Alg {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("HS256 keys need a secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign = []byte(cfg.Secret)
+		key.verify = key.sign
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyPEM != nil {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(cfg.PrivateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.sign, key.verify = private, &private.PublicKey
+		} else if key.verify, err = jwt.ParseRSAPublicKeyFromPEM(cfg.PublicKeyPEM); err != nil {
+			return nil, err
+		}
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyPEM != nil {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(cfg.PrivateKeyPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.sign, key.verify = private, private.(ed25519.PrivateKey).Public()
+		} else if key.verify, err = jwt.ParseEdPublicKeyFromPEM(cfg.PublicKeyPEM); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Alg)
+	}
+
+	return key, nil
+}
+
+// verificationKey is the jwt.Keyfunc used by ValidateToken: the token must
+// name a known kid and be signed with that key's algorithm.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verify, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+	return token.SignedString(ks.active.sign)
+}
+
+// JWK is the public part of an asymmetric key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS lists the public keys other services can verify paygo tokens with.
+// HS256 keys are shared secrets and never published.
+func (ks *KeySet) JWKS() map[string][]JWK {
+	published := []JWK{}
+	for _, kid := range ks.order {
+		if jwk, ok := toJWK(ks.keys[kid]); ok {
+			published = append(published, jwk)
+		}
+	}
+	return map[string][]JWK{"keys": published}
+}
+
+func toJWK(key *signingKey) (JWK, bool) {
+	jwk := JWK{Kid: key.kid, Alg: key.method.Alg(), Use: "sig"}
+	enc := base64.RawURLEncoding
+
+	switch public := key.verify.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(public.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(public)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
@@ -0,0 +1,21 @@
+package auth
+
+// Permissions checked by md.RequirePermission. They are granted through roles
+// stored in Postgres (see sql/payments.sql) and copied into the access token.
+const (
+	PermPaymentsReadAll  = "payments:read_all"
+	PermPaymentsReview   = "payments:review"
+	PermUsersReadAll     = "users:read_all"
+	PermUsersManage      = "users:manage"
+	PermReconcileRun     = "reconcile:run"
+	PermRolesRead        = "roles:read"
+	PermRolesManage      = "roles:manage"
+	PermComplianceReview = "compliance:review"
+	PermAMLCases         = "aml:cases"
+)
+
+// Access is what a user is allowed to do, as carried in their token.
+type Access struct {
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
@@ -1,47 +1,483 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"paygo/config"
+	"paygo/mailer"
 	"paygo/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthStoreInterface interface {
-	GetHashedPassword(username string) (userId, hashedPassw string, err error)
-	Register(username, email, password string) (string, error)
+	GetHashedPassword(ctx context.Context, email string) (userId, hashedPassw string, err error)
+	GetTokenSubject(ctx context.Context, userId string) (email string, access Access, err error)
+	Register(ctx context.Context, name, email, passwordHash string) (string, error)
+	CreateRefreshToken(ctx context.Context, userId string, familyId uuid.UUID, tokenHash, accessJti string) error
+	RotateRefreshToken(ctx context.Context, tokenHash, nextHash, nextAccessJti string) (userId string, err error)
+	RevokeSession(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time, refreshHash string) error
+	RevokeAllSessions(ctx context.Context, userId string) error
+	GetTOTP(ctx context.Context, userId string) (secret string, confirmed bool, err error)
+	SaveTOTPSecret(ctx context.Context, userId, secret string) error
+	ConfirmTOTP(ctx context.Context, userId string, step int64, recoveryHashes []string) error
+	UseTOTPStep(ctx context.Context, userId string, step int64) error
+	UseRecoveryCode(ctx context.Context, userId, codeHash string) error
+	DisableTOTP(ctx context.Context, userId string) error
+	CreateLoginChallenge(ctx context.Context, userId, challengeHash string) error
+	GetLoginChallenge(ctx context.Context, challengeHash string) (userId string, err error)
+	FailLoginChallenge(ctx context.Context, challengeHash string) error
+	ConsumeLoginChallenge(ctx context.Context, challengeHash string) error
+	GetEmailStatus(ctx context.Context, userId string) (email string, verified bool, err error)
+	GetUserIdByEmail(ctx context.Context, email string) (userId string, err error)
+	CreateUserToken(ctx context.Context, userId, purpose, tokenHash string, ttl time.Duration) error
+	VerifyEmail(ctx context.Context, tokenHash string) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) error
+	GetLoginLock(ctx context.Context, email, ip string) (time.Duration, error)
+	GetThrottleLock(ctx context.Context, kind, key string) (time.Duration, error)
+	RecordLoginFailure(ctx context.Context, kind, key string, policy ThrottlePolicy) error
+	ClearLoginFailures(ctx context.Context, kind, key string) error
 }
 
 type AuthService struct {
-	store AuthStoreInterface
+	store        AuthStoreInterface
+	mailer       mailer.Mailer
+	publicURL    string
+	emailPolicy  ThrottlePolicy
+	ipPolicy     ThrottlePolicy
+	stepUpPolicy ThrottlePolicy
 }
 
-func NewAuthService(store AuthStoreInterface) *AuthService {
+// NewAuthService builds the service. publicURL is the base of the links put in
+// verification and password reset emails.
+func NewAuthService(store AuthStoreInterface, mailer mailer.Mailer, publicURL string, throttle config.LoginThrottleConfig) *AuthService {
 	return &AuthService{
-		store: store,
+		store:     store,
+		mailer:    mailer,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		emailPolicy: ThrottlePolicy{
+			MaxFailures: throttle.MaxFailuresPerEmail,
+			Window:      throttle.FailureWindow,
+			Lockout:     throttle.Lockout,
+			Backoff:     true,
+		},
+		// Many users can share an ip behind a NAT, so it is only locked out
+		// once clearly abused.
+		ipPolicy: ThrottlePolicy{
+			MaxFailures: throttle.MaxFailuresPerIP,
+			Window:      throttle.FailureWindow,
+			Lockout:     throttle.Lockout,
+		},
+		stepUpPolicy: ThrottlePolicy{
+			MaxFailures: throttle.MaxFailuresPerEmail,
+			Window:      throttle.FailureWindow,
+			Lockout:     throttle.Lockout,
+			Backoff:     true,
+		},
 	}
 }
 
-func (s *AuthService) Login(username, password string) (string, error) {
+// dummyPasswordHash is compared against when the email is unknown so that a
+// login takes as long whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("paygo-dummy-password")
+	return hash
+})
+
+// Login checks the user's password. Users with two-factor authentication
+// enabled get a challenge instead of tokens, to be completed with CompleteLogin.
+// Failed attempts are throttled per email and per client ip.
+func (s *AuthService) Login(ctx context.Context, email, password, ip string) (TokenPair, *LoginChallenge, error) {
+	if err := s.checkLoginLock(ctx, email, ip); err != nil {
+		return TokenPair{}, nil, err
+	}
 
-	userId, hashedPass, err := s.store.GetHashedPassword(username)
+	userId, hashedPass, err := s.store.GetHashedPassword(ctx, email)
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrInvalidCredentials) {
+			utils.CheckPassword(dummyPasswordHash(), password)
+			return TokenPair{}, nil, s.loginFailed(ctx, email, ip)
+		}
+		return TokenPair{}, nil, err
 	}
 
+	// A hash bcrypt can't use fails like a wrong password, so the response
+	// doesn't single out the account and the attempt is still throttled.
 	ok, err := utils.CheckPassword(hashedPass, password)
+	if err != nil && !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		log.Printf("auth: unusable password hash for user %s: %v", userId, err)
+	}
+	if !ok {
+		return TokenPair{}, nil, s.loginFailed(ctx, email, ip)
+	}
+
+	// Only the account's counter is reset: a valid login says nothing about
+	// the other accounts being tried from the same ip.
+	if err := s.store.ClearLoginFailures(ctx, throttleByEmail, normalizeEmail(email)); err != nil {
+		return TokenPair{}, nil, err
+	}
+
+	_, confirmed, err := s.store.GetTOTP(ctx, userId)
+	if err != nil && !errors.Is(err, ErrTOTPNotEnabled) {
+		return TokenPair{}, nil, err
+	}
+	if confirmed {
+		challenge, challengeHash, err := newRefreshToken()
+		if err != nil {
+			return TokenPair{}, nil, err
+		}
+		if err := s.store.CreateLoginChallenge(ctx, userId, challengeHash); err != nil {
+			return TokenPair{}, nil, err
+		}
+		return TokenPair{}, &LoginChallenge{
+			MFARequired:    true,
+			ChallengeToken: challenge,
+			ExpiresIn:      int64(LoginChallengeTTL.Seconds()),
+		}, nil
+	}
+
+	tokens, err := s.startSession(ctx, userId)
+	return tokens, nil, err
+}
+
+// CompleteLogin finishes a two-step login with either a TOTP code or one of
+// the user's recovery codes. Wrong codes count as failed logins so the second
+// factor can't be guessed by requesting fresh challenges.
+func (s *AuthService) CompleteLogin(ctx context.Context, challengeToken, code, ip string) (TokenPair, error) {
+	challengeHash := hashRefreshToken(challengeToken)
+
+	userId, err := s.store.GetLoginChallenge(ctx, challengeHash)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	email, _, err := s.store.GetEmailStatus(ctx, userId)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.checkLoginLock(ctx, email, ip); err != nil {
+		return TokenPair{}, err
+	}
+
+	if err := s.verifySecondFactor(ctx, userId, code, true); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			if ferr := s.store.FailLoginChallenge(ctx, challengeHash); ferr != nil {
+				return TokenPair{}, ferr
+			}
+			if ferr := s.loginFailed(ctx, email, ip); !errors.Is(ferr, ErrInvalidCredentials) {
+				return TokenPair{}, ferr
+			}
+		}
+		return TokenPair{}, err
+	}
+
+	if err := s.store.ConsumeLoginChallenge(ctx, challengeHash); err != nil {
+		return TokenPair{}, err
+	}
+	return s.startSession(ctx, userId)
+}
+
+// UnlockLogin clears the failed login and step-up counters of a user,
+// lifting any lockout on them.
+func (s *AuthService) UnlockLogin(ctx context.Context, userId uuid.UUID) error {
+	email, _, err := s.store.GetEmailStatus(ctx, userId.String())
+	if errors.Is(err, ErrInvalidCredentials) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.store.ClearLoginFailures(ctx, throttleByEmail, normalizeEmail(email)); err != nil {
+		return err
+	}
+	return s.store.ClearLoginFailures(ctx, throttleByStepUp, userId.String())
+}
+
+func (s *AuthService) checkLoginLock(ctx context.Context, email, ip string) error {
+	retryAfter, err := s.store.GetLoginLock(ctx, normalizeEmail(email), ip)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// loginFailed counts a failed attempt and returns ErrInvalidCredentials, or
+// the error hit while counting.
+func (s *AuthService) loginFailed(ctx context.Context, email, ip string) error {
+	if err := s.store.RecordLoginFailure(ctx, throttleByEmail, normalizeEmail(email), s.emailPolicy); err != nil {
+		return err
+	}
+	if ip != "" {
+		if err := s.store.RecordLoginFailure(ctx, throttleByIP, ip, s.ipPolicy); err != nil {
+			return err
+		}
+	}
+	return ErrInvalidCredentials
+}
+
+// EnrollTOTP generates a new secret for the user. It only takes effect once
+// confirmed with a code from the authenticator app.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userId string) (TOTPEnrollment, error) {
+	email, _, err := s.store.GetTokenSubject(ctx, userId)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	secret, err := newTOTPSecret()
 	if err != nil {
-		return "", fmt.Errorf("error checking password: %v", err)
+		return TOTPEnrollment{}, err
 	}
+	if err := s.store.SaveTOTPSecret(ctx, userId, secret); err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{Secret: secret, URI: totpURI(email, secret)}, nil
+}
 
+// ConfirmTOTP enables two-factor authentication and returns the recovery
+// codes. They are only ever shown this once.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userId, code string) ([]string, error) {
+	secret, confirmed, err := s.store.GetTOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotEnabled) {
+			return nil, ErrTOTPNotEnrolled
+		}
+		return nil, err
+	}
+	if confirmed {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := verifyTOTP(secret, code, time.Now())
 	if !ok {
-		return "", errors.New("Invalid password")
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.ConfirmTOTP(ctx, userId, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It takes a current code so
+// a stolen access token alone cannot remove the second factor.
+func (s *AuthService) DisableTOTP(ctx context.Context, userId, code string) error {
+	if err := s.verifySecondFactor(ctx, userId, code, true); err != nil {
+		return err
+	}
+	return s.store.DisableTOTP(ctx, userId)
+}
+
+// VerifyStepUp checks a fresh TOTP code before a sensitive operation such as
+// a high-value payment. Wrong codes are throttled per user like failed
+// logins, so a stolen access token can't be used to guess the code.
+func (s *AuthService) VerifyStepUp(ctx context.Context, userId uuid.UUID, code string) error {
+	key := userId.String()
+	retryAfter, err := s.store.GetThrottleLock(ctx, throttleByStepUp, key)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+
+	err = s.verifySecondFactor(ctx, key, code, false)
+	if errors.Is(err, ErrInvalidTOTPCode) {
+		if ferr := s.store.RecordLoginFailure(ctx, throttleByStepUp, key, s.stepUpPolicy); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return s.store.ClearLoginFailures(ctx, throttleByStepUp, key)
+}
+
+func (s *AuthService) verifySecondFactor(ctx context.Context, userId, code string, allowRecovery bool) error {
+	secret, confirmed, err := s.store.GetTOTP(ctx, userId)
+	if err != nil {
+		return err
 	}
+	if !confirmed {
+		return ErrTOTPNotEnabled
+	}
+
+	if step, ok := verifyTOTP(secret, code, time.Now()); ok {
+		return s.store.UseTOTPStep(ctx, userId, step)
+	}
+	if allowRecovery {
+		return s.store.UseRecoveryCode(ctx, userId, hashRecoveryCode(code))
+	}
+	return ErrInvalidTOTPCode
+}
+
+func (s *AuthService) Register(ctx context.Context, name, email, password string) (string, TokenPair, error) {
+	if len(password) < 6 {
+		return "", TokenPair{}, ErrPasswordTooShort
+	}
+
+	hashedPass, err := utils.HashPassword(password)
+	if err != nil {
+		return "", TokenPair{}, fmt.Errorf("service: %w", err)
+	}
+
+	userId, err := s.store.Register(ctx, name, email, hashedPass)
+	if err != nil {
+		return "", TokenPair{}, err
+	}
+
+	// The account is usable right away, a lost email can be re-sent.
+	if err := s.SendVerificationEmail(ctx, userId); err != nil {
+		log.Printf("service: failed to send verification email to user %s: %v", userId, err)
+	}
+
+	tokens, err := s.startSession(ctx, userId)
+	if err != nil {
+		return "", TokenPair{}, err
+	}
+
+	return userId, tokens, nil
+}
+
+// Refresh rotates the refresh token and issues a new access token carrying
+// the user's current roles and permissions.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	nextRefresh, nextHash, err := newRefreshToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	jti := uuid.NewString()
+
+	userId, err := s.store.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), nextHash, jti)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return s.signAccessToken(ctx, userId, jti, nextRefresh)
+}
+
+// Logout revokes the access token in use and, if given, the refresh token
+// family of the same session.
+func (s *AuthService) Logout(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time, refreshToken string) error {
+	var refreshHash string
+	if refreshToken != "" {
+		refreshHash = hashRefreshToken(refreshToken)
+	}
+	return s.store.RevokeSession(ctx, userId, accessJti, accessExpiresAt, refreshHash)
+}
+
+// LogoutAll revokes every session of the user, including the access token in
+// use.
+func (s *AuthService) LogoutAll(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time) error {
+	if err := s.store.RevokeAllSessions(ctx, userId); err != nil {
+		return err
+	}
+	return s.store.RevokeSession(ctx, userId, accessJti, accessExpiresAt, "")
+}
+
+// SendVerificationEmail mails the user a link to confirm their address.
+func (s *AuthService) SendVerificationEmail(ctx context.Context, userId string) error {
+	email, verified, err := s.store.GetEmailStatus(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if verified {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+	if err := s.store.CreateUserToken(ctx, userId, purposeVerifyEmail, tokenHash, EmailVerificationTTL); err != nil {
+		return err
+	}
+
+	link := tokenLink(s.publicURL, "/verify-email", token)
+	return s.mailer.Send(ctx, verificationMessage(email, link))
+}
+
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	return s.store.VerifyEmail(ctx, hashRefreshToken(token))
+}
+
+// RequestPasswordReset mails a reset link if an account exists for email. It
+// reports success either way so it can't be used to probe for accounts.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	userId, err := s.store.GetUserIdByEmail(ctx, email)
+	if err != nil || userId == "" {
+		return err
+	}
+
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+	if err := s.store.CreateUserToken(ctx, userId, purposePasswordReset, tokenHash, PasswordResetTTL); err != nil {
+		return err
+	}
+
+	link := tokenLink(s.publicURL, "/reset-password", token)
+	return s.mailer.Send(ctx, passwordResetMessage(email, link))
+}
 
-	return userId, nil
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < 6 {
+		return ErrPasswordTooShort
+	}
+
+	hashedPass, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+
+	return s.store.ResetPassword(ctx, hashRefreshToken(token), hashedPass)
+}
+
+// startSession opens a new refresh token family for the user.
+func (s *AuthService) startSession(ctx context.Context, userId string) (TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	jti := uuid.NewString()
+
+	if err := s.store.CreateRefreshToken(ctx, userId, uuid.New(), refreshHash, jti); err != nil {
+		return TokenPair{}, err
+	}
+
+	return s.signAccessToken(ctx, userId, jti, refreshToken)
 }
 
-func (s *AuthService) Register(username, email, password string) (string, error) {
-	// s.store.
-	// create a user return id and create a wallet from it
-	return "", errors.New("Register method not implemented")
+func (s *AuthService) signAccessToken(ctx context.Context, userId, jti, refreshToken string) (TokenPair, error) {
+	email, access, err := s.store.GetTokenSubject(ctx, userId)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	accessToken, err := CreateToken(email, userId, jti, access)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AccessTokenTTL.Seconds()),
+	}, nil
 }
@@ -3,25 +3,647 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"paygo/screening"
+	"time"
 
-	"github.com/jackc/pgx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// pgUniqueViolation is the Postgres error code raised when a UNIQUE constraint fails.
+const pgUniqueViolation = "23505"
+
 type AuthStore struct {
-	db *pgxpool.Pool
+	db       *pgxpool.Pool
+	screener *screening.Screener
+}
+
+func NewAuthStore(db *pgxpool.Pool, screener *screening.Screener) *AuthStore {
+	return &AuthStore{db, screener}
 }
 
-func (s *AuthStore) GetHashedPasswordAndId(username string) (userId, hashedPassw string, err error) {
-	query := `SELECT password_hash FROM users WHERE username = $1`
-	row := s.db.QueryRow(context.Background(), query, username, hashedPassw)
+func (s *AuthStore) GetHashedPassword(ctx context.Context, email string) (userId, hashedPassw string, err error) {
+	query := `SELECT id::text, password_hash FROM users WHERE email = $1`
 
-	if err := row.Scan(&userId, &hashedPassw); err != nil {
-		if err == pgx.ErrNoRows {
-			return "", "", errors.New("invalid credentials")
+	if err := s.db.QueryRow(ctx, query, email).Scan(&userId, &hashedPassw); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", ErrInvalidCredentials
 		}
-		return "", "", err
+		return "", "", fmt.Errorf("store: failed to fetch credentials: %w", err)
 	}
 
 	return userId, hashedPassw, nil
 }
+
+// GetTokenSubject returns what goes into a user's access token: their email
+// as username, the roles granted to them and the union of their permissions.
+func (s *AuthStore) GetTokenSubject(ctx context.Context, userId string) (email string, access Access, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT
+			u.email,
+			COALESCE(ARRAY_AGG(DISTINCT ur.role) FILTER (WHERE ur.role IS NOT NULL), '{}'),
+			COALESCE(ARRAY_AGG(DISTINCT rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM users u
+		LEFT JOIN user_roles ur ON ur.user_id = u.id
+		LEFT JOIN role_permissions rp ON rp.role = ur.role
+		WHERE u.id = $1
+		GROUP BY u.email
+	`, userId).Scan(&email, &access.Roles, &access.Permissions)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", Access{}, ErrInvalidCredentials
+		}
+		return "", Access{}, fmt.Errorf("store: failed to fetch access: %w", err)
+	}
+	return email, access, nil
+}
+
+// Register creates the user and their wallet in a single transaction so a user
+// can never exist without a wallet to pay from.
+func (s *AuthStore) Register(ctx context.Context, name, email, passwordHash string) (string, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userId string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (name, email, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id::text
+	`, name, email, passwordHash).Scan(&userId)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return "", ErrEmailTaken
+		}
+		return "", fmt.Errorf("store: failed to insert user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO wallets (user_id) VALUES ($1)`, userId)
+	if err != nil {
+		return "", fmt.Errorf("store: failed to create wallet: %w", err)
+	}
+
+	// A user matching the sanctions watchlist is registered frozen until
+	// compliance reviews the hit.
+	if _, err = s.screener.HoldNewUser(ctx, tx, uuid.MustParse(userId), name); err != nil {
+		return "", fmt.Errorf("store: failed to screen user: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("store: failed to commit registration: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (s *AuthStore) CreateRefreshToken(ctx context.Context, userId string, familyId uuid.UUID, tokenHash, accessJti string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5::interval)
+	`, userId, familyId, tokenHash, accessJti, RefreshTokenTTL)
+	if err != nil {
+		return fmt.Errorf("store: failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken exchanges a refresh token for the next one in its
+// family. Presenting a token that was already rotated or revoked means it
+// leaked, so the whole family is revoked and ErrRefreshTokenReused returned.
+func (s *AuthStore) RotateRefreshToken(ctx context.Context, tokenHash, nextHash, nextAccessJti string) (userId string, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		tokenId   uuid.UUID
+		familyId  uuid.UUID
+		expired   bool
+		usedAt    *time.Time
+		revokedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id::text, family_id, expires_at < CURRENT_TIMESTAMP, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, tokenHash).Scan(&tokenId, &userId, &familyId, &expired, &usedAt, &revokedAt)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidRefreshToken
+		}
+		return "", fmt.Errorf("store: failed to fetch refresh token: %w", err)
+	}
+
+	if usedAt != nil || revokedAt != nil {
+		if err := revokeRefreshTokens(ctx, tx, `family_id = $1`, familyId); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("store: failed to commit family revocation: %w", err)
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	if expired {
+		return "", ErrInvalidRefreshToken
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, tokenId)
+	batch.Queue(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5::interval)
+	`, userId, familyId, nextHash, nextAccessJti, RefreshTokenTTL)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return "", fmt.Errorf("store: failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("store: failed to commit refresh token rotation: %w", err)
+	}
+	return userId, nil
+}
+
+// RevokeSession revokes the access token jti and, when refreshHash is set, the
+// refresh token family it belongs to. Only the user's own tokens are touched.
+func (s *AuthStore) RevokeSession(ctx context.Context, userId, accessJti string, accessExpiresAt time.Time, refreshHash string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, accessJti, accessExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("store: failed to revoke access token: %w", err)
+	}
+
+	if refreshHash != "" {
+		err = revokeRefreshTokens(ctx, tx, `
+			family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2)
+		`, refreshHash, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit logout: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions logs the user out of every device.
+func (s *AuthStore) RevokeAllSessions(ctx context.Context, userId string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := revokeRefreshTokens(ctx, tx, `user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit logout: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthStore) IsTokenRevoked(ctx context.Context, jti string) (revoked bool, err error) {
+	err = s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("store: failed to check revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+// revokeRefreshTokens revokes the refresh tokens matching where and puts the
+// access tokens issued alongside them that may still be alive on the
+// revocation list.
+func revokeRefreshTokens(ctx context.Context, tx pgx.Tx, where string, args ...any) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, created_at + $%d::interval
+		FROM refresh_tokens
+		WHERE %s AND created_at > CURRENT_TIMESTAMP - $%d::interval
+		ON CONFLICT (jti) DO NOTHING
+	`, len(args)+1, where, len(args)+1), append(args, AccessTokenTTL)...)
+	if err != nil {
+		return fmt.Errorf("store: failed to revoke access tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE %s AND revoked_at IS NULL
+	`, where), args...)
+	if err != nil {
+		return fmt.Errorf("store: failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// GetTOTP returns the user's TOTP secret and whether enrollment was confirmed.
+// ErrTOTPNotEnabled is returned when the user never started enrolling.
+func (s *AuthStore) GetTOTP(ctx context.Context, userId string) (secret string, confirmed bool, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT secret, confirmed_at IS NOT NULL FROM user_totp WHERE user_id = $1
+	`, userId).Scan(&secret, &confirmed)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, ErrTOTPNotEnabled
+		}
+		return "", false, fmt.Errorf("store: failed to fetch totp secret: %w", err)
+	}
+	return secret, confirmed, nil
+}
+
+// SaveTOTPSecret starts (or restarts) an enrollment. It refuses to replace the
+// secret of a confirmed enrollment.
+func (s *AuthStore) SaveTOTPSecret(ctx context.Context, userId, secret string) error {
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL
+	`, userId, secret)
+	if err != nil {
+		return fmt.Errorf("store: failed to save totp secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// ConfirmTOTP enables two-factor authentication using the step of the code the
+// user proved possession with and replaces any previous recovery codes.
+func (s *AuthStore) ConfirmTOTP(ctx context.Context, userId string, step int64, recoveryHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_totp
+		SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL AND last_used_step < $2
+	`, userId, step)
+	if err != nil {
+		return fmt.Errorf("store: failed to confirm totp: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPNotEnrolled
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM totp_recovery_codes WHERE user_id = $1`, userId)
+	for _, hash := range recoveryHashes {
+		batch.Queue(`INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, hash)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("store: failed to store recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit totp confirmation: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep marks a time step as consumed. A code can only be used once, so
+// a step at or before the last one used is rejected with ErrInvalidTOTPCode.
+func (s *AuthStore) UseTOTPStep(ctx context.Context, userId string, step int64) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+	`, userId, step)
+	if err != nil {
+		return fmt.Errorf("store: failed to record totp use: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (s *AuthStore) UseRecoveryCode(ctx context.Context, userId, codeHash string) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE totp_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userId, codeHash)
+	if err != nil {
+		return fmt.Errorf("store: failed to use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func (s *AuthStore) DisableTOTP(ctx context.Context, userId string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM totp_recovery_codes WHERE user_id = $1`, userId)
+	batch.Queue(`DELETE FROM user_totp WHERE user_id = $1`, userId)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("store: failed to disable totp: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit totp removal: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthStore) CreateLoginChallenge(ctx context.Context, userId, challengeHash string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO login_challenges (token_hash, user_id, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3::interval)
+	`, challengeHash, userId, LoginChallengeTTL)
+	if err != nil {
+		return fmt.Errorf("store: failed to create login challenge: %w", err)
+	}
+	return nil
+}
+
+// GetLoginChallenge returns the user a pending challenge was issued to.
+// Expired, consumed and exhausted challenges are rejected.
+func (s *AuthStore) GetLoginChallenge(ctx context.Context, challengeHash string) (userId string, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT user_id::text FROM login_challenges
+		WHERE token_hash = $1
+		  AND consumed_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		  AND attempts < $2
+	`, challengeHash, maxChallengeAttempts).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidChallenge
+		}
+		return "", fmt.Errorf("store: failed to fetch login challenge: %w", err)
+	}
+	return userId, nil
+}
+
+func (s *AuthStore) FailLoginChallenge(ctx context.Context, challengeHash string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = $1
+	`, challengeHash)
+	if err != nil {
+		return fmt.Errorf("store: failed to record challenge attempt: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLoginChallenge marks the challenge as used so it cannot complete a
+// second login.
+func (s *AuthStore) ConsumeLoginChallenge(ctx context.Context, challengeHash string) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE login_challenges SET consumed_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND consumed_at IS NULL
+	`, challengeHash)
+	if err != nil {
+		return fmt.Errorf("store: failed to consume login challenge: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// GetEmailStatus returns the user's email and whether it has been verified.
+func (s *AuthStore) GetEmailStatus(ctx context.Context, userId string) (email string, verified bool, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1
+	`, userId).Scan(&email, &verified)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, ErrInvalidCredentials
+		}
+		return "", false, fmt.Errorf("store: failed to fetch email status: %w", err)
+	}
+	return email, verified, nil
+}
+
+// GetUserIdByEmail returns "" without an error when no user has that email.
+func (s *AuthStore) GetUserIdByEmail(ctx context.Context, email string) (userId string, err error) {
+	err = s.db.QueryRow(ctx, `SELECT id::text FROM users WHERE email = $1`, email).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("store: failed to look up user by email: %w", err)
+	}
+	return userId, nil
+}
+
+// CreateUserToken stores a single-use token for the given purpose. Earlier
+// unused tokens of the same purpose are discarded so only the latest email
+// sent works.
+func (s *AuthStore) CreateUserToken(ctx context.Context, userId, purpose, tokenHash string, ttl time.Duration) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userId, purpose)
+	batch.Queue(`
+		INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $4::interval)
+	`, tokenHash, userId, purpose, ttl)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("store: failed to create %s token: %w", purpose, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit %s token: %w", purpose, err)
+	}
+	return nil
+}
+
+// VerifyEmail consumes an email verification token and marks the address of
+// its user as verified.
+func (s *AuthStore) VerifyEmail(ctx context.Context, tokenHash string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	userId, err := consumeUserToken(ctx, tx, purposeVerifyEmail, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = $1
+	`, userId)
+	if err != nil {
+		return fmt.Errorf("store: failed to mark email verified: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit email verification: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword consumes a password reset token, sets the new password and
+// logs the user out everywhere, since whoever held the old password may
+// still have a session.
+func (s *AuthStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	userId, err := consumeUserToken(ctx, tx, purposePasswordReset, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userId, passwordHash)
+	if err != nil {
+		return fmt.Errorf("store: failed to update password: %w", err)
+	}
+
+	if err := revokeRefreshTokens(ctx, tx, `user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit password reset: %w", err)
+	}
+	return nil
+}
+
+func consumeUserToken(ctx context.Context, tx pgx.Tx, purpose, tokenHash string) (userId string, err error) {
+	err = tx.QueryRow(ctx, `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1
+		  AND purpose = $2
+		  AND used_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id::text
+	`, tokenHash, purpose).Scan(&userId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidUserToken
+		}
+		return "", fmt.Errorf("store: failed to consume %s token: %w", purpose, err)
+	}
+	return userId, nil
+}
+
+// GetLoginLock returns how long the longest active lock on any of the given
+// throttle keys still lasts, or 0 if none is locked.
+func (s *AuthStore) GetLoginLock(ctx context.Context, email, ip string) (time.Duration, error) {
+	var seconds float64
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - CURRENT_TIMESTAMP), 0)::float8
+		FROM login_attempts
+		WHERE ((kind = $1 AND key = $2) OR (kind = $3 AND key = $4))
+		  AND locked_until > CURRENT_TIMESTAMP
+	`, throttleByEmail, email, throttleByIP, ip).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("store: failed to check login lock: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// GetThrottleLock returns how long the lock on a single throttle key still
+// lasts, or 0 if it isn't locked.
+func (s *AuthStore) GetThrottleLock(ctx context.Context, kind, key string) (time.Duration, error) {
+	var seconds float64
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - CURRENT_TIMESTAMP), 0)::float8
+		FROM login_attempts
+		WHERE kind = $1 AND key = $2 AND locked_until > CURRENT_TIMESTAMP
+	`, kind, key).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("store: failed to check %s lock: %w", kind, err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecordLoginFailure counts a failed login against key and locks it as the
+// policy dictates. Failures older than the policy window are forgotten.
+func (s *AuthStore) RecordLoginFailure(ctx context.Context, kind, key string, policy ThrottlePolicy) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var failures int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO login_attempts (kind, key, failures)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (kind, key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < CURRENT_TIMESTAMP - $3::interval THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures
+	`, kind, key, policy.Window).Scan(&failures)
+	if err != nil {
+		return fmt.Errorf("store: failed to record login failure: %w", err)
+	}
+
+	if lock := policy.lockFor(failures); lock > 0 {
+		_, err = tx.Exec(ctx, `
+			UPDATE login_attempts SET locked_until = CURRENT_TIMESTAMP + $3::interval
+			WHERE kind = $1 AND key = $2
+		`, kind, key, lock)
+		if err != nil {
+			return fmt.Errorf("store: failed to lock %s: %w", kind, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit login failure: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthStore) ClearLoginFailures(ctx context.Context, kind, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM login_attempts WHERE kind = $1 AND key = $2`, kind, key)
+	if err != nil {
+		return fmt.Errorf("store: failed to clear login failures: %w", err)
+	}
+	return nil
+}
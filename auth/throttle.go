@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per email and per client IP. Both are keyed on
+// the raw value rather than the user so unknown emails are throttled exactly
+// like real ones. Wrong step-up codes are counted per user, who is already
+// authenticated.
+const (
+	throttleByEmail  = "email"
+	throttleByIP     = "ip"
+	throttleByStepUp = "step_up"
+
+	// backoffFreeFailures is how many failures are allowed before every
+	// further attempt has to wait, doubling from backoffBase.
+	backoffFreeFailures = 2
+	backoffBase         = time.Second
+)
+
+// ThrottlePolicy limits failed logins for one kind of key. After MaxFailures
+// failures within Window the key is locked for Lockout. With Backoff, the
+// failures before that already make the key wait exponentially longer.
+type ThrottlePolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	Lockout     time.Duration
+	Backoff     bool
+}
+
+// lockFor returns how long a key must wait after its nth failure.
+func (p ThrottlePolicy) lockFor(failures int) time.Duration {
+	if failures >= p.MaxFailures {
+		return p.Lockout
+	}
+	if !p.Backoff || failures <= backoffFreeFailures {
+		return 0
+	}
+	delay := backoffBase << (failures - backoffFreeFailures - 1)
+	return min(delay, p.Lockout)
+}
+
+// LoginThrottledError is returned while an email or IP is locked out. It
+// matches ErrTooManyAttempts with errors.Is.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -1,13 +1,121 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"paygo/currency"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DatabaseURL string
-	Port        string
+	DatabaseURL       string
+	Port              string
+	ReconcileInterval time.Duration // 0 disables the in-process reconciliation job
+	JWT               JWTConfig
+	StepUpThresholds  map[string]int64 // payment amount per currency, in its minor units, requiring a TOTP code
+	PublicURL         string           // base URL of the client app, used for links in emails
+	Mail              MailConfig
+	LoginThrottle     LoginThrottleConfig
+	TrustProxyHeaders bool // take the client IP from X-Forwarded-For
+	FX                FXConfig
+	Fees              FeeSchedule
+	Limits            Limits
+	Fraud             FraudRules
+	Review            ReviewConfig
+	Screening         ScreeningConfig
+	AML               AMLConfig
+	Schedules         ScheduleConfig
+	Withdrawals       WithdrawalConfig
+}
+
+// WithdrawalConfig drives the sweep that settles withdrawals left pending
+// when the process died or settlement failed after calling the payout
+// processor. A withdrawal is picked up once its last payout attempt is
+// StaleAfter old.
+type WithdrawalConfig struct {
+	RecoveryInterval time.Duration // how often the sweep runs, 0 disables it
+	StaleAfter       time.Duration
+}
+
+// ScheduleConfig drives the worker that executes scheduled payments. A
+// failed payment is retried up to MaxAttempts times, RetryBackoff apart and
+// doubling each time, before its occurrence is given up.
+type ScheduleConfig struct {
+	PollInterval time.Duration // how often due payments are looked for, 0 disables the worker
+	Lease        time.Duration // how long a worker owns a payment it is executing
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// AMLConfig tunes the anti-money-laundering scan, which looks back over
+// Window of transactions for structuring, fan-in/fan-out and circular flows.
+// Amounts are in minor units of the wallet's currency.
+type AMLConfig struct {
+	ScanInterval time.Duration // how often the scan runs in-process, 0 disables it
+	Window       time.Duration
+
+	// Structuring: at least StructuringMinCount deposits into a wallet, each
+	// below the threshold for its currency by no more than
+	// StructuringMarginBps. Deposits in currencies without a threshold aren't
+	// checked.
+	StructuringThresholds map[string]int64
+	StructuringMarginBps  int64
+	StructuringMinCount   int
+
+	// Fan-in/fan-out: a wallet paid by, or paying, at least this many
+	// distinct wallets.
+	FanMinCounterparties int
+
+	// Circular flows: money returning to the wallet it left through at most
+	// CycleMaxLength payments, each at least CycleMinAmount and made after
+	// the one before.
+	CycleMaxLength int
+	CycleMinAmount int64
+}
+
+// ScreeningConfig selects the sanctions watchlist new users and payment
+// receivers are screened against. Without WatchlistFile nobody is screened.
+type ScreeningConfig struct {
+	WatchlistFile string  // OFAC SDN-style .csv or .xml
+	Threshold     float64 // name similarity from 0 to 1 that counts as a hit
+}
+
+// ReviewConfig bounds how long payments held by the fraud rules wait for a
+// reviewer. Unreviewed payments are returned to the sender once SLA passes.
+type ReviewConfig struct {
+	SLA            time.Duration
+	ExpiryInterval time.Duration // how often overdue reviews are expired, 0 disables it
+}
+
+// FXConfig selects where exchange rates come from and how quotes are priced.
+// RatesURL takes precedence over RatesFile; with neither FX is unavailable.
+type FXConfig struct {
+	RatesFile string
+	RatesURL  string
+	QuoteTTL  time.Duration // how long a quote's rate is honoured
+	SpreadBps int64         // margin taken off the mid rate, in basis points
+}
+
+// MailConfig selects how outgoing mail is delivered. Without an SMTP server
+// mail is written to OutboxDir, or to the log if that is unset too.
+type MailConfig struct {
+	From         string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string
+}
+
+// LoginThrottleConfig bounds failed logins. Failures are counted per email and
+// per client IP and forgotten after FailureWindow without another failure.
+type LoginThrottleConfig struct {
+	MaxFailuresPerEmail int
+	MaxFailuresPerIP    int
+	FailureWindow       time.Duration
+	Lockout             time.Duration
 }
 
 func LoadConfig() Config {
@@ -21,8 +129,195 @@ func LoadConfig() Config {
 		os.Exit(1) // Exit the program with error code
 	}
 
+	jwtConfig, err := loadJWTConfig()
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	fees, err := loadFeeSchedule()
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	limits, err := loadLimits()
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	fraud, err := loadFraudRules()
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	fx, err := loadFXConfig()
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	stepUpThresholds, err := currencyAmountsEnv("STEP_UP_THRESHOLDS", "")
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
+	structuringThresholds, err := currencyAmountsEnv("AML_STRUCTURING_THRESHOLDS", "USD=1000000")
+	if err != nil {
+		log.Println(err)
+		log.Println("Shutting down server...")
+		os.Exit(1)
+	}
+
 	return Config{
-		DatabaseURL: DB_URL,
-		Port:        APP_PORT,
+		DatabaseURL:       DB_URL,
+		Port:              APP_PORT,
+		ReconcileInterval: durationEnv("RECONCILE_INTERVAL", 0),
+		JWT:               jwtConfig,
+		StepUpThresholds:  stepUpThresholds,
+		PublicURL:         stringEnv("PUBLIC_URL", "http://localhost:"+APP_PORT),
+		Mail: MailConfig{
+			From:         stringEnv("MAIL_FROM", "PayGo <no-reply@paygo.local>"),
+			SMTPAddr:     os.Getenv("SMTP_ADDR"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			OutboxDir:    os.Getenv("MAIL_OUTBOX_DIR"),
+		},
+		LoginThrottle: LoginThrottleConfig{
+			MaxFailuresPerEmail: int(int64Env("LOGIN_MAX_FAILURES", 5)),
+			MaxFailuresPerIP:    int(int64Env("LOGIN_MAX_FAILURES_PER_IP", 50)),
+			FailureWindow:       durationEnv("LOGIN_FAILURE_WINDOW", time.Hour),
+			Lockout:             durationEnv("LOGIN_LOCKOUT", 15*time.Minute),
+		},
+		TrustProxyHeaders: os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		FX:                fx,
+		Fees:              fees,
+		Limits:            limits,
+		Fraud:             fraud,
+		Review: ReviewConfig{
+			SLA:            durationEnv("REVIEW_SLA", 24*time.Hour),
+			ExpiryInterval: durationEnv("REVIEW_EXPIRY_INTERVAL", time.Minute),
+		},
+		Screening: ScreeningConfig{
+			WatchlistFile: os.Getenv("SCREENING_WATCHLIST_FILE"),
+			Threshold:     float64Env("SCREENING_THRESHOLD", 0.9),
+		},
+		AML: AMLConfig{
+			ScanInterval:          durationEnv("AML_SCAN_INTERVAL", time.Hour),
+			Window:                durationEnv("AML_WINDOW", 7*24*time.Hour),
+			StructuringThresholds: structuringThresholds,
+			StructuringMarginBps:  int64Env("AML_STRUCTURING_MARGIN_BPS", 1000),
+			StructuringMinCount:   int(int64Env("AML_STRUCTURING_MIN_COUNT", 3)),
+			FanMinCounterparties:  int(int64Env("AML_FAN_MIN_COUNTERPARTIES", 20)),
+			CycleMaxLength:        int(int64Env("AML_CYCLE_MAX_LENGTH", 4)),
+			CycleMinAmount:        int64Env("AML_CYCLE_MIN_AMOUNT", 100_000),
+		},
+		Schedules: ScheduleConfig{
+			PollInterval: durationEnv("SCHEDULE_POLL_INTERVAL", 30*time.Second),
+			Lease:        durationEnv("SCHEDULE_LEASE", 2*time.Minute),
+			MaxAttempts:  int(int64Env("SCHEDULE_MAX_ATTEMPTS", 3)),
+			RetryBackoff: durationEnv("SCHEDULE_RETRY_BACKOFF", 15*time.Minute),
+		},
+		Withdrawals: WithdrawalConfig{
+			RecoveryInterval: durationEnv("WITHDRAWAL_RECOVERY_INTERVAL", time.Minute),
+			StaleAfter:       durationEnv("WITHDRAWAL_STALE_AFTER", 5*time.Minute),
+		},
+	}
+}
+
+func loadFXConfig() (FXConfig, error) {
+	cfg := FXConfig{
+		RatesFile: os.Getenv("FX_RATES_FILE"),
+		RatesURL:  os.Getenv("FX_RATES_URL"),
+		QuoteTTL:  durationEnv("FX_QUOTE_TTL", 30*time.Second),
+		SpreadBps: int64Env("FX_SPREAD_BPS", 50),
+	}
+	if cfg.SpreadBps < 0 || cfg.SpreadBps > 10_000 {
+		return FXConfig{}, fmt.Errorf("FX_SPREAD_BPS must be between 0 and 10000, got %d", cfg.SpreadBps)
+	}
+	return cfg, nil
+}
+
+// currencyAmountsEnv reads a comma separated list of CODE=amount pairs in
+// minor units of each currency, such as "USD=1000000,JPY=100000000".
+func currencyAmountsEnv(name, fallback string) (map[string]int64, error) {
+	amounts := map[string]int64{}
+	raw := stringEnv(name, fallback)
+	if raw == "" {
+		return amounts, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		code, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return nil, fmt.Errorf("%s: %q is not CODE=amount", name, pair)
+		}
+		c, err := currency.Lookup(code)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		amount, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("%s: amount for %s must be a positive integer", name, c.Code)
+		}
+		amounts[c.Code] = amount
+	}
+	return amounts, nil
+}
+
+func stringEnv(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %v", name, err)
+		os.Exit(1)
+	}
+	return d
+}
+
+func int64Env(name string, fallback int64) int64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %v", name, err)
+		os.Exit(1)
+	}
+	return n
+}
+
+func float64Env(name string, fallback float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s: %v", name, err)
+		os.Exit(1)
 	}
+	return f
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// FeeSchedule prices payments, deposits and withdrawals. For each transaction
+// the rule matching its type and currency applies, falling back to the rule
+// for currency "*". Without a matching rule the transaction is free.
+type FeeSchedule struct {
+	Rules []FeeRule `json:"rules"`
+}
+
+// FeeRule charges Flat plus PercentBps of the amount, or the pricing of the
+// first tier the amount falls in, then clamps the result to [Min, Max]. All
+// amounts are in minor units of the transaction's currency, so a "*" rule
+// with a flat fee charges 30 cents and 30 yen alike.
+type FeeRule struct {
+	Type       string    `json:"type"`     // 'payment', 'deposit' or 'withdrawal'
+	Currency   string    `json:"currency"` // ISO 4217 code or "*"
+	Flat       int64     `json:"flat"`
+	PercentBps int64     `json:"percent_bps"` // 100 bps = 1%
+	Tiers      []FeeTier `json:"tiers,omitempty"`
+	Min        int64     `json:"min"`
+	Max        int64     `json:"max"` // 0 means no cap
+}
+
+// FeeTier prices amounts up to and including UpTo. The last tier may leave
+// UpTo at 0 to cover every larger amount.
+type FeeTier struct {
+	UpTo       int64 `json:"up_to"`
+	Flat       int64 `json:"flat"`
+	PercentBps int64 `json:"percent_bps"`
+}
+
+// feeTypes are the transaction types fees and limits apply to.
+var feeTypes = []string{"payment", "deposit", "withdrawal"}
+
+// loadFeeSchedule reads FEE_SCHEDULE_FILE. Without it nothing is charged.
+func loadFeeSchedule() (FeeSchedule, error) {
+	path := os.Getenv("FEE_SCHEDULE_FILE")
+	if path == "" {
+		return FeeSchedule{}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return FeeSchedule{}, fmt.Errorf("reading fee schedule: %w", err)
+	}
+
+	var schedule FeeSchedule
+	if err := json.Unmarshal(raw, &schedule); err != nil {
+		return FeeSchedule{}, fmt.Errorf("parsing fee schedule: %w", err)
+	}
+	for i, rule := range schedule.Rules {
+		if err := rule.validate(); err != nil {
+			return FeeSchedule{}, fmt.Errorf("fee schedule rule %d: %w", i, err)
+		}
+	}
+	return schedule, nil
+}
+
+func (r FeeRule) validate() error {
+	if !slices.Contains(feeTypes, r.Type) {
+		return fmt.Errorf("type must be one of %v", feeTypes)
+	}
+	if r.Currency == "" {
+		return fmt.Errorf("currency is required, use \"*\" for any")
+	}
+	if r.Flat < 0 || r.Min < 0 || r.Max < 0 || r.PercentBps < 0 || r.PercentBps > 10_000 {
+		return fmt.Errorf("amounts must not be negative and percent_bps at most 10000")
+	}
+	if r.Max > 0 && r.Min > r.Max {
+		return fmt.Errorf("min exceeds max")
+	}
+	for i, tier := range r.Tiers {
+		if tier.Flat < 0 || tier.PercentBps < 0 || tier.PercentBps > 10_000 {
+			return fmt.Errorf("tier %d: amounts must not be negative and percent_bps at most 10000", i)
+		}
+		last := i == len(r.Tiers)-1
+		if tier.UpTo == 0 && !last {
+			return fmt.Errorf("tier %d: only the last tier may be unbounded", i)
+		}
+		if i > 0 && tier.UpTo != 0 && tier.UpTo <= r.Tiers[i-1].UpTo {
+			return fmt.Errorf("tier %d: up_to must increase", i)
+		}
+	}
+	return nil
+}
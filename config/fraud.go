@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// FraudRules configures the checks every payment is scored against. The
+// scores of the rules a payment triggers add up; at HoldScore the payment is
+// held for review and at BlockScore it is refused.
+type FraudRules struct {
+	HoldScore  int         `json:"hold_score"`
+	BlockScore int         `json:"block_score"`
+	Rules      []FraudRule `json:"rules"`
+}
+
+// FraudRule is one check. Kind selects the check and the other fields are its
+// parameters; which ones apply depends on the kind:
+//
+//   - velocity: more than MaxCount payments sent within Window
+//   - new_recipient_large_amount: at least MinAmount to someone never paid before
+//   - round_amount_burst: more than MaxCount payments in multiples of RoundTo within Window
+//   - deposit_then_send: sending at least MinRatio of what was deposited within Window
+//   - distinct_recipients: paying more than MaxCount different users within Window
+type FraudRule struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Score     int      `json:"score"`
+	Window    Duration `json:"window,omitempty"`
+	MaxCount  int64    `json:"max_count,omitempty"`
+	MinAmount int64    `json:"min_amount,omitempty"` // in minor units of the payment's currency
+	RoundTo   int64    `json:"round_to,omitempty"`
+	MinRatio  float64  `json:"min_ratio,omitempty"`
+}
+
+// Duration reads a time.Duration from a string such as "10m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+var fraudRuleKinds = []string{
+	"velocity",
+	"new_recipient_large_amount",
+	"round_amount_burst",
+	"deposit_then_send",
+	"distinct_recipients",
+}
+
+// loadFraudRules reads FRAUD_RULES_FILE. Without it every payment is allowed.
+func loadFraudRules() (FraudRules, error) {
+	path := os.Getenv("FRAUD_RULES_FILE")
+	if path == "" {
+		return FraudRules{}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return FraudRules{}, fmt.Errorf("reading fraud rules: %w", err)
+	}
+
+	var rules FraudRules
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return FraudRules{}, fmt.Errorf("parsing fraud rules: %w", err)
+	}
+	if rules.HoldScore <= 0 || rules.BlockScore < rules.HoldScore {
+		return FraudRules{}, fmt.Errorf("fraud rules: hold_score must be positive and block_score at least hold_score")
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return FraudRules{}, fmt.Errorf("fraud rule %d (%s): %w", i, rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r FraudRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !slices.Contains(fraudRuleKinds, r.Kind) {
+		return fmt.Errorf("kind must be one of %v", fraudRuleKinds)
+	}
+	if r.Score <= 0 {
+		return fmt.Errorf("score must be positive")
+	}
+	if r.Kind != "new_recipient_large_amount" && r.Window <= 0 {
+		return fmt.Errorf("window is required")
+	}
+
+	switch r.Kind {
+	case "velocity", "distinct_recipients", "round_amount_burst":
+		if r.MaxCount <= 0 {
+			return fmt.Errorf("max_count must be positive")
+		}
+	case "new_recipient_large_amount":
+		if r.MinAmount <= 0 {
+			return fmt.Errorf("min_amount must be positive")
+		}
+	case "deposit_then_send":
+		if r.MinRatio <= 0 {
+			return fmt.Errorf("min_ratio must be positive")
+		}
+	}
+	if r.Kind == "round_amount_burst" && r.RoundTo <= 0 {
+		return fmt.Errorf("round_to must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SigningKey describes one JWT key. HS256 keys use Secret; RS256 and EdDSA
+// keys point at PEM files, resolved relative to the keys file. A key with only
+// a public key can verify tokens but never sign them, which is how retired
+// keys are kept around until the tokens they signed expire.
+type SigningKey struct {
+	Kid            string `json:"kid"`
+	Alg            string `json:"alg"` // HS256, RS256 or EdDSA
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+
+	PrivateKeyPEM []byte `json:"-"`
+	PublicKeyPEM  []byte `json:"-"`
+}
+
+type JWTConfig struct {
+	ActiveKid string       `json:"active_kid"` // key used to sign new tokens
+	Keys      []SigningKey `json:"keys"`
+}
+
+// loadJWTConfig reads the key set from JWT_KEYS_FILE, or falls back to a
+// single HS256 key from JWT_SECRET.
+func loadJWTConfig() (JWTConfig, error) {
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		return readJWTKeysFile(path)
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return JWTConfig{
+			ActiveKid: "default",
+			Keys:      []SigningKey{{Kid: "default", Alg: "HS256", Secret: secret}},
+		}, nil
+	}
+
+	return JWTConfig{}, fmt.Errorf("missing JWT signing keys (JWT_KEYS_FILE or JWT_SECRET)")
+}
+
+func readJWTKeysFile(path string) (JWTConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return JWTConfig{}, fmt.Errorf("reading JWT keys file: %w", err)
+	}
+
+	var cfg JWTConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return JWTConfig{}, fmt.Errorf("parsing JWT keys file: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, key := range cfg.Keys {
+		if key.PrivateKeyFile != "" {
+			if cfg.Keys[i].PrivateKeyPEM, err = os.ReadFile(resolvePath(dir, key.PrivateKeyFile)); err != nil {
+				return JWTConfig{}, fmt.Errorf("reading private key of %q: %w", key.Kid, err)
+			}
+		}
+		if key.PublicKeyFile != "" {
+			if cfg.Keys[i].PublicKeyPEM, err = os.ReadFile(resolvePath(dir, key.PublicKeyFile)); err != nil {
+				return JWTConfig{}, fmt.Errorf("reading public key of %q: %w", key.Kid, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"paygo/currency"
+	"slices"
+)
+
+// DefaultKYCTier is the tier of users who haven't been verified further.
+const DefaultKYCTier = "basic"
+
+// Limits caps how much users can move, by KYC tier. Every rule is in an
+// explicit currency: for each transaction the rule of the user's tier and
+// the transaction's type in its currency applies, falling back to the tier's
+// rule for the type in another currency, with amounts converted at the mid
+// rate. Without a rule for the type there is no limit. Per-user limits, set
+// by admins, replace a tier's rules for a type.
+type Limits struct {
+	Rules []LimitRule `json:"rules"`
+}
+
+// LimitRule bounds one transaction type. Volumes are in minor units of
+// Currency and count the user's transactions of the type across all their
+// wallets; daily and monthly windows are the last 24 hours and 30 days. A
+// zero leaves that limit off.
+type LimitRule struct {
+	Tier           string `json:"tier"`
+	Type           string `json:"type"`     // 'payment', 'deposit' or 'withdrawal'
+	Currency       string `json:"currency"` // ISO 4217 code
+	PerTransaction int64  `json:"per_transaction"`
+	DailyVolume    int64  `json:"daily_volume"`
+	MonthlyVolume  int64  `json:"monthly_volume"`
+	DailyCount     int64  `json:"daily_count"`
+	MonthlyCount   int64  `json:"monthly_count"`
+}
+
+// Tiers lists the KYC tiers the rules know about, always including
+// DefaultKYCTier.
+func (l Limits) Tiers() []string {
+	tiers := []string{DefaultKYCTier}
+	for _, rule := range l.Rules {
+		if !slices.Contains(tiers, rule.Tier) {
+			tiers = append(tiers, rule.Tier)
+		}
+	}
+	return tiers
+}
+
+// loadLimits reads LIMITS_FILE. Without it nothing is limited.
+func loadLimits() (Limits, error) {
+	path := os.Getenv("LIMITS_FILE")
+	if path == "" {
+		return Limits{}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Limits{}, fmt.Errorf("reading limits file: %w", err)
+	}
+
+	var limits Limits
+	if err := json.Unmarshal(raw, &limits); err != nil {
+		return Limits{}, fmt.Errorf("parsing limits file: %w", err)
+	}
+	for i, rule := range limits.Rules {
+		if rule.Tier == "" || rule.Currency == "" {
+			return Limits{}, fmt.Errorf("limit rule %d: tier and currency are required", i)
+		}
+		c, err := currency.Lookup(rule.Currency)
+		if err != nil {
+			return Limits{}, fmt.Errorf("limit rule %d: %w", i, err)
+		}
+		limits.Rules[i].Currency = c.Code
+		if !slices.Contains(feeTypes, rule.Type) {
+			return Limits{}, fmt.Errorf("limit rule %d: type must be one of %v", i, feeTypes)
+		}
+		if rule.PerTransaction < 0 || rule.DailyVolume < 0 || rule.MonthlyVolume < 0 ||
+			rule.DailyCount < 0 || rule.MonthlyCount < 0 {
+			return Limits{}, fmt.Errorf("limit rule %d: limits must not be negative", i)
+		}
+	}
+	return limits, nil
+}
@@ -0,0 +1,98 @@
+// Package currency describes the ISO 4217 currencies wallets can hold.
+// Amounts are always integers in the currency's minor unit: cents for USD,
+// yen for JPY (which has none) and fils for KWD (three decimals).
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Default is the currency of a user's first wallet and of requests that don't
+// name one.
+const Default = "USD"
+
+var ErrUnsupported = errors.New("unsupported currency")
+
+type Currency struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	MinorUnits int    `json:"minor_units"` // number of decimals
+}
+
+var supported = map[string]Currency{
+	"USD": {"USD", "US Dollar", 2},
+	"EUR": {"EUR", "Euro", 2},
+	"GBP": {"GBP", "Pound Sterling", 2},
+	"CHF": {"CHF", "Swiss Franc", 2},
+	"CAD": {"CAD", "Canadian Dollar", 2},
+	"AUD": {"AUD", "Australian Dollar", 2},
+	"SEK": {"SEK", "Swedish Krona", 2},
+	"MXN": {"MXN", "Mexican Peso", 2},
+	"BRL": {"BRL", "Brazilian Real", 2},
+	"INR": {"INR", "Indian Rupee", 2},
+	"NGN": {"NGN", "Naira", 2},
+	"JPY": {"JPY", "Yen", 0},
+	"KRW": {"KRW", "Won", 0},
+	"KWD": {"KWD", "Kuwaiti Dinar", 3},
+	"BHD": {"BHD", "Bahraini Dinar", 3},
+}
+
+// Lookup returns the currency for an ISO 4217 code, case-insensitively.
+func Lookup(code string) (Currency, error) {
+	c, ok := supported[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnsupported, code)
+	}
+	return c, nil
+}
+
+// Normalize returns the canonical code for code, or Default when it is empty.
+func Normalize(code string) (string, error) {
+	if code == "" {
+		return Default, nil
+	}
+	c, err := Lookup(code)
+	if err != nil {
+		return "", err
+	}
+	return c.Code, nil
+}
+
+// All returns the supported currencies sorted by code.
+func All() []Currency {
+	all := make([]Currency, 0, len(supported))
+	for _, c := range supported {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Code < all[j].Code })
+	return all
+}
+
+// Format renders an amount in minor units as a decimal string, e.g. 1234 USD
+// as "12.34" and 1234 JPY as "1234".
+func (c Currency) Format(amount int64) string {
+	if c.MinorUnits == 0 {
+		return fmt.Sprint(amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := c.Scale()
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, c.MinorUnits, amount%scale)
+}
+
+// Scale is the number of minor units in one major unit (100 for USD, 1 for
+// JPY).
+func (c Currency) Scale() int64 {
+	scale := int64(1)
+	for range c.MinorUnits {
+		scale *= 10
+	}
+	return scale
+}
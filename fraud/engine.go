@@ -0,0 +1,128 @@
+package fraud
+
+import (
+	"context"
+	"fmt"
+	"paygo/config"
+	"paygo/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Decisions an Engine can reach on a payment.
+const (
+	ActionAllow = "allow"
+	ActionHold  = "hold"
+	ActionBlock = "block"
+)
+
+// Querier is satisfied by both the pool and a transaction.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Candidate is a payment about to be made.
+type Candidate struct {
+	SenderID       uuid.UUID
+	SenderWalletID uuid.UUID
+	ReceiverID     uuid.UUID
+	Amount         int64 // in minor units of Currency
+	Currency       string
+}
+
+type Engine struct {
+	rules config.FraudRules
+}
+
+func NewEngine(rules config.FraudRules) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Evaluate scores the payment against every rule and decides whether it may
+// go through. The signals are read through q, which should be the
+// transaction the payment is made in with the sender's wallet locked, so
+// concurrent payments are scored one after the other.
+func (e *Engine) Evaluate(ctx context.Context, q Querier, p Candidate) (models.FraudDecision, error) {
+	decision := models.FraudDecision{Action: ActionAllow, Rules: []models.TriggeredRule{}}
+
+	for _, rule := range e.rules.Rules {
+		triggered, detail, err := check(ctx, q, rule, p)
+		if err != nil {
+			return models.FraudDecision{}, fmt.Errorf("fraud rule %s: %w", rule.Name, err)
+		}
+		if !triggered {
+			continue
+		}
+		decision.Score += rule.Score
+		decision.Rules = append(decision.Rules, models.TriggeredRule{
+			Name:   rule.Name,
+			Kind:   rule.Kind,
+			Score:  rule.Score,
+			Detail: detail,
+		})
+	}
+
+	switch {
+	case len(decision.Rules) == 0:
+	case decision.Score >= e.rules.BlockScore:
+		decision.Action = ActionBlock
+	case decision.Score >= e.rules.HoldScore:
+		decision.Action = ActionHold
+	}
+	return decision, nil
+}
+
+// check reports whether the payment triggers rule and, if so, why.
+func check(ctx context.Context, q Querier, rule config.FraudRule, p Candidate) (bool, string, error) {
+	window := time.Duration(rule.Window)
+
+	switch rule.Kind {
+	case "velocity":
+		sent, err := countPayments(ctx, q, p.SenderID, window, 0)
+		if err != nil {
+			return false, "", err
+		}
+		return sent+1 > rule.MaxCount, fmt.Sprintf("%d payments within %s", sent+1, window), nil
+
+	case "new_recipient_large_amount":
+		if p.Amount < rule.MinAmount {
+			return false, "", nil
+		}
+		paidBefore, err := hasPaid(ctx, q, p.SenderID, p.ReceiverID)
+		if err != nil {
+			return false, "", err
+		}
+		return !paidBefore, fmt.Sprintf("%d %s to a new recipient", p.Amount, p.Currency), nil
+
+	case "round_amount_burst":
+		if p.Amount%rule.RoundTo != 0 {
+			return false, "", nil
+		}
+		round, err := countPayments(ctx, q, p.SenderID, window, rule.RoundTo)
+		if err != nil {
+			return false, "", err
+		}
+		return round+1 > rule.MaxCount, fmt.Sprintf("%d payments in multiples of %d within %s", round+1, rule.RoundTo, window), nil
+
+	case "deposit_then_send":
+		deposited, err := sumDeposits(ctx, q, p.SenderWalletID, window)
+		if err != nil {
+			return false, "", err
+		}
+		if deposited == 0 {
+			return false, "", nil
+		}
+		ratio := float64(p.Amount) / float64(deposited)
+		return ratio >= rule.MinRatio, fmt.Sprintf("sending %.0f%% of %d %s deposited within %s", ratio*100, deposited, p.Currency, window), nil
+
+	case "distinct_recipients":
+		recipients, err := countRecipients(ctx, q, p.SenderID, p.ReceiverID, window)
+		if err != nil {
+			return false, "", err
+		}
+		return recipients > rule.MaxCount, fmt.Sprintf("%d recipients within %s", recipients, window), nil
+	}
+	return false, "", fmt.Errorf("unknown kind %q", rule.Kind)
+}
@@ -0,0 +1,159 @@
+package fraud
+
+import (
+	"context"
+	"paygo/config"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// signals are what the fake querier answers the signal queries with.
+type signals struct {
+	payments      int64 // payments sent within the window
+	roundPayments int64 // of which in multiples of RoundTo
+	paidBefore    bool
+	deposited     int64
+	recipients    int64 // receiver included
+}
+
+type fakeRow struct {
+	value any
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	switch d := dest[0].(type) {
+	case *int64:
+		*d = r.value.(int64)
+	case *bool:
+		*d = r.value.(bool)
+	}
+	return nil
+}
+
+func (s signals) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "COUNT(DISTINCT receiver_id)"):
+		return fakeRow{s.recipients}
+	case strings.Contains(sql, "EXISTS"):
+		return fakeRow{s.paidBefore}
+	case strings.Contains(sql, "SUM(amount)"):
+		return fakeRow{s.deposited}
+	case args[2].(int64) != 0:
+		return fakeRow{s.roundPayments}
+	}
+	return fakeRow{s.payments}
+}
+
+var testRules = config.FraudRules{
+	HoldScore:  50,
+	BlockScore: 80,
+	Rules: []config.FraudRule{
+		{Name: "burst", Kind: "velocity", Score: 30, Window: config.Duration(time.Hour), MaxCount: 5},
+		{Name: "new_big", Kind: "new_recipient_large_amount", Score: 50, MinAmount: 100_000},
+		{Name: "round", Kind: "round_amount_burst", Score: 20, Window: config.Duration(time.Hour), MaxCount: 2, RoundTo: 10_000},
+		{Name: "cash_out", Kind: "deposit_then_send", Score: 30, Window: config.Duration(24 * time.Hour), MinRatio: 0.9},
+		{Name: "spread", Kind: "distinct_recipients", Score: 40, Window: config.Duration(24 * time.Hour), MaxCount: 3},
+	},
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int64
+		signals   signals
+		wantScore int
+		wantRules []string
+		want      string
+	}{
+		{"nothing triggered", 5_000, signals{payments: 1, paidBefore: true, recipients: 1},
+			0, nil, ActionAllow},
+		{"velocity at its limit", 5_000, signals{payments: 4, paidBefore: true, recipients: 1},
+			0, nil, ActionAllow},
+		{"velocity past its limit stays under hold", 5_000, signals{payments: 5, paidBefore: true, recipients: 1},
+			30, []string{"burst"}, ActionAllow},
+		{"new recipient below the amount", 99_999, signals{recipients: 1},
+			0, nil, ActionAllow},
+		{"new recipient at the amount holds", 100_000, signals{recipients: 1},
+			50, []string{"new_big"}, ActionHold},
+		{"large amount to a known recipient", 100_000, signals{paidBefore: true, recipients: 1},
+			0, nil, ActionAllow},
+		{"round amounts only count when round", 10_001, signals{roundPayments: 5, paidBefore: true, recipients: 1},
+			0, nil, ActionAllow},
+		{"round amount burst", 20_000, signals{roundPayments: 2, paidBefore: true, recipients: 1},
+			20, []string{"round"}, ActionAllow},
+		{"no deposits to cash out", 5_000, signals{paidBefore: true, recipients: 1},
+			0, nil, ActionAllow},
+		{"sending most of a deposit", 9_000, signals{paidBefore: true, deposited: 10_000, recipients: 1},
+			30, []string{"cash_out"}, ActionAllow},
+		{"sending less than the ratio", 8_999, signals{paidBefore: true, deposited: 10_000, recipients: 1},
+			0, nil, ActionAllow},
+		{"scores add up to hold", 9_000, signals{payments: 5, paidBefore: true, deposited: 10_000, recipients: 1},
+			60, []string{"burst", "cash_out"}, ActionHold},
+		{"scores at the block score", 100_000, signals{recipients: 4},
+			90, []string{"new_big", "spread"}, ActionBlock},
+		{"everything", 100_000, signals{payments: 9, roundPayments: 9, deposited: 100_000, recipients: 9},
+			170, []string{"burst", "new_big", "round", "cash_out", "spread"}, ActionBlock},
+	}
+
+	engine := NewEngine(testRules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := engine.Evaluate(context.Background(), tt.signals, Candidate{Amount: tt.amount, Currency: "USD"})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			var names []string
+			for _, rule := range decision.Rules {
+				names = append(names, rule.Name)
+			}
+			if decision.Score != tt.wantScore || decision.Action != tt.want || !slices.Equal(names, tt.wantRules) {
+				t.Errorf("Evaluate = %s with %d from %v, want %s with %d from %v",
+					decision.Action, decision.Score, names, tt.want, tt.wantScore, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		hold       int
+		block      int
+		ruleScore  int
+		sent       int64
+		wantAction string
+	}{
+		{"just under hold", 31, 80, 30, 1, ActionAllow},
+		{"exactly hold", 30, 80, 30, 1, ActionHold},
+		{"exactly block", 10, 30, 30, 1, ActionBlock},
+		{"block wins over hold", 30, 30, 30, 1, ActionBlock},
+		{"zero scores act on a triggered rule", 0, 0, 0, 1, ActionBlock},
+		{"zero scores don't act without a triggered rule", 0, 0, 0, 0, ActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(config.FraudRules{HoldScore: tt.hold, BlockScore: tt.block, Rules: []config.FraudRule{
+				{Name: "burst", Kind: "velocity", Score: tt.ruleScore, Window: config.Duration(time.Hour), MaxCount: 1},
+			}})
+			decision, err := engine.Evaluate(context.Background(), signals{payments: tt.sent}, Candidate{Amount: 1})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if decision.Action != tt.wantAction {
+				t.Errorf("Evaluate = %s with score %d, want %s", decision.Action, decision.Score, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestEvaluateUnknownKind(t *testing.T) {
+	engine := NewEngine(config.FraudRules{Rules: []config.FraudRule{{Name: "odd", Kind: "telepathy"}}})
+	if _, err := engine.Evaluate(context.Background(), signals{}, Candidate{}); err == nil {
+		t.Error("Evaluate with an unknown rule kind succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package fraud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// countPayments counts the payments the sender attempted within window,
+// blocked and held ones included. With roundTo set only amounts that are a
+// multiple of it count.
+func countPayments(ctx context.Context, q Querier, senderId uuid.UUID, window time.Duration, roundTo int64) (count int64, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM payments
+		WHERE sender_id = $1
+			AND created_at > CURRENT_TIMESTAMP - $2::interval
+			AND ($3::bigint = 0 OR amount % $3 = 0)
+	`, senderId, window, roundTo).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count payments: %w", err)
+	}
+	return count, nil
+}
+
+// hasPaid reports whether the sender ever completed a payment to receiver.
+func hasPaid(ctx context.Context, q Querier, senderId, receiverId uuid.UUID) (paid bool, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM payments
+			WHERE sender_id = $1 AND receiver_id = $2
+				AND status IN ('completed', 'partially_refunded', 'refunded')
+		)
+	`, senderId, receiverId).Scan(&paid)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to look up previous payments: %w", err)
+	}
+	return paid, nil
+}
+
+// sumDeposits sums what was deposited into the wallet within window.
+func sumDeposits(ctx context.Context, q Querier, walletId uuid.UUID, window time.Duration) (total int64, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE type = 'deposit' AND status = 'completed' AND to_wallet_id = $1
+			AND created_at > CURRENT_TIMESTAMP - $2::interval
+	`, walletId, window).Scan(&total)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum deposits: %w", err)
+	}
+	return total, nil
+}
+
+// countRecipients counts the different users the sender attempted to pay
+// within window, receiver included.
+func countRecipients(ctx context.Context, q Querier, senderId, receiverId uuid.UUID, window time.Duration) (count int64, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT receiver_id)
+		FROM (
+			SELECT receiver_id FROM payments
+			WHERE sender_id = $1 AND created_at > CURRENT_TIMESTAMP - $3::interval
+			UNION ALL
+			SELECT $2::uuid
+		) recipients
+	`, senderId, receiverId, window).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recipients: %w", err)
+	}
+	return count, nil
+}
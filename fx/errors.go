@@ -0,0 +1,14 @@
+package fx
+
+import "errors"
+
+var (
+	ErrRatesNotConfigured = errors.New("FX rates are not configured")
+	ErrRateUnavailable    = errors.New("FX rate unavailable")
+	ErrUnsupported        = errors.New("Unsupported currency")
+	ErrSameCurrency       = errors.New("Cannot convert a currency into itself")
+	ErrAmountInvalid      = errors.New("Amount must be greater than zero")
+	ErrAmountTooSmall     = errors.New("Amount is too small to convert")
+	ErrAmountTooLarge     = errors.New("Amount is too large to convert")
+	ErrQuoteNotFound      = errors.New("No FX quote found with the ID passed")
+)
@@ -0,0 +1,93 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"paygo/models"
+
+	"github.com/google/uuid"
+)
+
+type FXServiceInterface interface {
+	CreateQuote(ctx context.Context, userId uuid.UUID, req models.FXQuoteRequest) (models.FXQuote, error)
+	GetQuote(ctx context.Context, userId, quoteId uuid.UUID) (models.FXQuote, error)
+}
+
+type FXHandler struct {
+	service FXServiceInterface
+}
+
+func NewFXHandler(s FXServiceInterface) *FXHandler {
+	return &FXHandler{service: s}
+}
+
+// CreateQuote prices a conversion between two currencies. The quote is
+// executed with POST /fx/convert before it expires.
+func (h *FXHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FXQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "failed parsing quote request", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.service.CreateQuote(r.Context(), userId, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupported), errors.Is(err, ErrSameCurrency), errors.Is(err, ErrAmountInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrAmountTooSmall), errors.Is(err, ErrAmountTooLarge):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrRatesNotConfigured), errors.Is(err, ErrRateUnavailable):
+			log.Printf("handler: error pricing fx quote: %v", err)
+			http.Error(w, "Exchange rates are currently unavailable", http.StatusServiceUnavailable)
+		default:
+			log.Printf("handler: error creating fx quote: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(quote); err != nil {
+		log.Printf("handler: error encoding fx quote: %v", err)
+	}
+}
+
+func (h *FXHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	quoteId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid quote UUID format", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.service.GetQuote(r.Context(), userId, quoteId)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrQuoteNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("handler: error fetching fx quote: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,61 @@
+package fx
+
+import (
+	"context"
+	"math/big"
+	"paygo/currency"
+)
+
+// rateDecimals is the precision rates are stored and applied with.
+const rateDecimals = 10
+
+// applySpread takes spreadBps basis points off the mid rate and truncates the
+// result to rateDecimals, so the stored rate reproduces the quoted amount.
+func applySpread(mid *big.Rat, spreadBps int64) *big.Rat {
+	rate := new(big.Rat).Mul(mid, big.NewRat(10_000-spreadBps, 10_000))
+	return truncate(rate, rateDecimals)
+}
+
+// convertAmount turns amount minor units of from into minor units of to at
+// rate, rounding down so the platform never pays out more than quoted.
+func convertAmount(amount int64, rate *big.Rat, from, to currency.Currency) (int64, error) {
+	value := new(big.Rat).Mul(big.NewRat(amount, 1), rate)
+	value.Mul(value, big.NewRat(to.Scale(), from.Scale()))
+	converted := new(big.Int).Quo(value.Num(), value.Denom())
+	if !converted.IsInt64() {
+		return 0, ErrAmountTooLarge
+	}
+	return converted.Int64(), nil
+}
+
+// Convert turns amount minor units of from into to at the mid rate, for
+// comparing amounts across currencies rather than for moving money.
+func Convert(ctx context.Context, rates RateProvider, amount int64, from, to string) (int64, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromCurrency, err := currency.Lookup(from)
+	if err != nil {
+		return 0, err
+	}
+	toCurrency, err := currency.Lookup(to)
+	if err != nil {
+		return 0, err
+	}
+	mid, err := rates.Rate(ctx, fromCurrency.Code, toCurrency.Code)
+	if err != nil {
+		return 0, err
+	}
+	return convertAmount(amount, mid, fromCurrency, toCurrency)
+}
+
+func truncate(r *big.Rat, decimals int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Int).Mul(r.Num(), scale)
+	scaled.Quo(scaled, r.Denom())
+	return new(big.Rat).SetFrac(scaled, scale)
+}
+
+func formatRate(r *big.Rat) string {
+	return r.FloatString(rateDecimals)
+}
@@ -0,0 +1,155 @@
+// Package fx prices conversions between currencies. Mid-market rates come
+// from a RateProvider; a quote locks the rate, less the platform spread, for a
+// short time so the customer knows exactly what they will receive.
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"paygo/config"
+	"time"
+)
+
+// RateProvider returns the mid-market rate between two currencies: how many
+// units of to one unit of from buys.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*big.Rat, error)
+}
+
+// NewRateProvider picks the HTTP provider when a URL is configured, else the
+// static file. Without either every rate lookup fails with
+// ErrRatesNotConfigured.
+func NewRateProvider(cfg config.FXConfig) (RateProvider, error) {
+	switch {
+	case cfg.RatesURL != "":
+		return NewHTTPProvider(cfg.RatesURL), nil
+	case cfg.RatesFile != "":
+		return NewStaticProvider(cfg.RatesFile)
+	default:
+		return unconfiguredProvider{}, nil
+	}
+}
+
+// rateTable is the document both providers read:
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "JPY": 151.3}}
+//
+// Each rate is the units of that currency one unit of base buys. Rates may be
+// JSON numbers or decimal strings.
+type rateTable struct {
+	Base  string                 `json:"base"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// cross derives the from/to rate through the table's base currency.
+func (t rateTable) cross(from, to string) (*big.Rat, error) {
+	fromRate, err := t.lookup(from)
+	if err != nil {
+		return nil, err
+	}
+	toRate, err := t.lookup(to)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+func (t rateTable) lookup(code string) (*big.Rat, error) {
+	if code == t.Base {
+		return big.NewRat(1, 1), nil
+	}
+	raw, ok := t.Rates[code]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRateUnavailable, code)
+	}
+	rate, ok := new(big.Rat).SetString(string(raw))
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: invalid rate %q for %s", ErrRateUnavailable, raw, code)
+	}
+	return rate, nil
+}
+
+// StaticProvider serves rates from a JSON file read once at startup.
+type StaticProvider struct {
+	table rateTable
+}
+
+func NewStaticProvider(path string) (*StaticProvider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading FX rates file: %w", err)
+	}
+
+	var table rateTable
+	if err := json.Unmarshal(raw, &table); err != nil {
+		return nil, fmt.Errorf("parsing FX rates file: %w", err)
+	}
+	if table.Base == "" {
+		return nil, fmt.Errorf("FX rates file has no base currency")
+	}
+	return &StaticProvider{table: table}, nil
+}
+
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	return p.table.cross(from, to)
+}
+
+// HTTPProvider asks a rates service for every quote. The service is called as
+// GET <url>?base=<from>&symbols=<to> and answers with a rate table, so a
+// static file behind any web server is enough to fake it locally.
+type HTTPProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPProvider(url string) *HTTPProvider {
+	return &HTTPProvider{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *HTTPProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	endpoint, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FX rates URL: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("base", from)
+	query.Set("symbols", to)
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("building FX rates request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: rates service answered %s", ErrRateUnavailable, resp.Status)
+	}
+
+	var table rateTable
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		return nil, fmt.Errorf("%w: decoding rates: %v", ErrRateUnavailable, err)
+	}
+	if table.Base == "" {
+		table.Base = from
+	}
+	return table.cross(from, to)
+}
+
+type unconfiguredProvider struct{}
+
+func (unconfiguredProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	return nil, ErrRatesNotConfigured
+}
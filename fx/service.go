@@ -0,0 +1,81 @@
+package fx
+
+import (
+	"context"
+	"fmt"
+	"paygo/config"
+	"paygo/currency"
+	"paygo/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FXStoreInterface interface {
+	InsertQuote(ctx context.Context, quote models.FXQuote, ttl time.Duration) (models.FXQuote, error)
+	GetQuote(ctx context.Context, userId, quoteId uuid.UUID) (models.FXQuote, error)
+}
+
+type FXService struct {
+	store     FXStoreInterface
+	rates     RateProvider
+	quoteTTL  time.Duration
+	spreadBps int64
+}
+
+func NewFXService(store FXStoreInterface, rates RateProvider, cfg config.FXConfig) *FXService {
+	return &FXService{
+		store:     store,
+		rates:     rates,
+		quoteTTL:  cfg.QuoteTTL,
+		spreadBps: cfg.SpreadBps,
+	}
+}
+
+// CreateQuote prices selling req.Amount of one currency for another at the
+// current rate less the spread, and locks that price for the quote TTL.
+func (s *FXService) CreateQuote(ctx context.Context, userId uuid.UUID, req models.FXQuoteRequest) (models.FXQuote, error) {
+	from, err := currency.Lookup(req.FromCurrency)
+	if err != nil {
+		return models.FXQuote{}, fmt.Errorf("%w: %q", ErrUnsupported, req.FromCurrency)
+	}
+	to, err := currency.Lookup(req.ToCurrency)
+	if err != nil {
+		return models.FXQuote{}, fmt.Errorf("%w: %q", ErrUnsupported, req.ToCurrency)
+	}
+	if from.Code == to.Code {
+		return models.FXQuote{}, ErrSameCurrency
+	}
+	if req.Amount <= 0 {
+		return models.FXQuote{}, ErrAmountInvalid
+	}
+
+	mid, err := s.rates.Rate(ctx, from.Code, to.Code)
+	if err != nil {
+		return models.FXQuote{}, fmt.Errorf("service: fetching %s/%s rate: %w", from.Code, to.Code, err)
+	}
+	rate := applySpread(mid, s.spreadBps)
+
+	buy, err := convertAmount(req.Amount, rate, from, to)
+	if err != nil {
+		return models.FXQuote{}, err
+	}
+	if buy <= 0 {
+		return models.FXQuote{}, ErrAmountTooSmall
+	}
+
+	return s.store.InsertQuote(ctx, models.FXQuote{
+		UserID:       userId,
+		FromCurrency: from.Code,
+		ToCurrency:   to.Code,
+		SellAmount:   req.Amount,
+		BuyAmount:    buy,
+		MidRate:      formatRate(mid),
+		SpreadBps:    s.spreadBps,
+		Rate:         formatRate(rate),
+	}, s.quoteTTL)
+}
+
+func (s *FXService) GetQuote(ctx context.Context, userId, quoteId uuid.UUID) (models.FXQuote, error) {
+	return s.store.GetQuote(ctx, userId, quoteId)
+}
@@ -0,0 +1,72 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FXStore struct {
+	db *pgxpool.Pool
+}
+
+func NewFXStore(db *pgxpool.Pool) *FXStore {
+	return &FXStore{db: db}
+}
+
+const quoteColumns = `id, user_id, from_currency, to_currency, sell_amount, buy_amount,
+	mid_rate::TEXT, spread_bps, rate::TEXT, expires_at, used_at, created_at`
+
+func scanQuote(row pgx.Row) (quote models.FXQuote, err error) {
+	err = row.Scan(
+		&quote.ID,
+		&quote.UserID,
+		&quote.FromCurrency,
+		&quote.ToCurrency,
+		&quote.SellAmount,
+		&quote.BuyAmount,
+		&quote.MidRate,
+		&quote.SpreadBps,
+		&quote.Rate,
+		&quote.ExpiresAt,
+		&quote.UsedAt,
+		&quote.CreatedAt,
+	)
+	return quote, err
+}
+
+// InsertQuote stores the quote, which stays valid for ttl.
+func (s *FXStore) InsertQuote(ctx context.Context, quote models.FXQuote, ttl time.Duration) (models.FXQuote, error) {
+	created, err := scanQuote(s.db.QueryRow(ctx, `
+		INSERT INTO fx_quotes (user_id, from_currency, to_currency, sell_amount, buy_amount, mid_rate, spread_bps, rate, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6::NUMERIC, $7, $8::NUMERIC, CURRENT_TIMESTAMP + $9::interval)
+		RETURNING `+quoteColumns,
+		quote.UserID, quote.FromCurrency, quote.ToCurrency, quote.SellAmount, quote.BuyAmount,
+		quote.MidRate, quote.SpreadBps, quote.Rate, ttl,
+	))
+	if err != nil {
+		return models.FXQuote{}, fmt.Errorf("store: failed to insert fx quote: %w", err)
+	}
+	return created, nil
+}
+
+func (s *FXStore) GetQuote(ctx context.Context, userId, quoteId uuid.UUID) (models.FXQuote, error) {
+	quote, err := scanQuote(s.db.QueryRow(ctx, `
+		SELECT `+quoteColumns+`
+		FROM fx_quotes
+		WHERE id = $1 AND user_id = $2
+	`, quoteId, userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.FXQuote{}, ErrQuoteNotFound
+		}
+		return models.FXQuote{}, fmt.Errorf("store: failed to fetch fx quote: %w", err)
+	}
+	return quote, nil
+}
@@ -0,0 +1,23 @@
+package idempotency
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// WithKey attaches the idempotency key of the current request to ctx so the
+// store layer can bind it inside its own transaction.
+func WithKey(ctx context.Context, userId uuid.UUID, key string) context.Context {
+	ctx = context.WithValue(ctx, "idempotency_user_id", userId)
+	return context.WithValue(ctx, "idempotency_key", key)
+}
+
+func FromContext(ctx context.Context) (userId uuid.UUID, key string, ok bool) {
+	userId, ok = ctx.Value("idempotency_user_id").(uuid.UUID)
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	key, ok = ctx.Value("idempotency_key").(string)
+	return userId, key, ok && key != ""
+}
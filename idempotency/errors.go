@@ -0,0 +1,9 @@
+package idempotency
+
+import "errors"
+
+var (
+	ErrKeyReused         = errors.New("idempotency key was already used with a different request payload")
+	ErrRequestInProgress = errors.New("a request with this idempotency key is still being processed")
+	ErrAlreadyProcessed  = errors.New("a request with this idempotency key was already processed")
+)
@@ -0,0 +1,143 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SchedulePrefix starts the keys scheduled payments reserve for their
+// occurrences in the sender's namespace. Clients may not use it, or they
+// could bind a payment of their own to an occurrence before it runs.
+const SchedulePrefix = "schedule:"
+
+// Record is the persisted state of an idempotency key. StatusCode is nil while
+// the first request holding the key has not finished yet.
+type Record struct {
+	UserID      uuid.UUID
+	Key         string
+	RequestHash string
+	ResourceID  *uuid.UUID
+	StatusCode  *int
+	ContentType string
+	Body        []byte
+}
+
+type IdempotencyStore struct {
+	db *pgxpool.Pool
+}
+
+func NewIdempotencyStore(db *pgxpool.Pool) *IdempotencyStore {
+	return &IdempotencyStore{db}
+}
+
+// Begin reserves the key for the caller. acquired is true when the caller now
+// owns the key and must run the request; otherwise the existing record is
+// returned so it can be replayed or rejected. A key whose previous holder died
+// before binding a resource is taken over once its lock is stale.
+func (s *IdempotencyStore) Begin(ctx context.Context, userId uuid.UUID, key, requestHash string) (rec Record, acquired bool, err error) {
+	var ownerHash string
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE SET locked_at = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.status_code IS NULL
+			AND idempotency_keys.resource_id IS NULL
+			AND idempotency_keys.request_hash = EXCLUDED.request_hash
+			AND idempotency_keys.locked_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+		RETURNING request_hash
+	`, userId, key, requestHash).Scan(&ownerHash)
+
+	if err == nil {
+		return Record{UserID: userId, Key: key, RequestHash: ownerHash}, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Record{}, false, fmt.Errorf("store: failed to reserve idempotency key: %w", err)
+	}
+
+	rec, err = s.Get(ctx, userId, key)
+	if err != nil {
+		return Record{}, false, err
+	}
+	return rec, false, nil
+}
+
+func (s *IdempotencyStore) Get(ctx context.Context, userId uuid.UUID, key string) (rec Record, err error) {
+	var contentType *string
+	err = s.db.QueryRow(ctx, `
+		SELECT user_id, key, request_hash, resource_id, status_code, response_content_type, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, userId, key).Scan(
+		&rec.UserID,
+		&rec.Key,
+		&rec.RequestHash,
+		&rec.ResourceID,
+		&rec.StatusCode,
+		&contentType,
+		&rec.Body,
+	)
+	if err != nil {
+		return Record{}, fmt.Errorf("store: failed to fetch idempotency key: %w", err)
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+	return rec, nil
+}
+
+// Complete persists the response of the request holding the key so replays
+// can return it verbatim.
+func (s *IdempotencyStore) Complete(ctx context.Context, userId uuid.UUID, key string, statusCode int, contentType string, body []byte) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $3, response_content_type = $4, response_body = $5, completed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND key = $2
+	`, userId, key, statusCode, contentType, body)
+	if err != nil {
+		return fmt.Errorf("store: failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release frees a key whose request failed before moving any money, so the
+// client can retry with the same key. It reports false when a resource was
+// already bound to the key, in which case the key must be completed instead.
+func (s *IdempotencyStore) Release(ctx context.Context, userId uuid.UUID, key string) (released bool, err error) {
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND resource_id IS NULL
+	`, userId, key)
+	if err != nil {
+		return false, fmt.Errorf("store: failed to release idempotency key: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// BindTx marks the idempotency key carried by ctx as having produced
+// resourceId. It must be called inside the same pgx transaction that moves
+// the money: if another request already bound the key, ErrAlreadyProcessed is
+// returned and the caller rolls back. Without a key in ctx it is a no-op.
+func BindTx(ctx context.Context, tx pgx.Tx, resourceId uuid.UUID) error {
+	userId, key, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET resource_id = $3
+		WHERE user_id = $1 AND key = $2 AND resource_id IS NULL
+	`, userId, key, resourceId)
+	if err != nil {
+		return fmt.Errorf("failed to bind idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyProcessed
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package ledger
+
+import "errors"
+
+var (
+	ErrUnbalancedEntry = errors.New("journal entry postings must be non-zero and sum to zero in each currency")
+	ErrUnknownAccount  = errors.New("unknown ledger account")
+)
@@ -0,0 +1,199 @@
+// Package ledger records every money movement as a balanced double-entry
+// journal entry. Posting amounts are signed from the account holder's point of
+// view: positive amounts credit the account, negative amounts debit it, and
+// the postings of an entry always sum to zero in each currency. Every account
+// holds a single currency. wallets.balance is a cached projection of the
+// postings on the wallet's account and is only ever changed through Record.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// System accounts hold the other side of movements that enter or leave the
+// platform. There is one per currency, opened on its first posting.
+const (
+	AccountDeposits       = "system:deposits"
+	AccountWithdrawals    = "system:withdrawals"
+	AccountPayoutsPending = "system:payouts_pending"
+	// AccountHolds keeps the funds of payments held for review until they
+	// are released to the receiver or returned to the sender.
+	AccountHolds = "system:holds"
+	// AccountFX is the platform's position in each currency: it receives
+	// what customers sell and pays out what they buy.
+	AccountFX = "system:fx"
+	// AccountRevenue collects the fees the platform charges.
+	AccountRevenue = "system:revenue"
+	// AccountSuspense keeps funds that can't go back to their owner, such as
+	// a rejected payment whose sender has since closed their account, until
+	// they are dealt with by hand.
+	AccountSuspense = "system:suspense"
+)
+
+var systemAccounts = map[string]bool{
+	AccountDeposits:       true,
+	AccountWithdrawals:    true,
+	AccountPayoutsPending: true,
+	AccountHolds:          true,
+	AccountFX:             true,
+	AccountRevenue:        true,
+	AccountSuspense:       true,
+}
+
+type Posting struct {
+	WalletID uuid.UUID // wallet account to post to, or uuid.Nil for a system account
+	Account  string    // system account code, used when WalletID is uuid.Nil
+	Currency string    // currency of the system account; wallets have their own
+	Amount   int64     // in minor units, positive credits and negative debits the account
+}
+
+type Entry struct {
+	TransactionID uuid.UUID
+	Description   string
+	Postings      []Posting
+}
+
+func WalletPosting(walletId uuid.UUID, amount int64) Posting {
+	return Posting{WalletID: walletId, Amount: amount}
+}
+
+func SystemPosting(account, currency string, amount int64) Posting {
+	return Posting{Account: account, Currency: currency, Amount: amount}
+}
+
+// Transfer builds the two postings moving amount from one wallet to another.
+// Both wallets must hold the same currency.
+func Transfer(fromWalletId, toWalletId uuid.UUID, amount int64) []Posting {
+	return []Posting{
+		WalletPosting(fromWalletId, -amount),
+		WalletPosting(toWalletId, amount),
+	}
+}
+
+// Record writes the journal entry and its postings inside tx and updates the
+// balance projection of every wallet it touches. Callers are expected to have
+// locked the wallets involved. The database re-checks that the entry balances
+// in every currency when tx commits.
+func Record(ctx context.Context, tx pgx.Tx, entry Entry) (entryId uuid.UUID, err error) {
+	if err := validate(entry); err != nil {
+		return uuid.Nil, err
+	}
+
+	accounts := make([]account, len(entry.Postings))
+	sums := map[string]int64{}
+	for i, posting := range entry.Postings {
+		accounts[i], err = resolveAccount(ctx, tx, posting)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		sums[accounts[i].currency] += posting.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return uuid.Nil, fmt.Errorf("%w: %s is off by %d", ErrUnbalancedEntry, currency, sum)
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO journal_entries (transaction_id, description)
+		VALUES ($1, $2)
+		RETURNING id
+	`, entry.TransactionID, entry.Description).Scan(&entryId)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("ledger: failed to create journal entry: %w", err)
+	}
+
+	for i, posting := range entry.Postings {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO postings (journal_entry_id, account_id, currency, amount)
+			VALUES ($1, $2, $3, $4)
+		`, entryId, accounts[i].id, accounts[i].currency, posting.Amount)
+
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("ledger: failed to insert posting: %w", err)
+		}
+
+		if posting.WalletID == uuid.Nil {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE wallets SET balance = balance + $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, posting.Amount, posting.WalletID)
+
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("ledger: failed to update wallet balance: %w", err)
+		}
+	}
+
+	return entryId, nil
+}
+
+func validate(entry Entry) error {
+	if len(entry.Postings) < 2 {
+		return ErrUnbalancedEntry
+	}
+
+	for _, posting := range entry.Postings {
+		if posting.Amount == 0 {
+			return ErrUnbalancedEntry
+		}
+		if posting.WalletID == uuid.Nil && (!systemAccounts[posting.Account] || posting.Currency == "") {
+			return fmt.Errorf("%w: %s %s", ErrUnknownAccount, posting.Account, posting.Currency)
+		}
+	}
+	return nil
+}
+
+type account struct {
+	id       uuid.UUID
+	currency string
+}
+
+func resolveAccount(ctx context.Context, tx pgx.Tx, posting Posting) (acc account, err error) {
+	if posting.WalletID != uuid.Nil {
+		// Wallet accounts are opened lazily on their first posting, in the
+		// wallet's currency.
+		err = tx.QueryRow(ctx, `
+			INSERT INTO ledger_accounts (wallet_id, currency)
+			SELECT id, currency FROM wallets WHERE id = $1
+			ON CONFLICT (wallet_id) DO UPDATE SET wallet_id = EXCLUDED.wallet_id
+			RETURNING id, currency
+		`, posting.WalletID).Scan(&acc.id, &acc.currency)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return account{}, fmt.Errorf("%w: wallet %s", ErrUnknownAccount, posting.WalletID)
+			}
+			return account{}, fmt.Errorf("ledger: failed to resolve wallet account: %w", err)
+		}
+		return acc, nil
+	}
+
+	// System accounts are posted to by every transaction of their kind, so
+	// an open one is only read: upserting it would lock its row until tx ends
+	// and make those transactions take turns.
+	err = tx.QueryRow(ctx, `
+		SELECT id, currency FROM ledger_accounts WHERE code = $1 AND currency = $2
+	`, posting.Account, posting.Currency).Scan(&acc.id, &acc.currency)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO ledger_accounts (code, currency)
+			VALUES ($1, $2)
+			ON CONFLICT (code, currency) DO UPDATE SET code = EXCLUDED.code
+			RETURNING id, currency
+		`, posting.Account, posting.Currency).Scan(&acc.id, &acc.currency)
+	}
+	if err != nil {
+		return account{}, fmt.Errorf("ledger: failed to resolve system account: %w", err)
+	}
+	return acc, nil
+}
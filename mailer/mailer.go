@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+	"paygo/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New picks the mailer from config: SMTP when a server is configured, files in
+// an outbox directory for local development, and the log otherwise.
+func New(cfg config.MailConfig) Mailer {
+	switch {
+	case cfg.SMTPAddr != "":
+		return NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case cfg.OutboxDir != "":
+		return NewFileMailer(cfg.OutboxDir, cfg.From)
+	default:
+		return NewLogMailer(cfg.From)
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"paygo/aml"
 	"paygo/config"
+	database "paygo/db"
 	"paygo/md"
+	"paygo/reconcile"
+	"paygo/roles"
 	"paygo/routes"
 	"syscall"
 	"time"
@@ -20,8 +25,22 @@ func main() {
 
 	config := config.LoadConfig()
 
+	if len(os.Args) > 1 {
+		runCommand(ctx, config, os.Args[1])
+		return
+	}
+
 	mux := http.NewServeMux()
-	mux = routes.CreateRouter(ctx, mux, config)
+	mux, services := routes.CreateRouter(ctx, mux, config)
+
+	schedulerCtx, stopScheduler := context.WithCancel(ctx)
+	jobsStopped := []<-chan struct{}{
+		services.Payments.StartScheduler(schedulerCtx, config.Schedules.PollInterval),
+		services.Payments.StartWithdrawalRecovery(schedulerCtx, config.Withdrawals.RecoveryInterval),
+		services.Payments.StartReviewExpiry(schedulerCtx, config.Review.ExpiryInterval),
+		services.Reconcile.StartScheduler(schedulerCtx, config.ReconcileInterval),
+		services.AML.StartScheduler(schedulerCtx, config.AML.ScanInterval),
+	}
 
 	wrappedMux := md.LoggingMiddleware(mux)
 
@@ -42,6 +61,14 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+
+	// Let a scheduled payment, withdrawal settlement, review expiry,
+	// reconciliation or AML scan in flight finish before the process exits.
+	stopScheduler()
+	for _, stopped := range jobsStopped {
+		<-stopped
+	}
+
 	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer shutdownCancel()
 
@@ -51,3 +78,53 @@ func main() {
 
 	log.Println("Server gracefully stopped")
 }
+
+// runCommand executes a one-off CLI command instead of starting the server,
+// e.g. `paygo reconcile`, `paygo aml-scan` or `paygo grant-role admin@example.com admin`.
+func runCommand(ctx context.Context, config config.Config, command string) {
+	switch command {
+	case "grant-role":
+		if len(os.Args) != 4 {
+			log.Fatalf("Usage: %s grant-role <email> <role>", os.Args[0])
+		}
+		db := database.Connect(ctx, config.DatabaseURL)
+		defer db.Close()
+
+		err := roles.NewRoleService(roles.NewRoleStore(db)).GrantRoleByEmail(ctx, os.Args[2], os.Args[3])
+		if err != nil {
+			log.Fatalf("Granting role failed: %v", err)
+		}
+		log.Printf("Granted role %s to %s", os.Args[3], os.Args[2])
+	case "reconcile":
+		db := database.Connect(ctx, config.DatabaseURL)
+		defer db.Close()
+
+		report, err := reconcile.NewReconcileService(reconcile.NewReconcileStore(db)).Run(ctx)
+		if err != nil {
+			log.Fatalf("Reconciliation failed: %v", err)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+
+		if len(report.Mismatches) > 0 || report.LedgerImbalance != 0 {
+			db.Close()
+			os.Exit(2)
+		}
+	case "aml-scan":
+		db := database.Connect(ctx, config.DatabaseURL)
+		defer db.Close()
+
+		report, err := aml.NewAMLService(aml.NewAMLStore(db), config.AML).Scan(ctx)
+		if err != nil {
+			log.Fatalf("AML scan failed: %v", err)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	default:
+		log.Fatalf("Unknown command %q (available: reconcile, aml-scan, grant-role)", command)
+	}
+}
@@ -0,0 +1,144 @@
+package md
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"paygo/idempotency"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const maxIdempotentBodySize = 1 << 20
+
+type IdempotencyStoreInterface interface {
+	Begin(ctx context.Context, userId uuid.UUID, key, requestHash string) (idempotency.Record, bool, error)
+	Complete(ctx context.Context, userId uuid.UUID, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, userId uuid.UUID, key string) (bool, error)
+}
+
+// IdempotencyMiddleware honors the Idempotency-Key header on money-moving
+// endpoints. The first request's response is persisted; replays with the same
+// payload get the stored response back and a different payload under the same
+// key is rejected with 422. It must be wrapped by AuthMiddleware since keys are
+// scoped per user.
+func IdempotencyMiddleware(store IdempotencyStoreInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+			if strings.HasPrefix(key, idempotency.SchedulePrefix) {
+				http.Error(w, "Idempotency-Key must not start with "+idempotency.SchedulePrefix, http.StatusBadRequest)
+				return
+			}
+
+			userId, ok := r.Context().Value("user_id").(uuid.UUID)
+			if !ok {
+				http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+			hash.Write(body)
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			rec, acquired, err := store.Begin(r.Context(), userId, key, requestHash)
+			if err != nil {
+				log.Printf("idempotency: error reserving key: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if !acquired {
+				switch {
+				case rec.RequestHash != requestHash:
+					http.Error(w, idempotency.ErrKeyReused.Error(), http.StatusUnprocessableEntity)
+				case rec.StatusCode == nil:
+					http.Error(w, idempotency.ErrRequestInProgress.Error(), http.StatusConflict)
+				default:
+					if rec.ContentType != "" {
+						w.Header().Set("Content-Type", rec.ContentType)
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(*rec.StatusCode)
+					w.Write(rec.Body)
+				}
+				return
+			}
+
+			recorder := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(idempotency.WithKey(r.Context(), userId, key)))
+
+			// Server errors are not persisted unless money already moved, so
+			// the client can safely retry them with the same key. Neither are
+			// authentication failures, so a step-up challenge can be answered
+			// by resending the request with a code, nor exhausted limits,
+			// which may allow the request again later.
+			if recorder.statusCode >= http.StatusInternalServerError ||
+				recorder.statusCode == http.StatusUnauthorized || recorder.statusCode == http.StatusForbidden ||
+				recorder.statusCode == http.StatusTooManyRequests {
+				released, err := store.Release(context.WithoutCancel(r.Context()), userId, key)
+				if err != nil {
+					log.Printf("idempotency: error releasing key: %v", err)
+				}
+				if released || err != nil {
+					return
+				}
+			}
+
+			err = store.Complete(
+				context.WithoutCancel(r.Context()),
+				userId,
+				key,
+				recorder.statusCode,
+				recorder.Header().Get("Content-Type"),
+				recorder.body.Bytes(),
+			)
+			if err != nil {
+				log.Printf("idempotency: error storing response: %v", err)
+			}
+		})
+	}
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"paygo/auth"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,17 +20,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		authToken := authHeader[len("Bearer "):]
-		if authToken == "" {
+		authToken, found := strings.CutPrefix(authHeader, "Bearer ")
+		if !found || authToken == "" {
 			http.Error(w, "Empty Token", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := auth.ValidateToken(authToken)
+		token, err := auth.ValidateToken(r.Context(), authToken)
 
 		if err != nil {
 			log.Printf("Token validation error: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
@@ -39,13 +41,35 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		ctx := context.WithValue(r.Context(), "user_id", userId)
-		ctx = context.WithValue(r.Context(), "username", token.Username)
+		ctx = context.WithValue(ctx, "username", token.Username)
+		ctx = context.WithValue(ctx, "permissions", token.Permissions)
+		ctx = context.WithValue(ctx, "token_id", token.Id)
+		ctx = context.WithValue(ctx, "token_expires_at", time.Unix(token.ExpiresAt, 0))
 
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequirePermission only lets through requests whose token carries the
+// given permission. It must be wrapped by AuthMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r.Context(), permission) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func HasPermission(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value("permissions").([]string)
+	return slices.Contains(permissions, permission)
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
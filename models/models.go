@@ -13,19 +13,24 @@ type CreateUser struct {
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Exclude from JSON for security
-	CreatedAt    time.Time `json:"created_at"`
-	Wallet       Wallet    `json:"wallet,omitzero"`
+	ID              uuid.UUID  `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"` // Exclude from JSON for security
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Status          string     `json:"status,omitempty"` // 'active', 'frozen' or 'closed'
+	StatusReason    *string    `json:"status_reason,omitempty"`
+	KYCTier         string     `json:"kyc_tier,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Wallets         []Wallet   `json:"wallets,omitempty"`
 }
 
 type Wallet struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id,omitzero"`
-	Balance   int64     `json:"balance"` // in cents
+	Balance   int64     `json:"balance"` // in minor units
 	Currency  string    `json:"currency"`
+	Status    string    `json:"status,omitempty"` // 'active', 'frozen' or 'closed'
 	UpdatedAt time.Time `json:"last_transaction"`
 }
 
@@ -33,7 +38,8 @@ type Transaction struct {
 	ID           uuid.UUID  `json:"id"`
 	FromWalletID *uuid.UUID `json:"from_wallet_id,omitempty"` // Nullable field
 	ToWalletID   *uuid.UUID `json:"to_wallet_id,omitempty"`   // Nullable field
-	Amount       int64      `json:"amount"`                   // in cents
+	Amount       int64      `json:"amount"`                   // in minor units
+	Currency     string     `json:"currency"`                 // ISO 4217 code
 	Status       string     `json:"status"`                   // 'pending', 'completed', etc
 	Type         string     `json:"type"`                     // 'payment', 'refund', 'adjustment'
 	ReferenceID  *uuid.UUID `json:"reference_id,omitempty"`   // Nullable field
@@ -44,22 +50,36 @@ type Transaction struct {
 type Payment struct {
 	ID uuid.UUID `json:"id"`
 	PaymentInsert
-	TransactionID *uuid.UUID `json:"transaction_id,omitempty"` // Nullable field
-	CreatedAt     time.Time  `json:"created_at"`
+	TransactionID *uuid.UUID    `json:"transaction_id,omitempty"` // Nullable field
+	CreatedAt     time.Time     `json:"created_at"`
+	Fees          *FeeBreakdown `json:"fees,omitempty"` // only when the payment is created
 }
 
 type PaymentInsert struct {
 	SenderID   uuid.UUID `json:"sender_id"`
 	ReceiverID uuid.UUID `json:"receiver_id"`
-	Amount     int64     `json:"amount"`
+	Amount     int64     `json:"amount"`   // in minor units of Currency
+	Currency   string    `json:"currency"` // defaults to USD
 	Status     string    `json:"status"`
 	Note       string    `json:"note"`
+
+	Fee int64 `json:"-"` // charged to the sender on top of Amount
 }
 
 type DepositInsert struct {
 	UserID    uuid.UUID `json:"user_id"`
-	Amount    int64     `json:"amount"`
+	Amount    int64     `json:"amount"`   // in minor units of Currency
+	Currency  string    `json:"currency"` // defaults to USD
 	CreatedAt time.Time `json:"created_at"`
+	Fee       int64     `json:"-"` // deducted from Amount before crediting the wallet
+}
+
+type Deposit struct {
+	TransactionID uuid.UUID     `json:"transaction_id"`
+	UserID        uuid.UUID     `json:"user_id"`
+	Amount        int64         `json:"amount"` // in minor units of Currency
+	Currency      string        `json:"currency"`
+	Fees          *FeeBreakdown `json:"fees"`
 }
 
 type PaymentWithNames struct {
@@ -67,3 +87,377 @@ type PaymentWithNames struct {
 	SenderName   string `json:"sender_name"`
 	ReceiverName string `json:"receiver_name"`
 }
+
+type WithdrawalInsert struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Amount      int64     `json:"amount"`   // in minor units of Currency
+	Currency    string    `json:"currency"` // defaults to USD
+	Destination string    `json:"destination"`
+	Fee         int64     `json:"-"` // charged on top of Amount, returned if the payout fails
+}
+
+type Withdrawal struct {
+	ID              uuid.UUID     `json:"id"` // the withdrawal transaction ID
+	UserID          uuid.UUID     `json:"user_id"`
+	WalletID        uuid.UUID     `json:"wallet_id"`
+	Amount          int64         `json:"amount"` // in minor units
+	Currency        string        `json:"currency"`
+	Destination     string        `json:"destination"`
+	Status          string        `json:"status"` // 'pending', 'completed', 'failed'
+	PayoutReference *string       `json:"payout_reference,omitempty"`
+	FailureReason   *string       `json:"failure_reason,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	Fees            *FeeBreakdown `json:"fees,omitempty"` // only when the withdrawal is created
+}
+
+type RefundInsert struct {
+	PaymentID   uuid.UUID `json:"-"`
+	RequesterID uuid.UUID `json:"-"`
+	Amount      int64     `json:"amount"` // in minor units, 0 refunds whatever is left
+}
+
+type Refund struct {
+	ID            uuid.UUID `json:"id"` // the refund transaction ID
+	PaymentID     uuid.UUID `json:"payment_id"`
+	ReferenceID   uuid.UUID `json:"reference_id"` // the refunded payment transaction
+	Amount        int64     `json:"amount"`       // in minor units
+	Currency      string    `json:"currency"`
+	RefundedTotal int64     `json:"refunded_total"`
+	PaymentStatus string    `json:"payment_status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type BalanceMismatch struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Expected int64     `json:"expected"` // recomputed from transactions, in minor units
+	Actual   int64     `json:"actual"`   // wallets.balance, in minor units
+	Drift    int64     `json:"drift"`    // actual - expected
+}
+
+type ReconciliationReport struct {
+	StartedAt       time.Time         `json:"started_at"`
+	FinishedAt      time.Time         `json:"finished_at"`
+	WalletsChecked  int               `json:"wallets_checked"`
+	LedgerImbalance int64             `json:"ledger_imbalance"` // sum of all postings, must be 0
+	Mismatches      []BalanceMismatch `json:"mismatches"`
+}
+
+type PaymentCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// PaymentFilter narrows payment listings. Zero values mean "no filter".
+type PaymentFilter struct {
+	Limit          int
+	Cursor         *PaymentCursor
+	From           *time.Time
+	To             *time.Time
+	Status         string
+	Currency       string
+	Direction      string // 'sent' or 'received', only for a user's own history
+	CounterpartyID uuid.UUID
+	MinAmount      *int64
+	MaxAmount      *int64
+}
+
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleAuditEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	ActorID      *uuid.UUID `json:"actor_id,omitempty"` // nil when changed from the CLI
+	TargetUserID uuid.UUID  `json:"target_user_id"`
+	Role         string     `json:"role"`
+	Action       string     `json:"action"` // 'grant' or 'revoke'
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// StatusChange freezes, unfreezes or closes a user or a wallet.
+type StatusChange struct {
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason"`
+	BlockIncoming bool       `json:"block_incoming"` // frozen accounts refuse incoming funds too
+	ActorID       *uuid.UUID `json:"-"`
+	Compliance    bool       `json:"-"` // the actor may review screening hits
+}
+
+type StatusLogEntry struct {
+	ID            int64      `json:"id"`
+	SubjectType   string     `json:"subject_type"` // 'user' or 'wallet'
+	SubjectID     uuid.UUID  `json:"subject_id"`
+	OldStatus     string     `json:"old_status"`
+	NewStatus     string     `json:"new_status"`
+	Reason        string     `json:"reason"`
+	BlockIncoming bool       `json:"block_incoming"`
+	ActorID       *uuid.UUID `json:"actor_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type BlockedAttempt struct {
+	ID        int64     `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	WalletID  uuid.UUID `json:"wallet_id"`
+	Action    string    `json:"action"`
+	Amount    int64     `json:"amount"` // in minor units
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FXQuote locks the rate of a conversion for one user until ExpiresAt. Rates
+// are decimal strings giving the units of ToCurrency one unit of FromCurrency
+// buys.
+type FXQuote struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	FromCurrency string     `json:"from_currency"`
+	ToCurrency   string     `json:"to_currency"`
+	SellAmount   int64      `json:"sell_amount"` // in minor units of FromCurrency
+	BuyAmount    int64      `json:"buy_amount"`  // in minor units of ToCurrency
+	MidRate      string     `json:"mid_rate"`
+	SpreadBps    int64      `json:"spread_bps"`
+	Rate         string     `json:"rate"` // MidRate less the spread
+	ExpiresAt    time.Time  `json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type FXQuoteRequest struct {
+	FromCurrency string `json:"from_currency"`
+	ToCurrency   string `json:"to_currency"`
+	Amount       int64  `json:"amount"` // to sell, in minor units of FromCurrency
+}
+
+// Conversion is an executed FX quote. The sell leg debits the wallet in
+// FromCurrency and the buy leg credits the wallet in ToCurrency.
+type Conversion struct {
+	QuoteID           uuid.UUID `json:"quote_id"`
+	SellTransactionID uuid.UUID `json:"sell_transaction_id"`
+	BuyTransactionID  uuid.UUID `json:"buy_transaction_id"`
+	FromCurrency      string    `json:"from_currency"`
+	ToCurrency        string    `json:"to_currency"`
+	SellAmount        int64     `json:"sell_amount"`
+	BuyAmount         int64     `json:"buy_amount"`
+	Rate              string    `json:"rate"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// FeeBreakdown prices a transaction. Total is what the payer's wallet is
+// debited, or for deposits what the wallet is credited.
+type FeeBreakdown struct {
+	Type       string         `json:"type"` // 'payment', 'deposit' or 'withdrawal'
+	Currency   string         `json:"currency"`
+	Amount     int64          `json:"amount"` // in minor units
+	Fee        int64          `json:"fee"`
+	Total      int64          `json:"total"`
+	Components []FeeComponent `json:"components"` // sum to Fee
+}
+
+type FeeComponent struct {
+	Name   string `json:"name"` // 'flat', 'percentage', 'minimum' or 'maximum'
+	Amount int64  `json:"amount"`
+}
+
+type FeeQuoteRequest struct {
+	Type     string `json:"type"` // defaults to 'payment'
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+// LimitStatus is a user's limit on one transaction type, in minor units of
+// Currency. Limits that are off are left out.
+type LimitStatus struct {
+	Type           string     `json:"type"` // 'payment', 'deposit' or 'withdrawal'
+	Currency       string     `json:"currency"`
+	Tier           string     `json:"tier"`
+	Override       bool       `json:"override,omitempty"`        // set for the user rather than by their tier
+	PerTransaction int64      `json:"per_transaction,omitempty"` // in minor units
+	DailyVolume    *Allowance `json:"daily_volume,omitempty"`
+	DailyCount     *Allowance `json:"daily_count,omitempty"`
+	MonthlyVolume  *Allowance `json:"monthly_volume,omitempty"`
+	MonthlyCount   *Allowance `json:"monthly_count,omitempty"`
+}
+
+// Allowance is a rolling limit: the last 24 hours for daily limits and the
+// last 30 days for monthly ones.
+type Allowance struct {
+	Limit     int64 `json:"limit"`
+	Used      int64 `json:"used"`
+	Remaining int64 `json:"remaining"`
+}
+
+// LimitOverride is a limit an admin set for one user. A user's overrides for
+// a transaction type replace their KYC tier's rules for it. Amounts are in
+// minor units of Currency; a zero leaves that limit off.
+type LimitOverride struct {
+	Type           string     `json:"type"` // 'payment', 'deposit' or 'withdrawal'
+	Currency       string     `json:"currency"`
+	PerTransaction int64      `json:"per_transaction"`
+	DailyVolume    int64      `json:"daily_volume"`
+	MonthlyVolume  int64      `json:"monthly_volume"`
+	DailyCount     int64      `json:"daily_count"`
+	MonthlyCount   int64      `json:"monthly_count"`
+	ActorID        *uuid.UUID `json:"actor_id,omitempty"` // who set it
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// FraudDecision is what the fraud rules made of a payment. Score adds up the
+// scores of the rules it triggered.
+type FraudDecision struct {
+	PaymentID  uuid.UUID       `json:"payment_id"`
+	Action     string          `json:"action"` // 'allow', 'hold' or 'block'
+	Score      int             `json:"score"`
+	Rules      []TriggeredRule `json:"rules"`
+	Review     *string         `json:"review,omitempty"` // 'approved', 'rejected' or 'expired' once a hold is reviewed
+	ReviewedAt *time.Time      `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type TriggeredRule struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Score  int    `json:"score"`
+	Detail string `json:"detail"`
+}
+
+// PaymentReview is a payment the fraud rules held, with where its review
+// stands. Status is the payment's: 'held' until a reviewer claims it,
+// 'in_review' until they decide, then 'completed' or 'failed'.
+type PaymentReview struct {
+	PaymentID  uuid.UUID  `json:"payment_id"`
+	SenderID   uuid.UUID  `json:"sender_id"`
+	ReceiverID uuid.UUID  `json:"receiver_id"`
+	Amount     int64      `json:"amount"` // in minor units of Currency
+	Currency   string     `json:"currency"`
+	Status     string     `json:"status"`
+	FraudScore int        `json:"fraud_score"`
+	DueAt      time.Time  `json:"due_at"` // the review expires and the funds are returned after this
+	ClaimedBy  *uuid.UUID `json:"claimed_by,omitempty"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	Decision   *string    `json:"decision,omitempty"` // 'approved', 'rejected' or 'expired'
+	Reason     *string    `json:"reason,omitempty"`
+	DecidedBy  *uuid.UUID `json:"decided_by,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ReviewDecision struct {
+	Reason string `json:"reason"` // required to reject
+}
+
+// ScreeningHit is a user whose name resembled a watchlist entry when they
+// registered or were paid. Pending hits block the user until compliance
+// clears them or confirms the match.
+type ScreeningHit struct {
+	ID           int64      `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Context      string     `json:"context"`                // 'registration' or 'payment'
+	InitiatorID  *uuid.UUID `json:"initiator_id,omitempty"` // who tried to pay the user
+	ScreenedName string     `json:"screened_name"`
+	EntryUID     string     `json:"entry_uid"`
+	ListedName   string     `json:"listed_name"`
+	Programs     string     `json:"programs"`
+	Score        float64    `json:"score"`
+	Status       string     `json:"status"` // 'pending', 'cleared' or 'confirmed'
+	ReviewedBy   *uuid.UUID `json:"reviewed_by,omitempty"`
+	ReviewNote   *string    `json:"review_note,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type ScreeningReview struct {
+	Note string `json:"note"`
+}
+
+// AMLCase is suspicious activity the AML scan found on a wallet. Status is
+// 'open' until compliance escalates or closes it; a closed case records
+// whether it was reported to the authorities or needed no action.
+type AMLCase struct {
+	ID               int64      `json:"id"`
+	Pattern          string     `json:"pattern"` // 'structuring', 'fan_in', 'fan_out' or 'circular'
+	WalletID         uuid.UUID  `json:"wallet_id"`
+	UserID           uuid.UUID  `json:"user_id"` // the wallet's owner
+	Summary          string     `json:"summary"`
+	TotalAmount      int64      `json:"total_amount"` // of the linked transactions, in minor units of Currency
+	Currency         string     `json:"currency"`
+	TransactionCount int        `json:"transaction_count"`
+	Status           string     `json:"status"`               // 'open', 'escalated' or 'closed'
+	Resolution       *string    `json:"resolution,omitempty"` // 'reported' or 'no_action'
+	EscalatedBy      *uuid.UUID `json:"escalated_by,omitempty"`
+	EscalatedAt      *time.Time `json:"escalated_at,omitempty"`
+	ClosedBy         *uuid.UUID `json:"closed_by,omitempty"`
+	ClosedAt         *time.Time `json:"closed_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// AMLCaseDetail is a case with the transactions that triggered it and its
+// history.
+type AMLCaseDetail struct {
+	AMLCase
+	Transactions []Transaction  `json:"transactions"`
+	Events       []AMLCaseEvent `json:"events"`
+}
+
+type AMLCaseEvent struct {
+	ID        int64      `json:"id"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"` // unset for the scan
+	Action    string     `json:"action"`             // 'opened', 'updated', 'note', 'escalated' or 'closed'
+	Note      string     `json:"note"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type AMLCaseAction struct {
+	Note       string `json:"note"`
+	Resolution string `json:"resolution"` // to close: 'reported' or 'no_action'
+}
+
+type AMLScanReport struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Transactions int       `json:"transactions"` // scanned
+	Findings     int       `json:"findings"`
+	CasesOpened  int       `json:"cases_opened"`
+	CasesUpdated int       `json:"cases_updated"`
+}
+
+// ScheduledPaymentInsert is a payment to make later, once or on a recurrence.
+// A recurring schedule ends after EndAt or MaxRuns occurrences, whichever
+// comes first, or runs until cancelled without either.
+type ScheduledPaymentInsert struct {
+	SenderID   uuid.UUID  `json:"sender_id"`
+	ReceiverID uuid.UUID  `json:"receiver_id"`
+	Amount     int64      `json:"amount"`   // in minor units of Currency
+	Currency   string     `json:"currency"` // defaults to USD
+	Note       string     `json:"note"`
+	Frequency  string     `json:"frequency"`          // 'once', 'daily', 'weekly' or 'monthly'
+	Interval   int        `json:"interval"`           // every Interval days, weeks or months, defaults to 1
+	StartAt    time.Time  `json:"start_at"`           // the first occurrence
+	EndAt      *time.Time `json:"end_at,omitempty"`   // no occurrence after this
+	MaxRuns    *int       `json:"max_runs,omitempty"` // number of occurrences
+}
+
+// ScheduledPayment is a schedule and where it stands. Occurrences counts the
+// occurrences paid or given up on, including those skipped while paused.
+type ScheduledPayment struct {
+	ID uuid.UUID `json:"id"`
+	ScheduledPaymentInsert
+	Status        string     `json:"status"`                // 'active', 'paused', 'completed', 'cancelled' or 'failed'
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"` // unset once the schedule ended
+	Occurrences   int        `json:"occurrences"`
+	Attempts      int        `json:"attempts"`           // failed attempts at the next occurrence
+	RetryAt       *time.Time `json:"retry_at,omitempty"` // when the next occurrence is tried again
+	LastPaymentID *uuid.UUID `json:"last_payment_id,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -3,8 +3,48 @@ package payments
 import "errors"
 
 var (
-	ErrNoPaymentsFound      = errors.New("No payments found in database")
-	ErrUserIdNotFound       = errors.New("No user found with the ID passed")
-	ErrIllegalUserId        = errors.New("Illegal user ID provided")
-	ErrDepositAmountInvalid = errors.New("Deposit amount must be greater than zero")
+	ErrNoPaymentsFound         = errors.New("No payments found in database")
+	ErrUserIdNotFound          = errors.New("No user found with the ID passed")
+	ErrIllegalUserId           = errors.New("Illegal user ID provided")
+	ErrDepositAmountInvalid    = errors.New("Deposit amount must be greater than zero")
+	ErrInsufficientFunds       = errors.New("Insufficient funds")
+	ErrWithdrawalAmountInvalid = errors.New("Withdrawal amount must be greater than zero")
+	ErrDestinationRequired     = errors.New("Withdrawal destination is required")
+	ErrWithdrawalNotFound      = errors.New("No withdrawal found with the ID passed")
+	ErrWithdrawalNotPending    = errors.New("Withdrawal is not pending")
+	ErrPaymentNotFound         = errors.New("No payment found with the ID passed")
+	ErrRefundAmountInvalid     = errors.New("Refund amount must not be negative")
+	ErrRefundNotAllowed        = errors.New("Only the receiver of a payment can refund it")
+	ErrPaymentNotRefundable    = errors.New("Payment cannot be refunded in its current status")
+	ErrRefundExceedsPayment    = errors.New("Refund exceeds the amount left to refund on the payment")
+	ErrInvalidCursor           = errors.New("Invalid pagination cursor")
+	ErrInvalidFilter           = errors.New("Invalid payment filter")
+	ErrAccountFrozen           = errors.New("Account is frozen")
+	ErrAccountClosed           = errors.New("Account is closed")
+	ErrCounterpartyUnavailable = errors.New("Receiving account cannot accept funds")
+	ErrWalletNotFound          = errors.New("No wallet in this currency")
+	ErrUnsupportedCurrency     = errors.New("Unsupported currency")
+	ErrQuoteNotFound           = errors.New("No FX quote found with the ID passed")
+	ErrQuoteExpired            = errors.New("FX quote has expired")
+	ErrQuoteUsed               = errors.New("FX quote has already been executed")
+	ErrAmountBelowFee          = errors.New("Amount does not cover the fee")
+	ErrInvalidFeeType          = errors.New("type must be payment, deposit or withdrawal")
+	ErrFeeAmountInvalid        = errors.New("Amount must be greater than zero")
+	ErrPerTransactionLimit     = errors.New("Amount exceeds the per-transaction limit")
+	ErrDailyLimit              = errors.New("Daily limit reached")
+	ErrMonthlyLimit            = errors.New("Monthly limit reached")
+	ErrPaymentBlocked          = errors.New("Payment was blocked by fraud checks")
+	ErrFraudDecisionNotFound   = errors.New("No fraud decision found for the payment")
+	ErrReviewNotFound          = errors.New("No review found for the payment")
+	ErrReviewClosed            = errors.New("Payment review has already been decided")
+	ErrReviewClaimed           = errors.New("Payment review is claimed by another reviewer")
+	ErrReviewNotClaimed        = errors.New("Claim the payment review before deciding it")
+	ErrSelfReview              = errors.New("Reviewers can't review payments they sent or received")
+	ErrReviewAccountBlocked    = errors.New("An account of the payment is frozen or closed, it can only be rejected")
+	ErrReasonRequired          = errors.New("A reason is required to reject a payment")
+	ErrInvalidSchedule         = errors.New("Invalid payment schedule")
+	ErrScheduleNotFound        = errors.New("No scheduled payment found with the ID passed")
+	ErrScheduleNotActive       = errors.New("Scheduled payment is not active")
+	ErrScheduleNotPaused       = errors.New("Scheduled payment is not paused")
+	ErrScheduleEnded           = errors.New("Scheduled payment has already ended")
 )
@@ -0,0 +1,177 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/config"
+	"paygo/ledger"
+	"paygo/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// priceTransaction applies the fee schedule to amount. Payers are charged the
+// fee on top of payments and withdrawals; deposits are credited net of it.
+func priceTransaction(schedule config.FeeSchedule, txType, currency string, amount int64) models.FeeBreakdown {
+	breakdown := models.FeeBreakdown{
+		Type:       txType,
+		Currency:   currency,
+		Amount:     amount,
+		Components: []models.FeeComponent{},
+	}
+
+	if rule, ok := matchFeeRule(schedule, txType, currency); ok {
+		flat, bps := rule.Flat, rule.PercentBps
+		for _, tier := range rule.Tiers {
+			if tier.UpTo == 0 || amount <= tier.UpTo {
+				flat, bps = tier.Flat, tier.PercentBps
+				break
+			}
+		}
+
+		add := func(name string, fee int64) {
+			if fee != 0 {
+				breakdown.Components = append(breakdown.Components, models.FeeComponent{Name: name, Amount: fee})
+				breakdown.Fee += fee
+			}
+		}
+		add("flat", flat)
+		add("percentage", percentOf(amount, bps))
+		if breakdown.Fee < rule.Min {
+			add("minimum", rule.Min-breakdown.Fee)
+		}
+		if rule.Max > 0 && breakdown.Fee > rule.Max {
+			add("maximum", rule.Max-breakdown.Fee)
+		}
+	}
+
+	if txType == "deposit" {
+		breakdown.Total = amount - breakdown.Fee
+	} else {
+		breakdown.Total = amount + breakdown.Fee
+	}
+	return breakdown
+}
+
+// matchFeeRule prefers a rule for the exact currency over a "*" rule.
+func matchFeeRule(schedule config.FeeSchedule, txType, currency string) (config.FeeRule, bool) {
+	var fallback *config.FeeRule
+	for i, rule := range schedule.Rules {
+		if rule.Type != txType {
+			continue
+		}
+		if rule.Currency == currency {
+			return rule, true
+		}
+		if rule.Currency == "*" && fallback == nil {
+			fallback = &schedule.Rules[i]
+		}
+	}
+	if fallback == nil {
+		return config.FeeRule{}, false
+	}
+	return *fallback, true
+}
+
+// percentOf returns bps basis points of amount, rounded half up.
+func percentOf(amount, bps int64) int64 {
+	return (amount*bps + 5_000) / 10_000
+}
+
+// chargeFee debits fee from the wallet as a 'fee' transaction referencing the
+// transaction it was charged for, crediting system:revenue.
+// With holdAccount set the fee is left pending in that account instead,
+// alongside the withdrawal or held payment it belongs to, and settled with it
+// by settleFee.
+func chargeFee(ctx context.Context, tx pgx.Tx, walletId uuid.UUID, currency string, fee int64, referenceId uuid.UUID, holdAccount string) error {
+	if fee == 0 {
+		return nil
+	}
+
+	status, credit := "completed", ledger.SystemPosting(ledger.AccountRevenue, currency, fee)
+	if holdAccount != "" {
+		status, credit = "pending", ledger.SystemPosting(holdAccount, currency, fee)
+	}
+
+	var feeTxId uuid.UUID
+	err := tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, amount, currency, status, type, reference_id)
+		VALUES ($1, $2, $3, $4, 'fee', $5)
+		RETURNING id
+	`, walletId, fee, currency, status, referenceId).Scan(&feeTxId)
+
+	if err != nil {
+		return fmt.Errorf("failed to create fee transaction: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: feeTxId,
+		Description:   "fee",
+		Postings:      []ledger.Posting{ledger.WalletPosting(walletId, -fee), credit},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record fee in ledger: %w", err)
+	}
+	return nil
+}
+
+// settleFee collects the pending fee held in holdAccount for a withdrawal or
+// held payment into system:revenue once it completes, or returns it to the
+// wallet when it failed. With suspend set a failed fee goes to
+// system:suspense instead, for wallets that can no longer take it back.
+func settleFee(ctx context.Context, tx pgx.Tx, referenceId uuid.UUID, holdAccount string, completed, suspend bool) error {
+	var (
+		feeTxId  uuid.UUID
+		walletId uuid.UUID
+		fee      int64
+		currency string
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT id, from_wallet_id, amount, currency
+		FROM transactions
+		WHERE reference_id = $1 AND type = 'fee' AND status = 'pending'
+		FOR UPDATE
+	`, referenceId).Scan(&feeTxId, &walletId, &fee, &currency)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock pending fee: %w", err)
+	}
+
+	entry := ledger.Entry{TransactionID: feeTxId, Description: "fee collected"}
+	status := "completed"
+	if completed {
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(holdAccount, currency, -fee),
+			ledger.SystemPosting(ledger.AccountRevenue, currency, fee),
+		}
+	} else if suspend {
+		entry.Description = "fee moved to suspense"
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(holdAccount, currency, -fee),
+			ledger.SystemPosting(ledger.AccountSuspense, currency, fee),
+		}
+		status = "failed"
+	} else {
+		entry.Description = "fee returned"
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(holdAccount, currency, -fee),
+			ledger.WalletPosting(walletId, fee),
+		}
+		status = "failed"
+	}
+
+	if _, err = ledger.Record(ctx, tx, entry); err != nil {
+		return fmt.Errorf("failed to settle fee in ledger: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE transactions SET status = $2 WHERE id = $1`, feeTxId, status)
+	if err != nil {
+		return fmt.Errorf("failed to settle fee: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package payments
+
+import (
+	"paygo/config"
+	"paygo/models"
+	"slices"
+	"testing"
+)
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		bps    int64
+		want   int64
+	}{
+		{"exact", 10_000, 290, 290},
+		{"rounds down below half", 149, 100, 1},
+		{"rounds half up", 150, 100, 2},
+		{"rounds up above half", 100, 290, 3},
+		{"under half a unit is free", 49, 100, 0},
+		{"half a unit", 50, 100, 1},
+		{"whole amount", 12_345, 10_000, 12_345},
+		{"no rate", 1_000_000, 0, 0},
+		{"no amount", 0, 290, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentOf(tt.amount, tt.bps); got != tt.want {
+				t.Errorf("percentOf(%d, %d) = %d, want %d", tt.amount, tt.bps, got, tt.want)
+			}
+		})
+	}
+}
+
+var testSchedule = config.FeeSchedule{Rules: []config.FeeRule{
+	{Type: "payment", Currency: "*", Flat: 10},
+	{Type: "payment", Currency: "USD", Flat: 30, PercentBps: 290, Min: 50, Max: 1_000},
+	{Type: "deposit", Currency: "*", PercentBps: 100},
+	{Type: "withdrawal", Currency: "USD", Flat: 999, Tiers: []config.FeeTier{
+		{UpTo: 10_000, Flat: 100},
+		{UpTo: 100_000, PercentBps: 50},
+		{Flat: 500},
+	}},
+	{Type: "withdrawal", Currency: "GBP", Flat: 200, Tiers: []config.FeeTier{
+		{UpTo: 1_000},
+	}},
+}}
+
+func TestPriceTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		txType     string
+		currency   string
+		amount     int64
+		components []models.FeeComponent
+		fee        int64
+		total      int64
+	}{
+		{"flat and percentage", "payment", "USD", 1_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 30}, {Name: "percentage", Amount: 29}}, 59, 1_059},
+		{"raised to the minimum", "payment", "USD", 100,
+			[]models.FeeComponent{{Name: "flat", Amount: 30}, {Name: "percentage", Amount: 3}, {Name: "minimum", Amount: 17}}, 50, 150},
+		{"capped at the maximum", "payment", "USD", 100_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 30}, {Name: "percentage", Amount: 2_900}, {Name: "maximum", Amount: -1_930}}, 1_000, 101_000},
+		{"exact currency wins over a wildcard listed first", "payment", "USD", 20_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 30}, {Name: "percentage", Amount: 580}}, 610, 20_610},
+		{"other currency falls back to the wildcard", "payment", "EUR", 1_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 10}}, 10, 1_010},
+		{"deposits are credited net", "deposit", "GBP", 10_000,
+			[]models.FeeComponent{{Name: "percentage", Amount: 100}}, 100, 9_900},
+		{"fee rounding to zero is left out", "deposit", "JPY", 49,
+			[]models.FeeComponent{}, 0, 49},
+		{"first tier includes its bound", "withdrawal", "USD", 10_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 100}}, 100, 10_100},
+		{"second tier", "withdrawal", "USD", 10_001,
+			[]models.FeeComponent{{Name: "percentage", Amount: 50}}, 50, 10_051},
+		{"open-ended last tier", "withdrawal", "USD", 1_000_000,
+			[]models.FeeComponent{{Name: "flat", Amount: 500}}, 500, 1_000_500},
+		{"free tier", "withdrawal", "GBP", 1_000,
+			[]models.FeeComponent{}, 0, 1_000},
+		{"past every tier the rule's own pricing applies", "withdrawal", "GBP", 1_001,
+			[]models.FeeComponent{{Name: "flat", Amount: 200}}, 200, 1_201},
+		{"no rule is free", "withdrawal", "EUR", 1_000,
+			[]models.FeeComponent{}, 0, 1_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := priceTransaction(testSchedule, tt.txType, tt.currency, tt.amount)
+			if got.Fee != tt.fee || got.Total != tt.total || !slices.Equal(got.Components, tt.components) {
+				t.Errorf("priceTransaction(%s, %d %s) = fee %d, total %d from %+v, want fee %d, total %d from %+v",
+					tt.txType, tt.amount, tt.currency, got.Fee, got.Total, got.Components, tt.fee, tt.total, tt.components)
+			}
+			if got.Type != tt.txType || got.Currency != tt.currency || got.Amount != tt.amount {
+				t.Errorf("priceTransaction = %s %d %s, want %s %d %s",
+					got.Type, got.Amount, got.Currency, tt.txType, tt.amount, tt.currency)
+			}
+		})
+	}
+}
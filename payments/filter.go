@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"paygo/currency"
+	"paygo/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var paymentStatuses = []string{"initiated", "completed", "failed", "partially_refunded", "refunded", "held", "in_review", "blocked"}
+
+// EncodeCursor turns the position of the last returned payment into the
+// opaque next_cursor handed to clients.
+func EncodeCursor(c models.PaymentCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (models.PaymentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.PaymentCursor{}, ErrInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return models.PaymentCursor{}, ErrInvalidCursor
+	}
+
+	var c models.PaymentCursor
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return models.PaymentCursor{}, ErrInvalidCursor
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return models.PaymentCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ParsePaymentFilter reads limit, cursor, from, to, status, direction,
+// counterparty_id, min_amount and max_amount from the query string.
+func ParsePaymentFilter(q url.Values) (filter models.PaymentFilter, err error) {
+	filter.Limit = defaultPageSize
+	if raw := q.Get("limit"); raw != "" {
+		filter.Limit, err = strconv.Atoi(raw)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+			return filter, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, maxPageSize)
+		}
+	}
+
+	if raw := q.Get("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = &cursor
+	}
+
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		return filter, err
+	}
+
+	filter.Status = q.Get("status")
+	if filter.Status != "" && !slices.Contains(paymentStatuses, filter.Status) {
+		return filter, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, filter.Status)
+	}
+
+	if raw := q.Get("currency"); raw != "" {
+		c, err := currency.Lookup(raw)
+		if err != nil {
+			return filter, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		filter.Currency = c.Code
+	}
+
+	filter.Direction = q.Get("direction")
+	if filter.Direction != "" && filter.Direction != "sent" && filter.Direction != "received" {
+		return filter, fmt.Errorf("%w: direction must be sent or received", ErrInvalidFilter)
+	}
+
+	if raw := q.Get("counterparty_id"); raw != "" {
+		if filter.CounterpartyID, err = uuid.Parse(raw); err != nil {
+			return filter, fmt.Errorf("%w: invalid counterparty_id", ErrInvalidFilter)
+		}
+	}
+
+	if filter.MinAmount, err = parseAmountParam(q, "min_amount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseAmountParam(q, "max_amount"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam accepts either RFC 3339 timestamps or plain dates.
+func parseTimeParam(q url.Values, name string) (*time.Time, error) {
+	raw := q.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s must be RFC 3339 or YYYY-MM-DD", ErrInvalidFilter, name)
+}
+
+func parseAmountParam(q url.Values, name string) (*int64, error) {
+	raw := q.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || amount < 0 {
+		return nil, fmt.Errorf("%w: %s must be a non-negative amount in cents", ErrInvalidFilter, name)
+	}
+	return &amount, nil
+}
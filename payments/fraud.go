@@ -0,0 +1,94 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/fraud"
+	"paygo/idempotency"
+	"paygo/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func recordFraudDecision(ctx context.Context, tx pgx.Tx, paymentId uuid.UUID, decision models.FraudDecision) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO fraud_decisions (payment_id, action, score, triggered)
+		VALUES ($1, $2, $3, $4)
+	`, paymentId, decision.Action, decision.Score, decision.Rules)
+
+	if err != nil {
+		return fmt.Errorf("failed to record fraud decision: %w", err)
+	}
+	return nil
+}
+
+// insertFlaggedPayment records a payment the fraud rules held or blocked and
+// commits tx. A held payment reserves the amount and fee in system:holds and
+// joins the review queue; a blocked one moves no funds and has no transaction.
+func (s *PaymentsStore) insertFlaggedPayment(ctx context.Context, tx pgx.Tx, newPayment *models.PaymentInsert,
+	senderWalletId, receiverWalletId uuid.UUID, decision models.FraudDecision) (models.Payment, error) {
+
+	payment := models.Payment{PaymentInsert: *newPayment}
+	payment.Status = "blocked"
+	if decision.Action == fraud.ActionHold {
+		payment.Status = "held"
+		transactionId, err := holdFunds(ctx, tx, newPayment, senderWalletId, receiverWalletId)
+		if err != nil {
+			return models.Payment{}, err
+		}
+		payment.TransactionID = &transactionId
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO payments (sender_id, receiver_id, amount, currency, status, transaction_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, newPayment.SenderID, newPayment.ReceiverID, newPayment.Amount, newPayment.Currency,
+		payment.Status, payment.TransactionID, newPayment.Note).Scan(&payment.ID, &payment.CreatedAt)
+
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("failed to create %s payment: %w", payment.Status, err)
+	}
+
+	if err = recordFraudDecision(ctx, tx, payment.ID, decision); err != nil {
+		return models.Payment{}, err
+	}
+	if payment.Status == "held" {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO payment_reviews (payment_id, due_at)
+			VALUES ($1, CURRENT_TIMESTAMP + $2::interval)
+		`, payment.ID, s.reviewSLA)
+
+		if err != nil {
+			return models.Payment{}, fmt.Errorf("failed to queue payment for review: %w", err)
+		}
+	}
+	if err = idempotency.BindTx(ctx, tx, payment.ID); err != nil {
+		return models.Payment{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.Payment{}, fmt.Errorf("failed to commit %s payment: %w", payment.Status, err)
+	}
+	return payment, nil
+}
+
+// GetFraudDecision returns what the fraud rules decided on a payment, and for
+// held payments how the review ended.
+func (s *PaymentsStore) GetFraudDecision(ctx context.Context, paymentId uuid.UUID) (models.FraudDecision, error) {
+	decision := models.FraudDecision{PaymentID: paymentId}
+	err := s.db.QueryRow(ctx, `
+		SELECT action, score, triggered, review, reviewed_at, created_at
+		FROM fraud_decisions
+		WHERE payment_id = $1
+	`, paymentId).Scan(&decision.Action, &decision.Score, &decision.Rules, &decision.Review, &decision.ReviewedAt, &decision.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.FraudDecision{}, ErrFraudDecisionNotFound
+	}
+	if err != nil {
+		return models.FraudDecision{}, fmt.Errorf("failed to get fraud decision: %w", err)
+	}
+	return decision, nil
+}
@@ -5,40 +5,72 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"paygo/auth"
+	"paygo/currency"
+	"paygo/idempotency"
+	"paygo/md"
 	"paygo/models"
+	"strconv"
 
 	"github.com/google/uuid"
 )
 
 type PaymentServiceInterface interface {
-	GetAllPayments(context.Context) ([]models.Payment, error)
-	GetPaymentsByUserId(ctx context.Context, userId uuid.UUID) ([]models.PaymentWithNames, error)
-	InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (uuid.UUID, error)
-	ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) error
+	GetAllPayments(ctx context.Context, filter models.PaymentFilter) (models.Page[models.Payment], error)
+	GetPaymentsByUserId(ctx context.Context, userId uuid.UUID, filter models.PaymentFilter) (models.Page[models.PaymentWithNames], error)
+	InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (models.Payment, error)
+	ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) (models.Deposit, error)
+	Withdraw(ctx context.Context, withdrawal *models.WithdrawalInsert) (models.Withdrawal, error)
+	RefundPayment(ctx context.Context, refund *models.RefundInsert) (models.Refund, error)
+	Convert(ctx context.Context, userId, quoteId uuid.UUID) (models.Conversion, error)
+	QuoteFee(ctx context.Context, req models.FeeQuoteRequest) (models.FeeBreakdown, error)
+	GetLimits(ctx context.Context, userId uuid.UUID, currency string) ([]models.LimitStatus, error)
+	GetFraudDecision(ctx context.Context, paymentId uuid.UUID) (models.FraudDecision, error)
+	ListReviews(ctx context.Context, status string, limit int) ([]models.PaymentReview, error)
+	ClaimReview(ctx context.Context, paymentId, reviewerId uuid.UUID) (models.PaymentReview, error)
+	ApproveReview(ctx context.Context, paymentId, reviewerId uuid.UUID, reason string) (models.PaymentReview, error)
+	RejectReview(ctx context.Context, paymentId, reviewerId uuid.UUID, reason string) (models.PaymentReview, error)
+	CreateSchedule(ctx context.Context, schedule *models.ScheduledPaymentInsert) (models.ScheduledPayment, error)
+	GetSchedules(ctx context.Context, senderId uuid.UUID) ([]models.ScheduledPayment, error)
+	PauseSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+	ResumeSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+	CancelSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+}
+
+// StepUpVerifier checks a fresh second-factor code for the user.
+type StepUpVerifier interface {
+	VerifyStepUp(ctx context.Context, userId uuid.UUID, code string) error
 }
 
 type PaymentHandler struct {
-	service PaymentServiceInterface
+	service          PaymentServiceInterface
+	stepUp           StepUpVerifier
+	stepUpThresholds map[string]int64 // per currency, payments of at least this amount need step-up
 }
 
-func NewPaymentsHandler(s PaymentServiceInterface) *PaymentHandler {
+func NewPaymentsHandler(s PaymentServiceInterface, stepUp StepUpVerifier, stepUpThresholds map[string]int64) *PaymentHandler {
 	return &PaymentHandler{
-		service: s,
+		service:          s,
+		stepUp:           stepUp,
+		stepUpThresholds: stepUpThresholds,
 	}
 }
 
 func (p *PaymentHandler) GetAllPayments(w http.ResponseWriter, r *http.Request) {
-	payments, err := p.service.GetAllPayments(r.Context())
+	filter, err := ParsePaymentFilter(r.URL.Query())
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrNoPaymentsFound):
-			http.Error(w, "No payments found", http.StatusNotFound)
-		default:
-			log.Printf("error listing all payments, %v", err.Error())
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payments, err := p.service.GetAllPayments(r.Context(), filter)
+	if err != nil {
+		log.Printf("error listing all payments, %v", err.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -46,21 +78,36 @@ func (p *PaymentHandler) GetAllPayments(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(payments)
 }
 
+// GetPaymentsByUserId lists the authenticated user's payments. Callers holding
+// payments:read_all may read another user's history by passing ?user_id=.
 func (p *PaymentHandler) GetPaymentsByUserId(w http.ResponseWriter, r *http.Request) {
-	userId := r.URL.Query().Get("user_id")
+	userUUID, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if userId := r.URL.Query().Get("user_id"); userId != "" {
+		requested, err := uuid.Parse(userId)
+		if err != nil {
+			http.Error(w, "Invalid user UUID format", http.StatusBadRequest)
+			return
+		}
+		if requested != userUUID && !md.HasPermission(r.Context(), auth.PermPaymentsReadAll) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userUUID = requested
+	}
 
-	userUUID, err := uuid.Parse(userId)
+	filter, err := ParsePaymentFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Invalid user UUID format", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	payments, err := p.service.GetPaymentsByUserId(r.Context(), userUUID)
+	payments, err := p.service.GetPaymentsByUserId(r.Context(), userUUID, filter)
 	if err != nil {
-		if errors.Is(err, ErrNoPaymentsFound) {
-			http.Error(w, "No payments found for user.", http.StatusNotFound)
-			return
-		}
 		log.Printf("failed in retrieving payments: %v", err)
 		http.Error(w, "Failed to retrieve payments", http.StatusInternalServerError)
 		return
@@ -73,7 +120,15 @@ func (p *PaymentHandler) GetPaymentsByUserId(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// InsertPayment pays from the authenticated user's wallet. sender_id may be
+// omitted from the body; when present it must match the token's subject.
 func (p *PaymentHandler) InsertPayment(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	var newPayment models.PaymentInsert
 	newPayment.Status = "pending"
 
@@ -82,21 +137,47 @@ func (p *PaymentHandler) InsertPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if newPayment.ReceiverID == uuid.Nil || newPayment.SenderID == uuid.Nil || newPayment.Amount <= 0 {
-		http.Error(w, "Invalid receiver or sender ID or amount", http.StatusBadRequest)
+	if newPayment.SenderID != uuid.Nil && newPayment.SenderID != userId {
+		http.Error(w, "sender_id does not match the authenticated user", http.StatusForbidden)
+		return
+	}
+	newPayment.SenderID = userId
+
+	if newPayment.ReceiverID == uuid.Nil || newPayment.Amount <= 0 {
+		http.Error(w, "Invalid receiver ID or amount", http.StatusBadRequest)
 		return
 	}
 	if newPayment.SenderID == newPayment.ReceiverID {
 		http.Error(w, "Sender and receiver cannot be the same", http.StatusBadRequest)
 		return
 	}
-	newPaymentId, err := p.service.InsertNewPayment(r.Context(), &newPayment)
+	if !p.verifyStepUp(w, r, userId, newPayment.Amount, newPayment.Currency) {
+		return
+	}
+	payment, err := p.service.InsertNewPayment(r.Context(), &newPayment)
 	if err != nil {
+		if writeLimitError(w, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, ErrUserIdNotFound):
 			http.Error(w, "User ID passed does not exist in our DB.", http.StatusBadRequest)
 		case errors.Is(err, ErrNoPaymentsFound):
 			http.Error(w, "No payments found in DB", http.StatusNotFound)
+		case errors.Is(err, ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds", http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrCounterpartyUnavailable):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrWalletNotFound):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrPaymentBlocked):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			http.Error(w, "Payment already processed for this Idempotency-Key", http.StatusConflict)
 		default:
 			log.Printf("handler: error inserting payment: %v", err.Error())
 			http.Error(w, "Error inserting payment", http.StatusInternalServerError)
@@ -104,8 +185,63 @@ func (p *PaymentHandler) InsertPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, "Payment created with ID: %s", newPaymentId)
+	// A held payment has its funds reserved but completes only once reviewed.
+	status := http.StatusCreated
+	if payment.Status == "held" {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payment); err != nil {
+		log.Printf("handler: error encoding payment: %v", err)
+	}
+}
+
+// verifyStepUp requires a TOTP code in the X-TOTP-Code header for payments at
+// or above the threshold for their currency. Currencies without a threshold
+// don't need step-up; unsupported ones are left for the service to refuse. It
+// writes the error response itself.
+func (p *PaymentHandler) verifyStepUp(w http.ResponseWriter, r *http.Request, userId uuid.UUID, amount int64, code string) bool {
+	if !stepUpRequired(p.stepUpThresholds, amount, code) {
+		return true
+	}
+
+	totp := r.Header.Get("X-TOTP-Code")
+	if totp == "" {
+		w.Header().Set("X-Step-Up-Required", "totp")
+		http.Error(w, "Two-factor code required for this amount", http.StatusUnauthorized)
+		return false
+	}
+
+	var throttled *auth.LoginThrottledError
+	err := p.stepUp.VerifyStepUp(r.Context(), userId, totp)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrTOTPNotEnabled):
+		http.Error(w, "Two-factor authentication must be enabled for payments of this amount", http.StatusForbidden)
+	case errors.Is(err, auth.ErrInvalidTOTPCode):
+		w.Header().Set("X-Step-Up-Required", "totp")
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, "Too many invalid two-factor codes, try again later", http.StatusTooManyRequests)
+	default:
+		log.Printf("handler: error verifying step-up: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// stepUpRequired reports whether a payment of amount in the currency code, or
+// the default currency when code is empty, is at or above its threshold.
+func stepUpRequired(thresholds map[string]int64, amount int64, code string) bool {
+	normalized, err := currency.Normalize(code)
+	if err != nil {
+		return false
+	}
+	threshold, ok := thresholds[normalized]
+	return ok && amount >= threshold
 }
 
 func (p *PaymentHandler) Deposit(w http.ResponseWriter, r *http.Request) {
@@ -119,22 +255,504 @@ func (p *PaymentHandler) Deposit(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&depositRequest)
 	if err != nil {
 		http.Error(w, "failed parsing new deposits", http.StatusBadRequest)
+		return
 	}
 
 	depositRequest.UserID = userId
 
-	err = p.service.ProcessDeposit(r.Context(), &depositRequest)
+	deposit, err := p.service.ProcessDeposit(r.Context(), &depositRequest)
 
 	if err != nil {
+		if writeLimitError(w, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, ErrUserIdNotFound):
 			http.Error(w, "User ID does not exist in our DB.", http.StatusBadRequest)
 		case errors.Is(err, ErrDepositAmountInvalid):
 			http.Error(w, "Deposit amount must be greater than zero", http.StatusBadRequest)
+		case errors.Is(err, ErrAmountBelowFee):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrWalletNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			http.Error(w, "Deposit already processed for this Idempotency-Key", http.StatusConflict)
 		default:
 			log.Printf("handler: error processing deposit: %v", err.Error())
 			http.Error(w, "Error processing deposit", http.StatusInternalServerError)
 		}
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deposit); err != nil {
+		log.Printf("handler: error encoding deposit: %v", err)
+	}
+}
+
+func (p *PaymentHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var withdrawalRequest models.WithdrawalInsert
+	if err := json.NewDecoder(r.Body).Decode(&withdrawalRequest); err != nil {
+		http.Error(w, "failed parsing withdrawal", http.StatusBadRequest)
+		return
+	}
+
+	withdrawalRequest.UserID = userId
+
+	withdrawal, err := p.service.Withdraw(r.Context(), &withdrawalRequest)
+	if err != nil {
+		if writeLimitError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrUserIdNotFound):
+			http.Error(w, "User ID does not exist in our DB.", http.StatusBadRequest)
+		case errors.Is(err, ErrWithdrawalAmountInvalid), errors.Is(err, ErrDestinationRequired),
+			errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrWalletNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds", http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			http.Error(w, "Withdrawal already processed for this Idempotency-Key", http.StatusConflict)
+		default:
+			log.Printf("handler: error processing withdrawal: %v", err.Error())
+			http.Error(w, "Error processing withdrawal", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(withdrawal); err != nil {
+		log.Printf("handler: error encoding withdrawal: %v", err)
+	}
+}
+
+func (p *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	paymentId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment UUID format", http.StatusBadRequest)
+		return
+	}
+
+	var refundRequest models.RefundInsert
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&refundRequest); err != nil {
+			http.Error(w, "failed parsing refund", http.StatusBadRequest)
+			return
+		}
+	}
+	refundRequest.PaymentID = paymentId
+	refundRequest.RequesterID = userId
+
+	refund, err := p.service.RefundPayment(r.Context(), &refundRequest)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPaymentNotFound):
+			http.Error(w, "Payment not found", http.StatusNotFound)
+		case errors.Is(err, ErrRefundNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrRefundAmountInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrPaymentNotRefundable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrRefundExceedsPayment):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds to refund", http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrCounterpartyUnavailable):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			http.Error(w, "Refund already processed for this Idempotency-Key", http.StatusConflict)
+		default:
+			log.Printf("handler: error refunding payment: %v", err.Error())
+			http.Error(w, "Error refunding payment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(refund); err != nil {
+		log.Printf("handler: error encoding refund: %v", err)
+	}
+}
+
+// Convert executes an FX quote from POST /fx/quotes, moving funds between two
+// of the user's wallets at the locked rate.
+func (p *PaymentHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		QuoteID uuid.UUID `json:"quote_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.QuoteID == uuid.Nil {
+		http.Error(w, "quote_id is required", http.StatusBadRequest)
+		return
+	}
+
+	conversion, err := p.service.Convert(r.Context(), userId, body.QuoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrQuoteNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrQuoteUsed):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrQuoteExpired), errors.Is(err, ErrWalletNotFound):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds", http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			http.Error(w, "Conversion already processed for this Idempotency-Key", http.StatusConflict)
+		default:
+			log.Printf("handler: error converting currency: %v", err.Error())
+			http.Error(w, "Error converting currency", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(conversion); err != nil {
+		log.Printf("handler: error encoding conversion: %v", err)
+	}
+}
+
+// QuoteFee previews the fee breakdown of a payment, deposit or withdrawal.
+func (p *PaymentHandler) QuoteFee(w http.ResponseWriter, r *http.Request) {
+	var req models.FeeQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "failed parsing fee quote request", http.StatusBadRequest)
+		return
+	}
+
+	breakdown, err := p.service.QuoteFee(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidFeeType), errors.Is(err, ErrFeeAmountInvalid), errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("handler: error quoting fee: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakdown)
+}
+
+// writeLimitError answers a transaction refused by a limit: 422 when the
+// amount itself is too large, 429 when a rolling window is used up. It
+// reports false when err isn't a limit error.
+func writeLimitError(w http.ResponseWriter, err error) bool {
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+
+	status := http.StatusTooManyRequests
+	if errors.Is(limitErr, ErrPerTransactionLimit) {
+		status = http.StatusUnprocessableEntity
+	}
+	http.Error(w, limitErr.Error(), status)
+	return true
+}
+
+// GetLimits shows the authenticated user their limits in ?currency= (USD by
+// default) and the allowance left in each rolling window.
+func (p *PaymentHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	limits, err := p.service.GetLimits(r.Context(), userId, r.URL.Query().Get("currency"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrUserIdNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			log.Printf("handler: error fetching limits: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// GetFraudDecision shows admins the fraud rules' decision on a payment and
+// the rules it triggered.
+func (p *PaymentHandler) GetFraudDecision(w http.ResponseWriter, r *http.Request) {
+	paymentId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	decision, err := p.service.GetFraudDecision(r.Context(), paymentId)
+	if err != nil {
+		if errors.Is(err, ErrFraudDecisionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("handler: error fetching fraud decision: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
+
+// ListReviews shows the review queue of held payments, soonest due first.
+// ?status= lists reviews whose payment is in that status instead of the open
+// ones.
+func (p *PaymentHandler) ListReviews(w http.ResponseWriter, r *http.Request) {
+	limit := defaultPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	reviews, err := p.service.ListReviews(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidFilter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("handler: error listing reviews: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ClaimReview assigns a held payment to the calling reviewer.
+func (p *PaymentHandler) ClaimReview(w http.ResponseWriter, r *http.Request) {
+	reviewerId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	paymentId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	review, err := p.service.ClaimReview(r.Context(), paymentId, reviewerId)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// ApproveReview releases a held payment the caller has claimed to its
+// receiver. The body may carry a reason.
+func (p *PaymentHandler) ApproveReview(w http.ResponseWriter, r *http.Request) {
+	p.decideReview(w, r, p.service.ApproveReview)
+}
+
+// RejectReview returns a held payment the caller has claimed to its sender.
+// The body must carry a reason.
+func (p *PaymentHandler) RejectReview(w http.ResponseWriter, r *http.Request) {
+	p.decideReview(w, r, p.service.RejectReview)
+}
+
+func (p *PaymentHandler) decideReview(w http.ResponseWriter, r *http.Request,
+	decide func(ctx context.Context, paymentId, reviewerId uuid.UUID, reason string) (models.PaymentReview, error)) {
+
+	reviewerId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	paymentId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	var body models.ReviewDecision
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := decide(r.Context(), paymentId, reviewerId, body.Reason)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrReviewNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrReviewClosed), errors.Is(err, ErrReviewClaimed), errors.Is(err, ErrReviewNotClaimed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrSelfReview):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrReviewAccountBlocked):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("handler: error updating review: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// CreateSchedule sets up a one-off or recurring payment from the caller.
+// Amounts needing step-up are confirmed now, since no one is around to
+// confirm the payments when they run.
+func (p *PaymentHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var schedule models.ScheduledPaymentInsert
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if schedule.SenderID != uuid.Nil && schedule.SenderID != userId {
+		http.Error(w, "sender_id does not match the authenticated user", http.StatusForbidden)
+		return
+	}
+	schedule.SenderID = userId
+
+	if !p.verifyStepUp(w, r, userId, schedule.Amount, schedule.Currency) {
+		return
+	}
+
+	created, err := p.service.CreateSchedule(r.Context(), &schedule)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSchedule), errors.Is(err, ErrUnsupportedCurrency):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrUserIdNotFound):
+			http.Error(w, "User ID passed does not exist in our DB.", http.StatusBadRequest)
+		default:
+			log.Printf("handler: error creating scheduled payment: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// GetSchedules lists the caller's scheduled payments.
+func (p *PaymentHandler) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	schedules, err := p.service.GetSchedules(r.Context(), userId)
+	if err != nil {
+		log.Printf("handler: error listing scheduled payments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+func (p *PaymentHandler) PauseSchedule(w http.ResponseWriter, r *http.Request) {
+	p.changeSchedule(w, r, p.service.PauseSchedule)
+}
+
+func (p *PaymentHandler) ResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	p.changeSchedule(w, r, p.service.ResumeSchedule)
+}
+
+func (p *PaymentHandler) CancelSchedule(w http.ResponseWriter, r *http.Request) {
+	p.changeSchedule(w, r, p.service.CancelSchedule)
+}
+
+func (p *PaymentHandler) changeSchedule(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)) {
+
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	scheduleId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid scheduled payment ID", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := change(r.Context(), scheduleId, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrScheduleNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrScheduleNotActive), errors.Is(err, ErrScheduleNotPaused), errors.Is(err, ErrScheduleEnded):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("handler: error updating scheduled payment: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
 }
@@ -0,0 +1,31 @@
+package payments
+
+import "testing"
+
+func TestStepUpRequired(t *testing.T) {
+	thresholds := map[string]int64{"USD": 100_00, "JPY": 15_000}
+
+	tests := []struct {
+		name   string
+		amount int64
+		code   string
+		want   bool
+	}{
+		{"below the USD threshold", 99_99, "USD", false},
+		{"at the USD threshold", 100_00, "USD", true},
+		{"empty currency is USD", 100_00, "", true},
+		{"lowercase code", 100_00, "usd", true},
+		{"10000 JPY is below the JPY threshold", 10_000, "JPY", false},
+		{"JPY at its own threshold", 15_000, "JPY", true},
+		{"currency without a threshold", 1_000_000_00, "EUR", false},
+		{"unsupported currency", 1_000_000_00, "XXX", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stepUpRequired(thresholds, tt.amount, tt.code); got != tt.want {
+				t.Errorf("stepUpRequired(%d, %q) = %t, want %t", tt.amount, tt.code, got, tt.want)
+			}
+		})
+	}
+}
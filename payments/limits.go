@@ -0,0 +1,305 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/config"
+	"paygo/fx"
+	"paygo/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// limitedTypes are the transaction types limits apply to, in the order
+// GetLimits reports them.
+var limitedTypes = []string{"payment", "deposit", "withdrawal"}
+
+// rowQuerier is satisfied by both the pool and a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// querier is a rowQuerier that can also run queries returning many rows.
+type querier interface {
+	rowQuerier
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// matchLimitRule picks the rule for txType among rules, preferring one in
+// the transaction's currency over one in another currency, whose amounts the
+// transaction is then converted into.
+func matchLimitRule(rules []config.LimitRule, txType, currency string) (config.LimitRule, bool) {
+	var fallback *config.LimitRule
+	for i, rule := range rules {
+		if rule.Type != txType {
+			continue
+		}
+		if rule.Currency == currency {
+			return rule, true
+		}
+		if fallback == nil {
+			fallback = &rules[i]
+		}
+	}
+	if fallback == nil {
+		return config.LimitRule{}, false
+	}
+	return *fallback, true
+}
+
+// appliedLimit is the rule limiting a user's transactions of one type.
+type appliedLimit struct {
+	Rule     config.LimitRule
+	Tier     string
+	Override bool // the rule is the user's own rather than their tier's
+}
+
+// getAppliedLimit finds the rule for the user's transactions of txType in
+// currency: one of the user's own limits for the type if they have any, else
+// one of their tier's rules. ok is false when the type isn't limited.
+func (s *PaymentsStore) getAppliedLimit(ctx context.Context, q querier, userId uuid.UUID, txType, currency string) (limit appliedLimit, ok bool, err error) {
+	limit.Tier, err = getKYCTier(ctx, q, userId)
+	if err != nil {
+		return appliedLimit{}, false, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT type, currency, per_transaction, daily_volume, monthly_volume, daily_count, monthly_count
+		FROM user_limits
+		WHERE user_id = $1 AND type = $2
+		ORDER BY currency
+	`, userId, txType)
+	if err != nil {
+		return appliedLimit{}, false, fmt.Errorf("failed to get user limits: %w", err)
+	}
+	overrides, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (rule config.LimitRule, err error) {
+		err = row.Scan(&rule.Type, &rule.Currency, &rule.PerTransaction, &rule.DailyVolume, &rule.MonthlyVolume,
+			&rule.DailyCount, &rule.MonthlyCount)
+		return rule, err
+	})
+	if err != nil {
+		return appliedLimit{}, false, fmt.Errorf("failed to scan user limits: %w", err)
+	}
+	if len(overrides) > 0 {
+		limit.Rule, _ = matchLimitRule(overrides, txType, currency)
+		limit.Override = true
+		return limit, true, nil
+	}
+
+	var tierRules []config.LimitRule
+	for _, rule := range s.limits.Rules {
+		if rule.Tier == limit.Tier {
+			tierRules = append(tierRules, rule)
+		}
+	}
+	limit.Rule, ok = matchLimitRule(tierRules, txType, currency)
+	return limit, ok, nil
+}
+
+// limitUsage is how much a user moved in the rolling windows.
+type limitUsage struct {
+	DailyVolume   int64
+	DailyCount    int64
+	MonthlyVolume int64
+	MonthlyCount  int64
+}
+
+// getLimitUsage sums the user's transactions of txType over the last 24
+// hours and 30 days across all their wallets, converting volumes in other
+// currencies into currency. Deposits count what came in, the rest what went
+// out; failed transactions don't count.
+func (s *PaymentsStore) getLimitUsage(ctx context.Context, q querier, userId uuid.UUID, txType, currency string) (usage limitUsage, err error) {
+	rows, err := q.Query(ctx, `
+		SELECT
+			t.currency,
+			COALESCE(SUM(t.amount) FILTER (WHERE t.created_at > CURRENT_TIMESTAMP - INTERVAL '1 day'), 0),
+			COUNT(*) FILTER (WHERE t.created_at > CURRENT_TIMESTAMP - INTERVAL '1 day'),
+			COALESCE(SUM(t.amount), 0),
+			COUNT(*)
+		FROM transactions t
+		JOIN wallets w ON w.id = CASE WHEN t.type = 'deposit' THEN t.to_wallet_id ELSE t.from_wallet_id END
+		WHERE w.user_id = $1
+			AND t.type = $2
+			AND t.status <> 'failed'
+			AND t.created_at > CURRENT_TIMESTAMP - INTERVAL '30 days'
+		GROUP BY t.currency
+	`, userId, txType)
+	if err != nil {
+		return limitUsage{}, fmt.Errorf("failed to sum limit usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			code    string
+			inCode  limitUsage
+			daily   int64
+			monthly int64
+		)
+		if err := rows.Scan(&code, &inCode.DailyVolume, &inCode.DailyCount, &inCode.MonthlyVolume, &inCode.MonthlyCount); err != nil {
+			return limitUsage{}, fmt.Errorf("failed to scan limit usage: %w", err)
+		}
+		if daily, err = s.convertForLimit(ctx, inCode.DailyVolume, code, currency); err != nil {
+			return limitUsage{}, err
+		}
+		if monthly, err = s.convertForLimit(ctx, inCode.MonthlyVolume, code, currency); err != nil {
+			return limitUsage{}, err
+		}
+		usage.DailyVolume += daily
+		usage.DailyCount += inCode.DailyCount
+		usage.MonthlyVolume += monthly
+		usage.MonthlyCount += inCode.MonthlyCount
+	}
+	if err := rows.Err(); err != nil {
+		return limitUsage{}, fmt.Errorf("error iterating limit usage: %w", err)
+	}
+	return usage, nil
+}
+
+// convertForLimit converts amount into the currency of a limit. Without a
+// rate the limit can't be checked, so the transaction is refused rather than
+// let through unlimited.
+func (s *PaymentsStore) convertForLimit(ctx context.Context, amount int64, from, to string) (int64, error) {
+	converted, err := fx.Convert(ctx, s.rates, amount, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s into %s for limits: %w", from, to, err)
+	}
+	return converted, nil
+}
+
+func getKYCTier(ctx context.Context, q rowQuerier, userId uuid.UUID) (tier string, err error) {
+	err = q.QueryRow(ctx, `SELECT kyc_tier FROM users WHERE id = $1`, userId).Scan(&tier)
+	if err != nil {
+		return "", fmt.Errorf("failed to get kyc tier: %w", err)
+	}
+	return tier, nil
+}
+
+// checkLimits refuses amount if it would take the user past one of their
+// limits. It must run inside tx, where it holds a per-user lock until tx
+// ends, so concurrent transactions from any of the user's wallets can't both
+// squeeze under the same limit.
+func (s *PaymentsStore) checkLimits(ctx context.Context, tx pgx.Tx, userId uuid.UUID, txType, currency string, amount int64) error {
+	if len(s.limits.Rules) == 0 {
+		var overridden bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_limits WHERE user_id = $1)`, userId).Scan(&overridden)
+		if err != nil {
+			return fmt.Errorf("failed to check user limits: %w", err)
+		}
+		if !overridden {
+			return nil
+		}
+	}
+
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('limits:' || $1::text, 0))`, userId)
+	if err != nil {
+		return fmt.Errorf("failed to lock limits: %w", err)
+	}
+
+	limit, ok, err := s.getAppliedLimit(ctx, tx, userId, txType, currency)
+	if err != nil || !ok {
+		return err
+	}
+	rule := limit.Rule
+
+	if amount, err = s.convertForLimit(ctx, amount, currency, rule.Currency); err != nil {
+		return err
+	}
+	usage, err := s.getLimitUsage(ctx, tx, userId, txType, rule.Currency)
+	if err != nil {
+		return err
+	}
+	return exceededLimit(rule, usage, amount)
+}
+
+// exceededLimit reports the first of rule's limits a transaction of amount,
+// already in the rule's currency, would take usage past.
+func exceededLimit(rule config.LimitRule, usage limitUsage, amount int64) error {
+	switch {
+	case rule.PerTransaction > 0 && amount > rule.PerTransaction:
+		return &LimitError{Limit: "per_transaction", Max: rule.PerTransaction, Currency: rule.Currency, err: ErrPerTransactionLimit}
+	case rule.DailyVolume > 0 && usage.DailyVolume+amount > rule.DailyVolume:
+		return &LimitError{Limit: "daily_volume", Max: rule.DailyVolume, Remaining: rule.DailyVolume - usage.DailyVolume,
+			Currency: rule.Currency, err: ErrDailyLimit}
+	case rule.DailyCount > 0 && usage.DailyCount+1 > rule.DailyCount:
+		return &LimitError{Limit: "daily_count", Max: rule.DailyCount, err: ErrDailyLimit}
+	case rule.MonthlyVolume > 0 && usage.MonthlyVolume+amount > rule.MonthlyVolume:
+		return &LimitError{Limit: "monthly_volume", Max: rule.MonthlyVolume, Remaining: rule.MonthlyVolume - usage.MonthlyVolume,
+			Currency: rule.Currency, err: ErrMonthlyLimit}
+	case rule.MonthlyCount > 0 && usage.MonthlyCount+1 > rule.MonthlyCount:
+		return &LimitError{Limit: "monthly_count", Max: rule.MonthlyCount, err: ErrMonthlyLimit}
+	}
+	return nil
+}
+
+// LimitError tells which limit a transaction would exceed. It unwraps to
+// ErrPerTransactionLimit, ErrDailyLimit or ErrMonthlyLimit.
+type LimitError struct {
+	Limit     string // 'per_transaction', 'daily_volume', 'daily_count', ...
+	Max       int64
+	Remaining int64  // volume still available in the window
+	Currency  string // of Max and Remaining, for volume limits
+	err       error
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case "per_transaction":
+		return fmt.Sprintf("%v: at most %d %s per transaction", e.err, e.Max, e.Currency)
+	case "daily_count", "monthly_count":
+		return fmt.Sprintf("%v: at most %d transactions", e.err, e.Max)
+	}
+	return fmt.Sprintf("%v: %d of %d %s remaining", e.err, max(e.Remaining, 0), e.Max, e.Currency)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.err
+}
+
+// GetLimits reports the limits on the user's transactions in currency and
+// how much of each is left. A limit may be in another currency when the user
+// has none in this one. Types without a limit are left out.
+func (s *PaymentsStore) GetLimits(ctx context.Context, userId uuid.UUID, currency string) ([]models.LimitStatus, error) {
+	statuses := []models.LimitStatus{}
+
+	for _, txType := range limitedTypes {
+		limit, ok, err := s.getAppliedLimit(ctx, s.db, userId, txType, currency)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrUserIdNotFound
+			}
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		rule := limit.Rule
+
+		usage, err := s.getLimitUsage(ctx, s.db, userId, txType, rule.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, models.LimitStatus{
+			Type:           txType,
+			Currency:       rule.Currency,
+			Tier:           limit.Tier,
+			Override:       limit.Override,
+			PerTransaction: rule.PerTransaction,
+			DailyVolume:    allowance(rule.DailyVolume, usage.DailyVolume),
+			DailyCount:     allowance(rule.DailyCount, usage.DailyCount),
+			MonthlyVolume:  allowance(rule.MonthlyVolume, usage.MonthlyVolume),
+			MonthlyCount:   allowance(rule.MonthlyCount, usage.MonthlyCount),
+		})
+	}
+	return statuses, nil
+}
+
+func allowance(limit, used int64) *models.Allowance {
+	if limit == 0 {
+		return nil
+	}
+	return &models.Allowance{Limit: limit, Used: used, Remaining: max(limit-used, 0)}
+}
@@ -0,0 +1,151 @@
+package payments
+
+import (
+	"errors"
+	"paygo/config"
+	"paygo/models"
+	"testing"
+)
+
+func TestMatchLimitRule(t *testing.T) {
+	rules := []config.LimitRule{
+		{Type: "deposit", Currency: "USD", PerTransaction: 1},
+		{Type: "payment", Currency: "EUR", PerTransaction: 2},
+		{Type: "payment", Currency: "USD", PerTransaction: 3},
+		{Type: "payment", Currency: "GBP", PerTransaction: 4},
+	}
+
+	tests := []struct {
+		name     string
+		txType   string
+		currency string
+		want     int64 // PerTransaction of the matched rule
+		ok       bool
+	}{
+		{"exact currency", "payment", "USD", 3, true},
+		{"exact currency listed later", "payment", "GBP", 4, true},
+		{"other currency falls back to the first rule", "payment", "JPY", 2, true},
+		{"type with a single rule", "deposit", "EUR", 1, true},
+		{"type without rules", "withdrawal", "USD", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := matchLimitRule(rules, tt.txType, tt.currency)
+			if ok != tt.ok || rule.PerTransaction != tt.want {
+				t.Errorf("matchLimitRule(%s, %s) = rule %d, %t, want rule %d, %t",
+					tt.txType, tt.currency, rule.PerTransaction, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExceededLimit(t *testing.T) {
+	rule := config.LimitRule{
+		Currency:       "USD",
+		PerTransaction: 500,
+		DailyVolume:    1_000,
+		DailyCount:     3,
+		MonthlyVolume:  5_000,
+		MonthlyCount:   10,
+	}
+
+	tests := []struct {
+		name          string
+		rule          config.LimitRule
+		usage         limitUsage
+		amount        int64
+		wantLimit     string
+		wantErr       error
+		wantRemaining int64
+	}{
+		{"fresh user", rule, limitUsage{}, 500, "", nil, 0},
+		{"over per transaction", rule, limitUsage{}, 501, "per_transaction", ErrPerTransactionLimit, 0},
+		{"fills the day exactly", rule, limitUsage{DailyVolume: 500, DailyCount: 1, MonthlyVolume: 500, MonthlyCount: 1},
+			500, "", nil, 0},
+		{"one over the day", rule, limitUsage{DailyVolume: 501, DailyCount: 1, MonthlyVolume: 501, MonthlyCount: 1},
+			500, "daily_volume", ErrDailyLimit, 499},
+		{"day already past its volume", rule, limitUsage{DailyVolume: 1_200, DailyCount: 1, MonthlyVolume: 1_200, MonthlyCount: 1},
+			1, "daily_volume", ErrDailyLimit, -200},
+		{"last transaction of the day", rule, limitUsage{DailyVolume: 10, DailyCount: 2, MonthlyVolume: 10, MonthlyCount: 2},
+			10, "", nil, 0},
+		{"one transaction too many today", rule, limitUsage{DailyVolume: 10, DailyCount: 3, MonthlyVolume: 10, MonthlyCount: 3},
+			10, "daily_count", ErrDailyLimit, 0},
+		{"month volume", rule, limitUsage{MonthlyVolume: 4_800, MonthlyCount: 5},
+			300, "monthly_volume", ErrMonthlyLimit, 200},
+		{"month count", rule, limitUsage{MonthlyVolume: 100, MonthlyCount: 10},
+			10, "monthly_count", ErrMonthlyLimit, 0},
+		{"daily checked before monthly", rule, limitUsage{DailyVolume: 1_000, DailyCount: 3, MonthlyVolume: 5_000, MonthlyCount: 10},
+			10, "daily_volume", ErrDailyLimit, 0},
+		{"zero limits are unlimited", config.LimitRule{Currency: "USD"}, limitUsage{DailyVolume: 1 << 40, DailyCount: 1 << 20},
+			1 << 40, "", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exceededLimit(tt.rule, tt.usage, tt.amount)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("exceededLimit = %v, want nil", err)
+				}
+				return
+			}
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("exceededLimit = %v, want %v", err, tt.wantErr)
+			}
+			if limitErr.Limit != tt.wantLimit || limitErr.Remaining != tt.wantRemaining {
+				t.Errorf("exceededLimit = %s with %d remaining, want %s with %d remaining",
+					limitErr.Limit, limitErr.Remaining, tt.wantLimit, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestLimitErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *LimitError
+		want string
+	}{
+		{&LimitError{Limit: "per_transaction", Max: 500, Currency: "USD", err: ErrPerTransactionLimit},
+			"Amount exceeds the per-transaction limit: at most 500 USD per transaction"},
+		{&LimitError{Limit: "daily_count", Max: 3, err: ErrDailyLimit},
+			"Daily limit reached: at most 3 transactions"},
+		{&LimitError{Limit: "monthly_volume", Max: 5_000, Remaining: 200, Currency: "EUR", err: ErrMonthlyLimit},
+			"Monthly limit reached: 200 of 5000 EUR remaining"},
+		{&LimitError{Limit: "daily_volume", Max: 1_000, Remaining: -200, Currency: "USD", err: ErrDailyLimit},
+			"Daily limit reached: 0 of 1000 USD remaining"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Limit, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowance(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64
+		used  int64
+		want  *models.Allowance
+	}{
+		{"unlimited", 0, 100, nil},
+		{"partly used", 1_000, 400, &models.Allowance{Limit: 1_000, Used: 400, Remaining: 600}},
+		{"used up", 1_000, 1_000, &models.Allowance{Limit: 1_000, Used: 1_000, Remaining: 0}},
+		{"overdrawn by a lowered limit", 1_000, 1_500, &models.Allowance{Limit: 1_000, Used: 1_500, Remaining: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allowance(tt.limit, tt.used)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("allowance(%d, %d) = %+v, want %+v", tt.limit, tt.used, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type PayoutRequest struct {
+	WithdrawalID uuid.UUID
+	Amount       int64
+	Currency     string
+	Destination  string
+}
+
+// PayoutProcessor sends held withdrawal funds to the external destination
+// (bank account, card, ...). It returns the provider's reference for the payout.
+// Payout must be idempotent on WithdrawalID: a withdrawal whose settlement was
+// interrupted is paid out again, and the provider is expected to return the
+// original reference instead of sending the money twice.
+type PayoutProcessor interface {
+	Payout(ctx context.Context, req PayoutRequest) (reference string, err error)
+}
+
+// FakePayoutProcessor settles every payout locally without talking to a
+// provider. Destinations starting with "fail" are rejected so the failure path
+// can be exercised end to end.
+type FakePayoutProcessor struct{}
+
+func NewFakePayoutProcessor() *FakePayoutProcessor {
+	return &FakePayoutProcessor{}
+}
+
+func (f *FakePayoutProcessor) Payout(ctx context.Context, req PayoutRequest) (string, error) {
+	if strings.HasPrefix(req.Destination, "fail") {
+		return "", errors.New("payout rejected by destination")
+	}
+	return "fake_" + req.WithdrawalID.String(), nil
+}
@@ -0,0 +1,361 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"paygo/fraud"
+	"paygo/ledger"
+	"paygo/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// holdFunds takes a held payment's amount and fee off the sender's wallet into
+// system:holds, under a pending payment transaction that is completed or
+// failed once the payment is reviewed.
+func holdFunds(ctx context.Context, tx pgx.Tx, newPayment *models.PaymentInsert, senderWalletId, receiverWalletId uuid.UUID) (transactionId uuid.UUID, err error) {
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, currency, status, type)
+		VALUES ($1, $2, $3, $4, 'pending', 'payment')
+		RETURNING id
+	`, senderWalletId, receiverWalletId, newPayment.Amount, newPayment.Currency).Scan(&transactionId)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create held transaction: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: transactionId,
+		Description:   "payment held for review",
+		Postings: []ledger.Posting{
+			ledger.WalletPosting(senderWalletId, -newPayment.Amount),
+			ledger.SystemPosting(ledger.AccountHolds, newPayment.Currency, newPayment.Amount),
+		},
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to record hold in ledger: %w", err)
+	}
+
+	err = chargeFee(ctx, tx, senderWalletId, newPayment.Currency, newPayment.Fee, transactionId, ledger.AccountHolds)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return transactionId, nil
+}
+
+const reviewColumns = `
+	p.id, p.sender_id, p.receiver_id, p.amount, p.currency, p.status, COALESCE(f.score, 0),
+	r.due_at, r.claimed_by, r.claimed_at, r.decision, r.reason, r.decided_by, r.decided_at, p.created_at
+	FROM payment_reviews r
+	JOIN payments p ON p.id = r.payment_id
+	LEFT JOIN fraud_decisions f ON f.payment_id = r.payment_id`
+
+func scanReview(row pgx.Row) (review models.PaymentReview, err error) {
+	err = row.Scan(&review.PaymentID, &review.SenderID, &review.ReceiverID, &review.Amount, &review.Currency,
+		&review.Status, &review.FraudScore, &review.DueAt, &review.ClaimedBy, &review.ClaimedAt,
+		&review.Decision, &review.Reason, &review.DecidedBy, &review.DecidedAt, &review.CreatedAt)
+	return review, err
+}
+
+func (s *PaymentsStore) getReview(ctx context.Context, paymentId uuid.UUID) (models.PaymentReview, error) {
+	review, err := scanReview(s.db.QueryRow(ctx, `SELECT `+reviewColumns+` WHERE r.payment_id = $1`, paymentId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PaymentReview{}, ErrReviewNotFound
+	}
+	if err != nil {
+		return models.PaymentReview{}, fmt.Errorf("failed to get review: %w", err)
+	}
+	return review, nil
+}
+
+// ListReviews returns reviews whose payment is in status, or every open one
+// when status is empty, soonest due first.
+func (s *PaymentsStore) ListReviews(ctx context.Context, status string, limit int) ([]models.PaymentReview, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+reviewColumns+`
+		WHERE CASE WHEN $1 = '' THEN r.decision IS NULL ELSE p.status = $1 END
+		ORDER BY r.due_at, p.id
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []models.PaymentReview{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// heldPayment is a payment under review, read with it and its review locked.
+type heldPayment struct {
+	ID            uuid.UUID
+	SenderID      uuid.UUID
+	ReceiverID    uuid.UUID
+	Status        string
+	Amount        int64
+	Currency      string
+	TransactionID uuid.UUID
+	ClaimedBy     *uuid.UUID
+}
+
+// lockHeldPayments locks payments and their reviews in the same order
+// wherever a review changes, so deciding and expiring can't deadlock.
+const lockHeldPayments = `
+	SELECT p.id, p.sender_id, p.receiver_id, p.status, p.amount, p.currency, p.transaction_id, r.claimed_by
+	FROM payments p
+	JOIN payment_reviews r ON r.payment_id = p.id`
+
+func lockHeldPayment(ctx context.Context, tx pgx.Tx, paymentId uuid.UUID) (held heldPayment, err error) {
+	err = tx.QueryRow(ctx, lockHeldPayments+`
+		WHERE p.id = $1
+		FOR UPDATE OF p, r
+	`, paymentId).Scan(&held.ID, &held.SenderID, &held.ReceiverID, &held.Status, &held.Amount, &held.Currency, &held.TransactionID, &held.ClaimedBy)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return heldPayment{}, ErrReviewNotFound
+	}
+	if err != nil {
+		return heldPayment{}, fmt.Errorf("failed to lock held payment: %w", err)
+	}
+	if held.Status != "held" && held.Status != "in_review" {
+		return heldPayment{}, ErrReviewClosed
+	}
+	return held, nil
+}
+
+// involves reports whether the user is a party to the held payment, who may
+// then not review it.
+func (held heldPayment) involves(userId uuid.UUID) bool {
+	return userId == held.SenderID || userId == held.ReceiverID
+}
+
+// ClaimReview assigns a held payment to the reviewer and puts it in review.
+// Claiming a review the reviewer already holds is a no-op. Reviewers can't
+// claim payments they sent or received.
+func (s *PaymentsStore) ClaimReview(ctx context.Context, paymentId, reviewerId uuid.UUID) (models.PaymentReview, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.PaymentReview{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	held, err := lockHeldPayment(ctx, tx, paymentId)
+	if err != nil {
+		return models.PaymentReview{}, err
+	}
+	if held.involves(reviewerId) {
+		return models.PaymentReview{}, ErrSelfReview
+	}
+	if held.ClaimedBy != nil && *held.ClaimedBy != reviewerId {
+		return models.PaymentReview{}, ErrReviewClaimed
+	}
+
+	if held.ClaimedBy == nil {
+		batch := &pgx.Batch{}
+		batch.Queue(`UPDATE payments SET status = 'in_review' WHERE id = $1`, paymentId)
+		batch.Queue(`
+			UPDATE payment_reviews SET claimed_by = $2, claimed_at = CURRENT_TIMESTAMP
+			WHERE payment_id = $1
+		`, paymentId, reviewerId)
+
+		if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+			return models.PaymentReview{}, fmt.Errorf("failed to claim review: %w", err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return models.PaymentReview{}, fmt.Errorf("failed to commit claim: %w", err)
+		}
+	}
+	return s.getReview(ctx, paymentId)
+}
+
+// DecideReview approves or rejects a payment the reviewer has claimed.
+// Approving releases the held funds to the receiver; rejecting returns them,
+// fee included, to the sender.
+func (s *PaymentsStore) DecideReview(ctx context.Context, paymentId, reviewerId uuid.UUID, approve bool, reason string) (models.PaymentReview, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.PaymentReview{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	held, err := lockHeldPayment(ctx, tx, paymentId)
+	if err != nil {
+		return models.PaymentReview{}, err
+	}
+	if held.involves(reviewerId) {
+		return models.PaymentReview{}, ErrSelfReview
+	}
+	if held.ClaimedBy == nil || *held.ClaimedBy != reviewerId {
+		return models.PaymentReview{}, ErrReviewNotClaimed
+	}
+
+	decision := "rejected"
+	if approve {
+		decision = "approved"
+	}
+	if err = s.settleHeldPayment(ctx, tx, held, approve); err != nil {
+		return models.PaymentReview{}, err
+	}
+	if err = closeReview(ctx, tx, paymentId, decision, reason, &reviewerId); err != nil {
+		return models.PaymentReview{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.PaymentReview{}, fmt.Errorf("failed to commit review decision: %w", err)
+	}
+	return s.getReview(ctx, paymentId)
+}
+
+// ExpireReview returns the funds of the open review furthest past its due
+// time. It reports false when no review is overdue. Reviews being decided
+// right now are skipped rather than waited for.
+func (s *PaymentsStore) ExpireReview(ctx context.Context) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var held heldPayment
+	err = tx.QueryRow(ctx, lockHeldPayments+`
+		WHERE r.decision IS NULL AND r.due_at < CURRENT_TIMESTAMP
+		ORDER BY r.due_at
+		LIMIT 1
+		FOR UPDATE OF p, r SKIP LOCKED
+	`).Scan(&held.ID, &held.SenderID, &held.ReceiverID, &held.Status, &held.Amount, &held.Currency, &held.TransactionID, &held.ClaimedBy)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock overdue review: %w", err)
+	}
+
+	if err = s.settleHeldPayment(ctx, tx, held, false); err != nil {
+		return false, err
+	}
+	if err = closeReview(ctx, tx, held.ID, "expired", "not reviewed in time", nil); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit expired review: %w", err)
+	}
+	return true, nil
+}
+
+// settleHeldPayment moves the held funds out of system:holds, to the receiver
+// when release is set and back to the sender otherwise, and completes or
+// fails the payment and its transaction accordingly. Funds are only released
+// between accounts that could still make the payment. Funds returned to a
+// sender whose account has since been closed go to system:suspense instead.
+func (s *PaymentsStore) settleHeldPayment(ctx context.Context, tx pgx.Tx, held heldPayment, release bool) error {
+	err := lockWallets(ctx, tx, `id IN (SELECT unnest(ARRAY[from_wallet_id, to_wallet_id]) FROM transactions WHERE id = $1)`,
+		held.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	var sender, receiver walletState
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT %s, %s
+		FROM transactions t
+		JOIN wallets w1 ON w1.id = t.from_wallet_id JOIN users u1 ON u1.id = w1.user_id
+		JOIN wallets w2 ON w2.id = t.to_wallet_id JOIN users u2 ON u2.id = w2.user_id
+		WHERE t.id = $1
+		FOR SHARE OF u1, u2
+	`, walletStateColumns("w1", "u1"), walletStateColumns("w2", "u2")), held.TransactionID).Scan(
+		append(sender.scanTargets(), receiver.scanTargets()...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock held payment wallets: %w", err)
+	}
+
+	entry := ledger.Entry{TransactionID: held.TransactionID, Description: "held payment returned"}
+	status := "failed"
+	senderClosed := sender.UserStatus == "closed" || sender.WalletStatus == "closed"
+	if release {
+		if reason := sender.sendBlock(); reason != "" {
+			return s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+				UserID: sender.UserID, WalletID: sender.WalletID, Action: "send", Amount: held.Amount, Reason: reason,
+			}, ErrReviewAccountBlocked)
+		}
+		if reason := receiver.receiveBlock(); reason != "" {
+			return s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+				UserID: receiver.UserID, WalletID: receiver.WalletID, Action: "receive", Amount: held.Amount, Reason: reason,
+			}, ErrReviewAccountBlocked)
+		}
+		entry.Description = "held payment released"
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountHolds, held.Currency, -held.Amount),
+			ledger.WalletPosting(receiver.WalletID, held.Amount),
+		}
+		status = "completed"
+	} else if senderClosed {
+		entry.Description = "held payment moved to suspense"
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountHolds, held.Currency, -held.Amount),
+			ledger.SystemPosting(ledger.AccountSuspense, held.Currency, held.Amount),
+		}
+	} else {
+		entry.Postings = []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountHolds, held.Currency, -held.Amount),
+			ledger.WalletPosting(sender.WalletID, held.Amount),
+		}
+	}
+
+	if _, err = ledger.Record(ctx, tx, entry); err != nil {
+		return fmt.Errorf("failed to settle held payment in ledger: %w", err)
+	}
+	if err = settleFee(ctx, tx, held.TransactionID, ledger.AccountHolds, release, !release && senderClosed); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE transactions SET status = $2 WHERE id = $1`, held.TransactionID, status)
+	batch.Queue(`UPDATE payments SET status = $2 WHERE id = $1`, held.ID, status)
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to settle held payment: %w", err)
+	}
+	if senderClosed && !release {
+		log.Printf("store: held payment %s moved to suspense, sender wallet %s is closed", held.ID, sender.WalletID)
+	}
+	return nil
+}
+
+// closeReview records the decision on the review and carries it over to the
+// payment's fraud decision, which turns from hold into allow or block.
+func closeReview(ctx context.Context, tx pgx.Tx, paymentId uuid.UUID, decision, reason string, decidedBy *uuid.UUID) error {
+	action := fraud.ActionBlock
+	if decision == "approved" {
+		action = fraud.ActionAllow
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		UPDATE payment_reviews
+		SET decision = $2, reason = NULLIF($3, ''), decided_by = $4, decided_at = CURRENT_TIMESTAMP
+		WHERE payment_id = $1
+	`, paymentId, decision, reason, decidedBy)
+	batch.Queue(`
+		UPDATE fraud_decisions
+		SET action = $2, review = $3, reviewed_at = CURRENT_TIMESTAMP
+		WHERE payment_id = $1
+	`, paymentId, action, decision)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to close review: %w", err)
+	}
+	return nil
+}
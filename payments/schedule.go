@@ -0,0 +1,326 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/idempotency"
+	"paygo/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// occurrenceAt returns when occurrence n, counting from 0, of a schedule
+// falls due, and false if the schedule ends before it.
+func occurrenceAt(schedule models.ScheduledPaymentInsert, n int) (time.Time, bool) {
+	if schedule.MaxRuns != nil && n >= *schedule.MaxRuns {
+		return time.Time{}, false
+	}
+
+	var at time.Time
+	switch schedule.Frequency {
+	case "once":
+		if n > 0 {
+			return time.Time{}, false
+		}
+		at = schedule.StartAt
+	case "daily":
+		at = schedule.StartAt.AddDate(0, 0, n*schedule.Interval)
+	case "weekly":
+		at = schedule.StartAt.AddDate(0, 0, 7*n*schedule.Interval)
+	case "monthly":
+		at = addMonths(schedule.StartAt, n*schedule.Interval)
+	default:
+		return time.Time{}, false
+	}
+
+	if schedule.EndAt != nil && at.After(*schedule.EndAt) {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// addMonths moves t by months, keeping its day of the month where the
+// target month has it and using the month's last day otherwise, so a
+// schedule starting on the 31st pays on the 30th in April and stays on the
+// 31st in May.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// ScheduleClaim is a due scheduled payment a worker has leased. Key is the
+// idempotency key of the occurrence; PaidPaymentID is set when a previous
+// attempt already made its payment but died before recording it.
+type ScheduleClaim struct {
+	Schedule      models.ScheduledPayment
+	Token         uuid.UUID
+	Key           string
+	PaidPaymentID *uuid.UUID
+}
+
+const scheduleColumns = `id, sender_id, receiver_id, amount, currency, note, frequency, interval_count,
+	start_at, end_at, max_runs, status, next_run_at, occurrences, attempts, retry_at,
+	last_payment_id, last_error, created_at, updated_at`
+
+func scanSchedule(row pgx.Row) (s models.ScheduledPayment, err error) {
+	err = row.Scan(&s.ID, &s.SenderID, &s.ReceiverID, &s.Amount, &s.Currency, &s.Note, &s.Frequency, &s.Interval,
+		&s.StartAt, &s.EndAt, &s.MaxRuns, &s.Status, &s.NextRunAt, &s.Occurrences, &s.Attempts, &s.RetryAt,
+		&s.LastPaymentID, &s.LastError, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func (s *PaymentsStore) CreateSchedule(ctx context.Context, schedule *models.ScheduledPaymentInsert) (models.ScheduledPayment, error) {
+	created, err := scanSchedule(s.db.QueryRow(ctx, `
+		INSERT INTO scheduled_payments (sender_id, receiver_id, amount, currency, note, frequency, interval_count,
+			start_at, end_at, max_runs, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $8)
+		RETURNING `+scheduleColumns,
+		schedule.SenderID, schedule.ReceiverID, schedule.Amount, schedule.Currency, schedule.Note,
+		schedule.Frequency, schedule.Interval, schedule.StartAt, schedule.EndAt, schedule.MaxRuns))
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return models.ScheduledPayment{}, ErrUserIdNotFound
+	}
+	if err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to create scheduled payment: %w", err)
+	}
+	return created, nil
+}
+
+// GetSchedules returns the user's scheduled payments, newest first.
+func (s *PaymentsStore) GetSchedules(ctx context.Context, senderId uuid.UUID) ([]models.ScheduledPayment, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+scheduleColumns+`
+		FROM scheduled_payments
+		WHERE sender_id = $1
+		ORDER BY created_at DESC, id
+	`, senderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled payments: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []models.ScheduledPayment{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled payment: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled payments: %w", err)
+	}
+	return schedules, nil
+}
+
+// PauseSchedule stops an active schedule from running until it is resumed.
+func (s *PaymentsStore) PauseSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.changeSchedule(ctx, scheduleId, senderId, func(tx pgx.Tx, schedule models.ScheduledPayment) error {
+		if schedule.Status != "active" {
+			return ErrScheduleNotActive
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE scheduled_payments SET status = 'paused', updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		`, scheduleId)
+		return err
+	})
+}
+
+// ResumeSchedule reactivates a paused schedule. Occurrences of a recurring
+// schedule that fell due while it was paused are skipped rather than paid
+// all at once; a one-off payment whose date passed is made right away.
+func (s *PaymentsStore) ResumeSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.changeSchedule(ctx, scheduleId, senderId, func(tx pgx.Tx, schedule models.ScheduledPayment) error {
+		if schedule.Status != "paused" {
+			return ErrScheduleNotPaused
+		}
+
+		occurrences, nextRunAt := schedule.Occurrences, schedule.NextRunAt
+		if schedule.Frequency != "once" {
+			now := time.Now().UTC()
+			for nextRunAt != nil && nextRunAt.Before(now) {
+				occurrences++
+				nextRunAt = nil
+				if at, ok := occurrenceAt(schedule.ScheduledPaymentInsert, occurrences); ok {
+					nextRunAt = &at
+				}
+			}
+		}
+
+		status := "active"
+		if nextRunAt == nil {
+			status = "completed"
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE scheduled_payments
+			SET status = $2, occurrences = $3, next_run_at = $4, attempts = 0, retry_at = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, scheduleId, status, occurrences, nextRunAt)
+		return err
+	})
+}
+
+// CancelSchedule ends a schedule for good. A payment a worker is executing
+// at that moment still completes.
+func (s *PaymentsStore) CancelSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.changeSchedule(ctx, scheduleId, senderId, func(tx pgx.Tx, schedule models.ScheduledPayment) error {
+		if schedule.Status != "active" && schedule.Status != "paused" {
+			return ErrScheduleEnded
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE scheduled_payments
+			SET status = 'cancelled', next_run_at = NULL, retry_at = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, scheduleId)
+		return err
+	})
+}
+
+// changeSchedule locks one of the sender's schedules, lets apply change it
+// and returns it as it is afterwards.
+func (s *PaymentsStore) changeSchedule(ctx context.Context, scheduleId, senderId uuid.UUID,
+	apply func(tx pgx.Tx, schedule models.ScheduledPayment) error) (models.ScheduledPayment, error) {
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	schedule, err := scanSchedule(tx.QueryRow(ctx, `
+		SELECT `+scheduleColumns+` FROM scheduled_payments WHERE id = $1 AND sender_id = $2 FOR UPDATE
+	`, scheduleId, senderId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ScheduledPayment{}, ErrScheduleNotFound
+	}
+	if err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to lock scheduled payment: %w", err)
+	}
+
+	if err = apply(tx, schedule); err != nil {
+		if errors.Is(err, ErrScheduleNotActive) || errors.Is(err, ErrScheduleNotPaused) || errors.Is(err, ErrScheduleEnded) {
+			return models.ScheduledPayment{}, err
+		}
+		return models.ScheduledPayment{}, fmt.Errorf("failed to update scheduled payment: %w", err)
+	}
+
+	schedule, err = scanSchedule(tx.QueryRow(ctx, `SELECT `+scheduleColumns+` FROM scheduled_payments WHERE id = $1`, scheduleId))
+	if err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to read scheduled payment: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.ScheduledPayment{}, fmt.Errorf("failed to commit scheduled payment: %w", err)
+	}
+	return schedule, nil
+}
+
+// ClaimDueSchedule leases the most overdue active schedule to the caller for
+// lease. SKIP LOCKED lets several workers claim different schedules at
+// once, and a worker that dies loses its lease so another can take over.
+//
+// The occurrence's idempotency key is reserved too. The payment binds it in
+// its own transaction, so whichever worker runs an occurrence, it is paid at
+// most once.
+func (s *PaymentsStore) ClaimDueSchedule(ctx context.Context, lease time.Duration) (claim ScheduleClaim, ok bool, err error) {
+	claim.Token = uuid.New()
+	claim.Schedule, err = scanSchedule(s.db.QueryRow(ctx, `
+		UPDATE scheduled_payments
+		SET claim_token = $1, claimed_until = CURRENT_TIMESTAMP + $2::interval
+		WHERE id = (
+			SELECT id
+			FROM scheduled_payments
+			WHERE status = 'active'
+				AND COALESCE(retry_at, next_run_at) <= CURRENT_TIMESTAMP
+				AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY COALESCE(retry_at, next_run_at)
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduleColumns,
+		claim.Token, lease))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ScheduleClaim{}, false, nil
+	}
+	if err != nil {
+		return ScheduleClaim{}, false, fmt.Errorf("failed to claim scheduled payment: %w", err)
+	}
+
+	claim.Key = fmt.Sprintf("%s%s:%d", idempotency.SchedulePrefix, claim.Schedule.ID, claim.Schedule.Occurrences)
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO UPDATE SET locked_at = CURRENT_TIMESTAMP
+		RETURNING resource_id
+	`, claim.Schedule.SenderID, claim.Key, claim.Schedule.ID.String()).Scan(&claim.PaidPaymentID)
+	if err != nil {
+		return ScheduleClaim{}, false, fmt.Errorf("failed to reserve scheduled payment key: %w", err)
+	}
+	return claim, true, nil
+}
+
+// FinishOccurrence moves a claimed schedule past its current occurrence,
+// paid or given up on, and releases it. Without a next occurrence the
+// schedule ends as endStatus, unless it was cancelled meanwhile. It reports
+// false if the claim was lost to another worker.
+func (s *PaymentsStore) FinishOccurrence(ctx context.Context, claim ScheduleClaim, paymentId *uuid.UUID,
+	lastError string, nextRunAt *time.Time, endStatus string) (bool, error) {
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE scheduled_payments
+		SET occurrences = occurrences + 1,
+			next_run_at = CASE WHEN status = 'cancelled' THEN NULL ELSE $3 END,
+			status = CASE WHEN $3::timestamp IS NULL AND status IN ('active', 'paused') THEN $6 ELSE status END,
+			attempts = 0,
+			retry_at = NULL,
+			last_payment_id = COALESCE($4, last_payment_id),
+			last_error = NULLIF($5, ''),
+			claim_token = NULL,
+			claimed_until = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND claim_token = $2
+	`, claim.Schedule.ID, claim.Token, nextRunAt, paymentId, lastError, endStatus)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance scheduled payment: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RetryOccurrence records a failed attempt at a claimed schedule's current
+// occurrence and releases it until retryIn has passed.
+func (s *PaymentsStore) RetryOccurrence(ctx context.Context, claim ScheduleClaim, retryIn time.Duration, lastError string) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE scheduled_payments
+		SET attempts = attempts + 1,
+			retry_at = CURRENT_TIMESTAMP + $3::interval,
+			last_error = $4,
+			claim_token = NULL,
+			claimed_until = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND claim_token = $2
+	`, claim.Schedule.ID, claim.Token, retryIn, lastError)
+	if err != nil {
+		return false, fmt.Errorf("failed to schedule retry: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseSchedule gives up a claim without recording anything.
+func (s *PaymentsStore) ReleaseSchedule(ctx context.Context, claim ScheduleClaim) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE scheduled_payments
+		SET claim_token = NULL, claimed_until = NULL
+		WHERE id = $1 AND claim_token = $2
+	`, claim.Schedule.ID, claim.Token)
+	if err != nil {
+		return fmt.Errorf("failed to release scheduled payment: %w", err)
+	}
+	return nil
+}
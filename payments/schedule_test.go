@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"paygo/models"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{"same day next month", date(2025, time.March, 15), 1, date(2025, time.April, 15)},
+		{"31st into 30-day month", date(2025, time.March, 31), 1, date(2025, time.April, 30)},
+		{"31st into February", date(2025, time.January, 31), 1, date(2025, time.February, 28)},
+		{"31st into leap February", date(2024, time.January, 31), 1, date(2024, time.February, 29)},
+		{"29th of leap February a year on", date(2024, time.February, 29), 12, date(2025, time.February, 28)},
+		{"across the year end", date(2025, time.December, 31), 2, date(2026, time.February, 28)},
+		{"back into February", date(2025, time.March, 31), -1, date(2025, time.February, 28)},
+		{"no months", date(2025, time.May, 31), 0, date(2025, time.May, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+				t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from.Format(time.DateTime), tt.months,
+					got.Format(time.DateTime), tt.want.Format(time.DateTime))
+			}
+		})
+	}
+}
+
+func TestOccurrenceAt(t *testing.T) {
+	runs := 3
+	end := date(2025, time.March, 31)
+
+	tests := []struct {
+		name     string
+		schedule models.ScheduledPaymentInsert
+		n        int
+		want     time.Time
+		ok       bool
+	}{
+		{"once", models.ScheduledPaymentInsert{Frequency: "once", StartAt: date(2025, time.January, 10)},
+			0, date(2025, time.January, 10), true},
+		{"once has no second occurrence", models.ScheduledPaymentInsert{Frequency: "once", StartAt: date(2025, time.January, 10)},
+			1, time.Time{}, false},
+		{"every 3 days", models.ScheduledPaymentInsert{Frequency: "daily", Interval: 3, StartAt: date(2025, time.January, 30)},
+			2, date(2025, time.February, 5), true},
+		{"every 2 weeks", models.ScheduledPaymentInsert{Frequency: "weekly", Interval: 2, StartAt: date(2025, time.January, 1)},
+			3, date(2025, time.February, 12), true},
+		{"monthly from the 31st clamps", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 1, StartAt: date(2025, time.January, 31)},
+			1, date(2025, time.February, 28), true},
+		{"monthly from the 31st returns to the 31st", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 1, StartAt: date(2025, time.January, 31)},
+			2, date(2025, time.March, 31), true},
+		{"quarterly counts interval times n months", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 3, StartAt: date(2024, time.November, 30)},
+			1, date(2025, time.February, 28), true},
+		{"quarterly from the start, not the clamped date", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 3, StartAt: date(2024, time.November, 30)},
+			2, date(2025, time.May, 30), true},
+		{"last of max runs", models.ScheduledPaymentInsert{Frequency: "daily", Interval: 1, StartAt: date(2025, time.January, 1), MaxRuns: &runs},
+			2, date(2025, time.January, 3), true},
+		{"past max runs", models.ScheduledPaymentInsert{Frequency: "daily", Interval: 1, StartAt: date(2025, time.January, 1), MaxRuns: &runs},
+			3, time.Time{}, false},
+		{"on the end date", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 1, StartAt: date(2025, time.January, 31), EndAt: &end},
+			2, date(2025, time.March, 31), true},
+		{"after the end date", models.ScheduledPaymentInsert{Frequency: "monthly", Interval: 1, StartAt: date(2025, time.January, 31), EndAt: &end},
+			3, time.Time{}, false},
+		{"unknown frequency", models.ScheduledPaymentInsert{Frequency: "yearly", Interval: 1, StartAt: date(2025, time.January, 1)},
+			0, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := occurrenceAt(tt.schedule, tt.n)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("occurrenceAt(%d) = %s, %t, want %s, %t", tt.n,
+					got.Format(time.DateTime), ok, tt.want.Format(time.DateTime), tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"paygo/screening"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// screenReceiver refuses a payment to a user matching the sanctions
+// watchlist until compliance clears them. It runs before the payment locks
+// any wallet, so matching against the watchlist doesn't hold up other
+// payments. Like a status block it rolls tx back, then records the attempt
+// and the hits. The payer only learns the receiver can't accept funds, so a
+// match isn't disclosed to them.
+func (s *PaymentsStore) screenReceiver(ctx context.Context, tx pgx.Tx, senderId, receiverId uuid.UUID, code string, amount int64) error {
+	name, matches, err := s.screener.ScreenUser(ctx, s.db, receiverId)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// Without a wallet in the currency the payment fails as for anyone else.
+	var walletId uuid.UUID
+	err = s.db.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id = $1 AND currency = $2`, receiverId, code).Scan(&walletId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get screened receiver wallet: %w", err)
+	}
+
+	err = s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+		UserID: receiverId, WalletID: walletId, Action: "receive", Amount: amount, Reason: "screening",
+	}, ErrCounterpartyUnavailable)
+
+	hits := make([]screening.Hit, len(matches))
+	for i, match := range matches {
+		hits[i] = screening.Hit{
+			Match:        match,
+			UserID:       receiverId,
+			Context:      "payment",
+			InitiatorID:  &senderId,
+			ScreenedName: name,
+		}
+	}
+	if dbErr := screening.RecordHits(context.WithoutCancel(ctx), s.db, hits); dbErr != nil {
+		log.Printf("store: failed to record screening hits on user %s: %v", receiverId, dbErr)
+	}
+	return err
+}
@@ -2,75 +2,609 @@ package payments
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"paygo/config"
+	"paygo/currency"
+	"paygo/idempotency"
 	"paygo/models"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type PaymentStoreInterface interface {
-	GetAllPayments(ctx context.Context) ([]models.Payment, error)
-	GetPaymentsByUserId(ctx context.Context, userId uuid.UUID) (payments []models.PaymentWithNames, err error)
-	InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (uuid.UUID, error)
-	ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) error
+	GetAllPayments(ctx context.Context, filter models.PaymentFilter) ([]models.Payment, error)
+	GetPaymentsByUserId(ctx context.Context, userId uuid.UUID, filter models.PaymentFilter) (payments []models.PaymentWithNames, err error)
+	InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (models.Payment, error)
+	ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) (uuid.UUID, error)
+	CreateWithdrawal(ctx context.Context, withdrawal *models.WithdrawalInsert) (models.Withdrawal, error)
+	CompleteWithdrawal(ctx context.Context, withdrawalId uuid.UUID, payoutReference string) error
+	FailWithdrawal(ctx context.Context, withdrawalId uuid.UUID, reason string) error
+	RecordPayoutReference(ctx context.Context, withdrawalId uuid.UUID, payoutReference string) error
+	ClaimStaleWithdrawal(ctx context.Context, staleAfter time.Duration) (models.Withdrawal, bool, error)
+	GetWithdrawal(ctx context.Context, withdrawalId uuid.UUID) (models.Withdrawal, error)
+	RefundPayment(ctx context.Context, refund *models.RefundInsert) (models.Refund, error)
+	ConvertCurrency(ctx context.Context, userId, quoteId uuid.UUID) (models.Conversion, error)
+	GetLimits(ctx context.Context, userId uuid.UUID, currency string) ([]models.LimitStatus, error)
+	GetFraudDecision(ctx context.Context, paymentId uuid.UUID) (models.FraudDecision, error)
+	ListReviews(ctx context.Context, status string, limit int) ([]models.PaymentReview, error)
+	ClaimReview(ctx context.Context, paymentId, reviewerId uuid.UUID) (models.PaymentReview, error)
+	DecideReview(ctx context.Context, paymentId, reviewerId uuid.UUID, approve bool, reason string) (models.PaymentReview, error)
+	ExpireReview(ctx context.Context) (bool, error)
+	CreateSchedule(ctx context.Context, schedule *models.ScheduledPaymentInsert) (models.ScheduledPayment, error)
+	GetSchedules(ctx context.Context, senderId uuid.UUID) ([]models.ScheduledPayment, error)
+	PauseSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+	ResumeSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+	CancelSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error)
+	ClaimDueSchedule(ctx context.Context, lease time.Duration) (ScheduleClaim, bool, error)
+	FinishOccurrence(ctx context.Context, claim ScheduleClaim, paymentId *uuid.UUID, lastError string, nextRunAt *time.Time, endStatus string) (bool, error)
+	RetryOccurrence(ctx context.Context, claim ScheduleClaim, retryIn time.Duration, lastError string) (bool, error)
+	ReleaseSchedule(ctx context.Context, claim ScheduleClaim) error
 }
 
 type PaymentService struct {
-	store PaymentStoreInterface
+	store       PaymentStoreInterface
+	payouts     PayoutProcessor
+	fees        config.FeeSchedule
+	schedules   config.ScheduleConfig
+	withdrawals config.WithdrawalConfig
 }
 
-func NewPaymentService(store PaymentStoreInterface) *PaymentService {
-	return &PaymentService{store: store}
+func NewPaymentService(store PaymentStoreInterface, payouts PayoutProcessor, fees config.FeeSchedule,
+	schedules config.ScheduleConfig, withdrawals config.WithdrawalConfig) *PaymentService {
+	return &PaymentService{store: store, payouts: payouts, fees: fees, schedules: schedules, withdrawals: withdrawals}
 }
 
-func (s *PaymentService) GetAllPayments(ctx context.Context) ([]models.Payment, error) {
-	payments, err := s.store.GetAllPayments(ctx)
+func (s *PaymentService) GetAllPayments(ctx context.Context, filter models.PaymentFilter) (models.Page[models.Payment], error) {
+	payments, err := s.store.GetAllPayments(ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("service: failed to fetch payments %v", err.Error())
+		return models.Page[models.Payment]{}, fmt.Errorf("service: failed to fetch payments %v", err.Error())
 	}
 
-	if len(payments) == 0 {
-		return nil, ErrNoPaymentsFound
+	return paginate(payments, filter.Limit, func(p models.Payment) models.PaymentCursor {
+		return models.PaymentCursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	}), nil
+}
+
+func (s *PaymentService) InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (payment models.Payment, err error) {
+	if newP.Currency, err = normalizeCurrency(newP.Currency); err != nil {
+		return models.Payment{}, err
 	}
 
-	return payments, nil
-}
+	fees := priceTransaction(s.fees, "payment", newP.Currency, newP.Amount)
+	newP.Fee = fees.Fee
 
-func (s *PaymentService) InsertNewPayment(ctx context.Context, newP *models.PaymentInsert) (newPaymentId uuid.UUID, err error) {
-	newPaymentId, err = s.store.InsertNewPayment(ctx, newP)
+	payment, err = s.store.InsertNewPayment(ctx, newP)
 	if err != nil {
-		return uuid.Nil, err
+		return models.Payment{}, err
+	}
+	if payment.Status == "blocked" {
+		return models.Payment{}, ErrPaymentBlocked
 	}
 
-	return newPaymentId, nil
+	payment.Fees = &fees
+	return payment, nil
 }
 
-func (s *PaymentService) GetPaymentsByUserId(ctx context.Context, userId uuid.UUID) (
-	payments []models.PaymentWithNames, err error) {
+func (s *PaymentService) GetPaymentsByUserId(ctx context.Context, userId uuid.UUID, filter models.PaymentFilter) (
+	models.Page[models.PaymentWithNames], error) {
 
-	payments, err = s.store.GetPaymentsByUserId(ctx, userId)
+	payments, err := s.store.GetPaymentsByUserId(ctx, userId, filter)
 	if err != nil {
-		return nil, fmt.Errorf("service: error querying payments: %v", err)
-	}
-	if len(payments) == 0 {
-		return nil, ErrNoPaymentsFound
+		return models.Page[models.PaymentWithNames]{}, fmt.Errorf("service: error querying payments: %v", err)
 	}
 
-	return payments, nil
+	return paginate(payments, filter.Limit, func(p models.PaymentWithNames) models.PaymentCursor {
+		return models.PaymentCursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	}), nil
+}
 
+// paginate trims the extra row the store fetched past limit and turns the
+// last returned row into the next cursor when there is another page.
+func paginate[T any](rows []T, limit int, cursorOf func(T) models.PaymentCursor) models.Page[T] {
+	page := models.Page[T]{Data: rows}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	if len(rows) > limit {
+		page.Data = rows[:limit]
+		page.NextCursor = EncodeCursor(cursorOf(page.Data[limit-1]))
+	}
+	return page
 }
 
-func (s *PaymentService) ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) error {
+func (s *PaymentService) ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) (models.Deposit, error) {
 	if deposit.Amount <= 0 {
-		return ErrDepositAmountInvalid
+		return models.Deposit{}, ErrDepositAmountInvalid
 	}
 
 	if deposit.UserID == uuid.Nil {
-		return ErrIllegalUserId
+		return models.Deposit{}, ErrIllegalUserId
+	}
+	var err error
+	if deposit.Currency, err = normalizeCurrency(deposit.Currency); err != nil {
+		return models.Deposit{}, err
+	}
+
+	fees := priceTransaction(s.fees, "deposit", deposit.Currency, deposit.Amount)
+	if fees.Total <= 0 {
+		return models.Deposit{}, ErrAmountBelowFee
+	}
+	deposit.Fee = fees.Fee
+
+	transactionId, err := s.store.ProcessDeposit(ctx, deposit)
+	if err != nil {
+		return models.Deposit{}, fmt.Errorf("processing deposit: %w", err)
+	}
+	return models.Deposit{
+		TransactionID: transactionId,
+		UserID:        deposit.UserID,
+		Amount:        deposit.Amount,
+		Currency:      deposit.Currency,
+		Fees:          &fees,
+	}, nil
+}
+
+// Withdraw holds the funds, asks the payout processor to send them and then
+// settles the withdrawal as completed or failed. A rejected payout is not an
+// error for the caller: the returned withdrawal carries the failed status and
+// the held funds are back on the wallet. A withdrawal left pending by an
+// error here is settled later by RecoverWithdrawals.
+func (s *PaymentService) Withdraw(ctx context.Context, withdrawal *models.WithdrawalInsert) (models.Withdrawal, error) {
+	if withdrawal.Amount <= 0 {
+		return models.Withdrawal{}, ErrWithdrawalAmountInvalid
+	}
+	if withdrawal.UserID == uuid.Nil {
+		return models.Withdrawal{}, ErrIllegalUserId
+	}
+	if withdrawal.Destination == "" {
+		return models.Withdrawal{}, ErrDestinationRequired
+	}
+	var err error
+	if withdrawal.Currency, err = normalizeCurrency(withdrawal.Currency); err != nil {
+		return models.Withdrawal{}, err
+	}
+	fees := priceTransaction(s.fees, "withdrawal", withdrawal.Currency, withdrawal.Amount)
+	withdrawal.Fee = fees.Fee
+
+	created, err := s.store.CreateWithdrawal(ctx, withdrawal)
+	if err != nil {
+		return models.Withdrawal{}, fmt.Errorf("service: creating withdrawal: %w", err)
+	}
+
+	// Once the processor is called the withdrawal must be settled even if
+	// the client goes away.
+	ctx = context.WithoutCancel(ctx)
+	if err = s.payOut(ctx, created); err != nil {
+		return models.Withdrawal{}, fmt.Errorf("service: settling withdrawal %s: %w", created.ID, err)
+	}
+
+	settled, err := s.store.GetWithdrawal(ctx, created.ID)
+	if err != nil {
+		return models.Withdrawal{}, err
+	}
+	settled.Fees = &fees
+	return settled, nil
+}
+
+// payOut sends a pending withdrawal through the payout processor and settles
+// it. The reference is saved before settling, and a withdrawal that already
+// has one is settled with it without calling the processor again.
+func (s *PaymentService) payOut(ctx context.Context, withdrawal models.Withdrawal) error {
+	if withdrawal.PayoutReference != nil {
+		return s.store.CompleteWithdrawal(ctx, withdrawal.ID, *withdrawal.PayoutReference)
+	}
+
+	reference, payoutErr := s.payouts.Payout(ctx, PayoutRequest{
+		WithdrawalID: withdrawal.ID,
+		Amount:       withdrawal.Amount,
+		Currency:     withdrawal.Currency,
+		Destination:  withdrawal.Destination,
+	})
+	if payoutErr != nil {
+		return s.store.FailWithdrawal(ctx, withdrawal.ID, payoutErr.Error())
+	}
+
+	if err := s.store.RecordPayoutReference(ctx, withdrawal.ID, reference); err != nil {
+		return err
+	}
+	return s.store.CompleteWithdrawal(ctx, withdrawal.ID, reference)
+}
+
+// RecoverWithdrawals settles withdrawals whose payout was interrupted, by a
+// crash or a failed settlement, and reports how many it settled. Their payout
+// is retried, which the processor dedupes by withdrawal ID.
+func (s *PaymentService) RecoverWithdrawals(ctx context.Context) (recovered int, err error) {
+	for ctx.Err() == nil {
+		withdrawal, ok, err := s.store.ClaimStaleWithdrawal(ctx, s.withdrawals.StaleAfter)
+		if err != nil {
+			return recovered, err
+		}
+		if !ok {
+			return recovered, nil
+		}
+
+		err = s.payOut(context.WithoutCancel(ctx), withdrawal)
+		if errors.Is(err, ErrWithdrawalNotPending) {
+			continue
+		}
+		if err != nil {
+			// Claiming it pushed its next attempt back, so move on to the
+			// others.
+			log.Printf("payments: recovering withdrawal %s failed: %v", withdrawal.ID, err)
+			continue
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// StartWithdrawalRecovery runs RecoverWithdrawals every interval until ctx
+// is cancelled. The returned channel is closed once the sweep has stopped. A
+// zero interval disables it.
+func (s *PaymentService) StartWithdrawalRecovery(ctx context.Context, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	if interval <= 0 {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				recovered, err := s.RecoverWithdrawals(ctx)
+				if err != nil {
+					log.Printf("payments: withdrawal recovery failed: %v", err)
+				}
+				if recovered > 0 {
+					log.Printf("payments: settled %d interrupted withdrawals", recovered)
+				}
+			}
+		}
+	}()
+	return stopped
+}
+
+// QuoteFee previews the fees a transaction would be charged without moving
+// any money.
+func (s *PaymentService) QuoteFee(ctx context.Context, req models.FeeQuoteRequest) (models.FeeBreakdown, error) {
+	if req.Type == "" {
+		req.Type = "payment"
+	}
+	if req.Type != "payment" && req.Type != "deposit" && req.Type != "withdrawal" {
+		return models.FeeBreakdown{}, ErrInvalidFeeType
+	}
+	if req.Amount <= 0 {
+		return models.FeeBreakdown{}, ErrFeeAmountInvalid
+	}
+	code, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return models.FeeBreakdown{}, err
+	}
+	return priceTransaction(s.fees, req.Type, code, req.Amount), nil
+}
+
+// Convert executes an FX quote the user asked for, moving funds between two
+// of their own wallets at the quoted rate.
+func (s *PaymentService) Convert(ctx context.Context, userId, quoteId uuid.UUID) (models.Conversion, error) {
+	if userId == uuid.Nil {
+		return models.Conversion{}, ErrIllegalUserId
+	}
+
+	conversion, err := s.store.ConvertCurrency(ctx, userId, quoteId)
+	if err != nil {
+		return models.Conversion{}, fmt.Errorf("service: converting currency: %w", err)
+	}
+	return conversion, nil
+}
+
+// GetLimits reports the user's limits in a currency and what is left of them.
+func (s *PaymentService) GetLimits(ctx context.Context, userId uuid.UUID, code string) ([]models.LimitStatus, error) {
+	code, err := normalizeCurrency(code)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.GetLimits(ctx, userId, code)
+}
+
+// GetFraudDecision returns what the fraud rules decided on a payment and why.
+func (s *PaymentService) GetFraudDecision(ctx context.Context, paymentId uuid.UUID) (models.FraudDecision, error) {
+	return s.store.GetFraudDecision(ctx, paymentId)
+}
+
+// ListReviews returns the review queue: open reviews by default, or the
+// reviews whose payment is in status.
+func (s *PaymentService) ListReviews(ctx context.Context, status string, limit int) ([]models.PaymentReview, error) {
+	if status != "" && !slices.Contains([]string{"held", "in_review", "completed", "failed"}, status) {
+		return nil, fmt.Errorf("%w: status must be held, in_review, completed or failed", ErrInvalidFilter)
+	}
+	return s.store.ListReviews(ctx, status, limit)
+}
+
+func (s *PaymentService) ClaimReview(ctx context.Context, paymentId, reviewerId uuid.UUID) (models.PaymentReview, error) {
+	return s.store.ClaimReview(ctx, paymentId, reviewerId)
+}
+
+// ApproveReview releases a held payment to its receiver.
+func (s *PaymentService) ApproveReview(ctx context.Context, paymentId, reviewerId uuid.UUID, reason string) (models.PaymentReview, error) {
+	return s.store.DecideReview(ctx, paymentId, reviewerId, true, strings.TrimSpace(reason))
+}
+
+// RejectReview returns a held payment's funds to the sender.
+func (s *PaymentService) RejectReview(ctx context.Context, paymentId, reviewerId uuid.UUID, reason string) (models.PaymentReview, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return models.PaymentReview{}, ErrReasonRequired
+	}
+	return s.store.DecideReview(ctx, paymentId, reviewerId, false, reason)
+}
+
+// ExpireReviews returns the funds of every held payment whose review is past
+// due and reports how many there were.
+func (s *PaymentService) ExpireReviews(ctx context.Context) (expired int, err error) {
+	for {
+		ok, err := s.store.ExpireReview(ctx)
+		if err != nil {
+			return expired, err
+		}
+		if !ok {
+			return expired, nil
+		}
+		expired++
+	}
+}
+
+// StartReviewExpiry expires overdue reviews every interval until ctx is
+// cancelled. The returned channel is closed once it has stopped. A zero
+// interval disables it.
+func (s *PaymentService) StartReviewExpiry(ctx context.Context, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	if interval <= 0 {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				expired, err := s.ExpireReviews(ctx)
+				if err != nil {
+					log.Printf("payments: expiring reviews failed: %v", err)
+				}
+				if expired > 0 {
+					log.Printf("payments: expired %d overdue payment reviews", expired)
+				}
+			}
+		}
+	}()
+	return stopped
+}
+
+// CreateSchedule sets up a payment from the sender to be made at StartAt and,
+// for a recurring one, on its recurrence after that.
+func (s *PaymentService) CreateSchedule(ctx context.Context, schedule *models.ScheduledPaymentInsert) (models.ScheduledPayment, error) {
+	if schedule.SenderID == uuid.Nil {
+		return models.ScheduledPayment{}, ErrIllegalUserId
+	}
+	if schedule.ReceiverID == uuid.Nil || schedule.ReceiverID == schedule.SenderID {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: receiver_id must be another user", ErrInvalidSchedule)
+	}
+	if schedule.Amount <= 0 {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: amount must be greater than zero", ErrInvalidSchedule)
+	}
+	var err error
+	if schedule.Currency, err = normalizeCurrency(schedule.Currency); err != nil {
+		return models.ScheduledPayment{}, err
 	}
-	err := s.store.ProcessDeposit(ctx, deposit)
+
+	if !slices.Contains([]string{"once", "daily", "weekly", "monthly"}, schedule.Frequency) {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: frequency must be once, daily, weekly or monthly", ErrInvalidSchedule)
+	}
+	if schedule.Interval == 0 {
+		schedule.Interval = 1
+	}
+	if schedule.Interval < 0 {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: interval must be positive", ErrInvalidSchedule)
+	}
+	if schedule.Frequency == "once" && (schedule.Interval != 1 || schedule.EndAt != nil || schedule.MaxRuns != nil) {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: interval, end_at and max_runs only apply to recurring payments", ErrInvalidSchedule)
+	}
+
+	if !schedule.StartAt.After(time.Now()) {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: start_at must be in the future", ErrInvalidSchedule)
+	}
+	schedule.StartAt = schedule.StartAt.UTC()
+	if schedule.EndAt != nil {
+		if schedule.EndAt.Before(schedule.StartAt) {
+			return models.ScheduledPayment{}, fmt.Errorf("%w: end_at must not be before start_at", ErrInvalidSchedule)
+		}
+		endAt := schedule.EndAt.UTC()
+		schedule.EndAt = &endAt
+	}
+	if schedule.MaxRuns != nil && *schedule.MaxRuns < 1 {
+		return models.ScheduledPayment{}, fmt.Errorf("%w: max_runs must be at least 1", ErrInvalidSchedule)
+	}
+
+	return s.store.CreateSchedule(ctx, schedule)
+}
+
+func (s *PaymentService) GetSchedules(ctx context.Context, senderId uuid.UUID) ([]models.ScheduledPayment, error) {
+	return s.store.GetSchedules(ctx, senderId)
+}
+
+func (s *PaymentService) PauseSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.store.PauseSchedule(ctx, scheduleId, senderId)
+}
+
+func (s *PaymentService) ResumeSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.store.ResumeSchedule(ctx, scheduleId, senderId)
+}
+
+func (s *PaymentService) CancelSchedule(ctx context.Context, scheduleId, senderId uuid.UUID) (models.ScheduledPayment, error) {
+	return s.store.CancelSchedule(ctx, scheduleId, senderId)
+}
+
+// RunDueSchedules executes scheduled payments until none is due and reports
+// how many occurrences it attempted. It stops early when ctx is cancelled,
+// but never in the middle of a payment.
+func (s *PaymentService) RunDueSchedules(ctx context.Context) (attempted int, err error) {
+	for ctx.Err() == nil {
+		claim, ok, err := s.store.ClaimDueSchedule(ctx, s.schedules.Lease)
+		if err != nil {
+			return attempted, err
+		}
+		if !ok {
+			return attempted, nil
+		}
+		if err = s.runOccurrence(context.WithoutCancel(ctx), claim); err != nil {
+			return attempted, fmt.Errorf("service: running scheduled payment %s: %w", claim.Schedule.ID, err)
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// runOccurrence pays a claimed schedule's current occurrence through
+// InsertNewPayment, like any other payment, under the occurrence's
+// idempotency key. A failure is retried with backoff unless retrying cannot
+// help or the attempts are used up, in which case the occurrence is given up
+// and the schedule moves on.
+func (s *PaymentService) runOccurrence(ctx context.Context, claim ScheduleClaim) error {
+	schedule := claim.Schedule
+	paymentId := claim.PaidPaymentID
+
+	var payErr error
+	if paymentId == nil {
+		payment, err := s.InsertNewPayment(idempotency.WithKey(ctx, schedule.SenderID, claim.Key), &models.PaymentInsert{
+			SenderID:   schedule.SenderID,
+			ReceiverID: schedule.ReceiverID,
+			Amount:     schedule.Amount,
+			Currency:   schedule.Currency,
+			Status:     "pending",
+			Note:       schedule.Note,
+		})
+		switch {
+		case err == nil:
+			paymentId = &payment.ID
+		case errors.Is(err, idempotency.ErrAlreadyProcessed):
+			// Another worker paid the occurrence after this one's lease ran
+			// out; the next claim finds the payment and records it.
+			return s.store.ReleaseSchedule(ctx, claim)
+		default:
+			payErr = err
+		}
+	}
+
+	if payErr != nil && !permanentScheduleError(payErr) && schedule.Attempts+1 < s.schedules.MaxAttempts {
+		_, err := s.store.RetryOccurrence(ctx, claim, s.schedules.RetryBackoff<<schedule.Attempts, payErr.Error())
+		return err
+	}
+
+	var nextRunAt *time.Time
+	if at, ok := occurrenceAt(schedule.ScheduledPaymentInsert, schedule.Occurrences+1); ok {
+		nextRunAt = &at
+	}
+	endStatus, lastError := "completed", ""
+	if payErr != nil {
+		log.Printf("payments: giving up occurrence %d of scheduled payment %s: %v", schedule.Occurrences, schedule.ID, payErr)
+		endStatus, lastError = "failed", payErr.Error()
+	}
+
+	recorded, err := s.store.FinishOccurrence(ctx, claim, paymentId, lastError, nextRunAt, endStatus)
 	if err != nil {
-		return fmt.Errorf("processing deposit: %v", err)
+		return err
+	}
+	if !recorded {
+		log.Printf("payments: lease on scheduled payment %s expired before occurrence %d was recorded", schedule.ID, schedule.Occurrences)
 	}
 	return nil
 }
+
+// permanentScheduleError reports whether a scheduled payment that failed
+// with err would fail the same way if retried. Anything else, such as
+// insufficient funds or a daily limit, may clear up before the next attempt.
+func permanentScheduleError(err error) bool {
+	for _, permanent := range []error{ErrUserIdNotFound, ErrAccountClosed, ErrWalletNotFound, ErrUnsupportedCurrency,
+		ErrPerTransactionLimit, ErrPaymentBlocked} {
+		if errors.Is(err, permanent) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartScheduler executes due scheduled payments every interval until ctx is
+// cancelled. The returned channel is closed once the worker has stopped,
+// after finishing any payment in flight. A zero interval disables it.
+func (s *PaymentService) StartScheduler(ctx context.Context, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	if interval <= 0 {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				attempted, err := s.RunDueSchedules(ctx)
+				if err != nil {
+					log.Printf("payments: running scheduled payments failed: %v", err)
+				}
+				if attempted > 0 {
+					log.Printf("payments: attempted %d scheduled payments", attempted)
+				}
+			}
+		}
+	}()
+	return stopped
+}
+
+// normalizeCurrency returns the canonical code for a requested currency,
+// defaulting to currency.Default.
+func normalizeCurrency(code string) (string, error) {
+	normalized, err := currency.Normalize(code)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, code)
+	}
+	return normalized, nil
+}
+
+func (s *PaymentService) RefundPayment(ctx context.Context, refund *models.RefundInsert) (models.Refund, error) {
+	if refund.Amount < 0 {
+		return models.Refund{}, ErrRefundAmountInvalid
+	}
+	if refund.RequesterID == uuid.Nil {
+		return models.Refund{}, ErrIllegalUserId
+	}
+
+	created, err := s.store.RefundPayment(ctx, refund)
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("service: refunding payment: %w", err)
+	}
+	return created, nil
+}
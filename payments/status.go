@@ -0,0 +1,104 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// walletState is the status of a wallet and of the user owning it, read while
+// the wallet is locked. The stricter of the two applies.
+type walletState struct {
+	UserID               uuid.UUID
+	WalletID             uuid.UUID
+	UserStatus           string
+	WalletStatus         string
+	UserBlocksIncoming   bool
+	WalletBlocksIncoming bool
+}
+
+// walletStateColumns selects a walletState from the wallets and users tables
+// aliased as w and u.
+func walletStateColumns(w, u string) string {
+	return fmt.Sprintf("%[2]s.id, %[1]s.id, %[2]s.status, %[1]s.status, %[2]s.block_incoming, %[1]s.block_incoming", w, u)
+}
+
+func (ws *walletState) scanTargets() []any {
+	return []any{&ws.UserID, &ws.WalletID, &ws.UserStatus, &ws.WalletStatus, &ws.UserBlocksIncoming, &ws.WalletBlocksIncoming}
+}
+
+// lockWallets locks the wallets matching where in id order before their state
+// is read. Transactions moving funds between the same wallets in opposite
+// directions then take the locks in the same order and can't deadlock.
+func lockWallets(ctx context.Context, tx pgx.Tx, where string, args ...any) error {
+	_, err := tx.Exec(ctx, `SELECT id FROM wallets WHERE `+where+` ORDER BY id FOR UPDATE`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to lock wallets: %w", err)
+	}
+	return nil
+}
+
+// sendBlock returns why funds can't leave the wallet, or "" if they can.
+func (ws walletState) sendBlock() string {
+	switch {
+	case ws.UserStatus != "active":
+		return "user_" + ws.UserStatus
+	case ws.WalletStatus != "active":
+		return "wallet_" + ws.WalletStatus
+	}
+	return ""
+}
+
+// receiveBlock returns why funds can't be credited to the wallet, or "" if
+// they can. Frozen accounts keep receiving unless the freeze says otherwise.
+func (ws walletState) receiveBlock() string {
+	switch {
+	case ws.UserStatus == "closed":
+		return "user_closed"
+	case ws.WalletStatus == "closed":
+		return "wallet_closed"
+	case ws.UserStatus == "frozen" && ws.UserBlocksIncoming:
+		return "user_frozen"
+	case ws.WalletStatus == "frozen" && ws.WalletBlocksIncoming:
+		return "wallet_frozen"
+	}
+	return ""
+}
+
+// ownAccountError maps a sendBlock or receiveBlock reason on the caller's own
+// account to the error returned to them.
+func ownAccountError(reason string) error {
+	if strings.HasSuffix(reason, "closed") {
+		return ErrAccountClosed
+	}
+	return ErrAccountFrozen
+}
+
+// blockedAttempt is a money movement refused because of an account status.
+type blockedAttempt struct {
+	UserID   uuid.UUID
+	WalletID uuid.UUID
+	Action   string // 'send', 'receive', 'deposit', 'withdrawal' or 'refund'
+	Amount   int64
+	Reason   string
+}
+
+// recordBlockedAttempt rolls tx back and stores the attempt through the pool,
+// so the record survives and the wallet locks held by tx can't block it. It
+// returns err.
+func (s *PaymentsStore) recordBlockedAttempt(ctx context.Context, tx pgx.Tx, attempt blockedAttempt, err error) error {
+	tx.Rollback(ctx)
+
+	_, dbErr := s.db.Exec(context.WithoutCancel(ctx), `
+		INSERT INTO blocked_attempts (user_id, wallet_id, action, amount, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, attempt.UserID, attempt.WalletID, attempt.Action, attempt.Amount, attempt.Reason)
+	if dbErr != nil {
+		log.Printf("store: failed to record blocked %s on wallet %s: %v", attempt.Action, attempt.WalletID, dbErr)
+	}
+	return err
+}
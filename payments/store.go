@@ -4,8 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"paygo/config"
+	"paygo/fraud"
+	"paygo/fx"
+	"paygo/idempotency"
+	"paygo/ledger"
 	"paygo/models"
+	"paygo/screening"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -13,22 +20,47 @@ import (
 )
 
 type PaymentsStore struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	limits    config.Limits
+	fraud     *fraud.Engine
+	reviewSLA time.Duration // how long a held payment waits for review before it expires
+	screener  *screening.Screener
+	rates     fx.RateProvider // converts amounts into the currency of a limit
 }
 
-func NewPaymentsStore(db *pgxpool.Pool) *PaymentsStore {
-	return &PaymentsStore{db}
+func NewPaymentsStore(db *pgxpool.Pool, limits config.Limits, fraud *fraud.Engine, reviewSLA time.Duration,
+	screener *screening.Screener, rates fx.RateProvider) *PaymentsStore {
+	return &PaymentsStore{db, limits, fraud, reviewSLA, screener, rates}
 }
 
-func (s *PaymentsStore) GetPaymentsByUserId(ctx context.Context, userId uuid.UUID) ([]models.PaymentWithNames, error) {
+// GetPaymentsByUserId returns up to filter.Limit+1 payments the user sent or
+// received, newest first, so the caller can tell whether another page exists.
+func (s *PaymentsStore) GetPaymentsByUserId(ctx context.Context, userId uuid.UUID, filter models.PaymentFilter) ([]models.PaymentWithNames, error) {
 	var payments []models.PaymentWithNames
 
-	query := `
+	args := []any{userId}
+	conditions := []string{"p.status != 'initialized'"}
+
+	// Receivers don't see payments the fraud rules held or blocked.
+	received := "(p.receiver_id = $1 AND p.status NOT IN ('held', 'in_review', 'blocked'))"
+	switch filter.Direction {
+	case "sent":
+		conditions = append(conditions, "p.sender_id = $1")
+	case "received":
+		conditions = append(conditions, received)
+	default:
+		conditions = append(conditions, "(p.sender_id = $1 OR "+received+")")
+	}
+
+	conditions, args = appendPaymentFilter(conditions, args, filter)
+
+	query := fmt.Sprintf(`
 		SELECT
 			p.id,
 			p.sender_id,
 			p.receiver_id,
 			p.amount,
+			p.currency,
 			p.status,
 			p.transaction_id,
 			p.note,
@@ -42,12 +74,13 @@ func (s *PaymentsStore) GetPaymentsByUserId(ctx context.Context, userId uuid.UUI
 		JOIN
 			users receiver ON receiver.id = p.receiver_id
 		WHERE
-			(p.sender_id = $1 OR p.receiver_id = $1) AND p.status != 'initialized'
+			%s
 		ORDER BY
-			p.created_at DESC
-	`
+			p.created_at DESC, p.id DESC
+		LIMIT %d
+	`, strings.Join(conditions, " AND "), filter.Limit+1)
 
-	rows, err := s.db.Query(ctx, query, userId)
+	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("handler: error querying payments: %w", err)
 	}
@@ -61,6 +94,7 @@ func (s *PaymentsStore) GetPaymentsByUserId(ctx context.Context, userId uuid.UUI
 			&payment.SenderID,
 			&payment.ReceiverID,
 			&payment.Amount,
+			&payment.Currency,
 			&payment.Status,
 			&payment.TransactionID,
 			&payment.Note,
@@ -81,17 +115,23 @@ func (s *PaymentsStore) GetPaymentsByUserId(ctx context.Context, userId uuid.UUI
 	return payments, nil
 }
 
-func (s *PaymentsStore) GetAllPayments(ctx context.Context) (payments []models.Payment, err error) {
+// GetAllPayments returns up to filter.Limit+1 payments, newest first.
+// filter.Direction is ignored since there is no "own" side to compare with.
+func (s *PaymentsStore) GetAllPayments(ctx context.Context, filter models.PaymentFilter) (payments []models.Payment, err error) {
 	var paymentsList []models.Payment
 
-	wantCols := []string{"id", "sender_id", "receiver_id", "amount", "status", "transaction_id", "note", "created_at"}
+	wantCols := []string{"p.id", "p.sender_id", "p.receiver_id", "p.amount", "p.currency", "p.status", "p.transaction_id", "p.note", "p.created_at"}
+
+	conditions, args := appendPaymentFilter([]string{"TRUE"}, nil, filter)
 
 	query := fmt.Sprintf(
-		"SELECT %s FROM payments ORDER BY created_at DESC",
+		"SELECT %s FROM payments p WHERE %s ORDER BY p.created_at DESC, p.id DESC LIMIT %d",
 		strings.Join(wantCols, ", "),
+		strings.Join(conditions, " AND "),
+		filter.Limit+1,
 	)
 
-	rows, err := s.db.Query(ctx, query)
+	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, errors.New("Error querying payments: " + err.Error())
 	}
@@ -105,6 +145,7 @@ func (s *PaymentsStore) GetAllPayments(ctx context.Context) (payments []models.P
 			&payment.SenderID,
 			&payment.ReceiverID,
 			&payment.Amount,
+			&payment.Currency,
 			&payment.Status,
 			&payment.TransactionID,
 			&payment.Note,
@@ -125,10 +166,49 @@ func (s *PaymentsStore) GetAllPayments(ctx context.Context) (payments []models.P
 
 }
 
+// appendPaymentFilter adds the WHERE conditions shared by the payment
+// listings on the table aliased as p, numbering placeholders after args.
+func appendPaymentFilter(conditions []string, args []any, filter models.PaymentFilter) ([]string, []any) {
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Cursor != nil {
+		conditions = append(conditions, fmt.Sprintf(
+			"(p.created_at, p.id) < (%s, %s)", arg(filter.Cursor.CreatedAt), arg(filter.Cursor.ID),
+		))
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "p.created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "p.created_at < "+arg(*filter.To))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "p.status = "+arg(filter.Status))
+	}
+	if filter.Currency != "" {
+		conditions = append(conditions, "p.currency = "+arg(filter.Currency))
+	}
+	if filter.CounterpartyID != uuid.Nil {
+		placeholder := arg(filter.CounterpartyID)
+		conditions = append(conditions, fmt.Sprintf("(p.sender_id = %s OR p.receiver_id = %s)", placeholder, placeholder))
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, "p.amount >= "+arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, "p.amount <= "+arg(*filter.MaxAmount))
+	}
+
+	return conditions, args
+}
+
 func (s *PaymentsStore) GetPaymentsUserHasPaid(ctx context.Context, userId uuid.UUID) (payments []models.Payment, err error) {
 	var paymentsList []models.Payment
 	rows, err := s.db.Query(ctx, `
-		SELECT id, sender_id, receiver_id, amount, status, transaction_id, note, created_at
+		SELECT id, sender_id, receiver_id, amount, currency, status, transaction_id, note, created_at
 		FROM payments
 		WHERE sender_id = $1
 		ORDER BY created_at DESC;
@@ -146,6 +226,7 @@ func (s *PaymentsStore) GetPaymentsUserHasPaid(ctx context.Context, userId uuid.
 			&payment.SenderID,
 			&payment.ReceiverID,
 			&payment.Amount,
+			&payment.Currency,
 			&payment.Status,
 			&payment.TransactionID,
 			&payment.Note,
@@ -164,73 +245,128 @@ func (s *PaymentsStore) GetPaymentsUserHasPaid(ctx context.Context, userId uuid.
 	return paymentsList, nil
 }
 
-func (s *PaymentsStore) InsertNewPayment(ctx context.Context, newPayment *models.PaymentInsert) (uuid.UUID, error) {
+func (s *PaymentsStore) InsertNewPayment(ctx context.Context, newPayment *models.PaymentInsert) (models.Payment, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return uuid.Nil, errors.New("Failed to begin transaction: " + err.Error())
+		return models.Payment{}, errors.New("Failed to begin transaction: " + err.Error())
 	}
 
 	defer tx.Rollback(ctx) // Will be ignored if tx.Commit() is called
 
 	var (
-		senderWalletId   uuid.UUID
-		receiverWalletId uuid.UUID
-		senderBalance    int64
+		sender        walletState
+		receiver      walletState
+		senderBalance int64
 	)
 
-	err = tx.QueryRow(ctx, `
-        SELECT w1.id, w1.balance, w2.id
-        FROM wallets w1, wallets w2
+	err = s.screenReceiver(ctx, tx, newPayment.SenderID, newPayment.ReceiverID, newPayment.Currency, newPayment.Amount)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	err = lockWallets(ctx, tx, `user_id IN ($1, $2) AND currency = $3`,
+		newPayment.SenderID, newPayment.ReceiverID, newPayment.Currency)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	// Users are share-locked so an account can't be frozen halfway through.
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+        SELECT w1.balance, %s, %s
+        FROM wallets w1 JOIN users u1 ON u1.id = w1.user_id,
+             wallets w2 JOIN users u2 ON u2.id = w2.user_id
         WHERE w1.user_id = $1 AND w2.user_id = $2
-        FOR UPDATE OF w1, w2
-    `, newPayment.SenderID, newPayment.ReceiverID).Scan(&senderWalletId, &senderBalance, &receiverWalletId)
+          AND w1.currency = $3 AND w2.currency = $3
+        FOR SHARE OF u1, u2
+    `, walletStateColumns("w1", "u1"), walletStateColumns("w2", "u2")), newPayment.SenderID, newPayment.ReceiverID, newPayment.Currency).Scan(
+		append(append([]any{&senderBalance}, sender.scanTargets()...), receiver.scanTargets()...)...,
+	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return uuid.Nil, ErrUserIdNotFound
+			return models.Payment{}, missingWalletError(ctx, tx, newPayment.SenderID, newPayment.ReceiverID)
 		}
-		return uuid.Nil, fmt.Errorf("failed to get wallets: %w", err)
+		return models.Payment{}, fmt.Errorf("failed to get wallets: %w", err)
 	}
+	senderWalletId, receiverWalletId := sender.WalletID, receiver.WalletID
 
-	if senderBalance < newPayment.Amount {
-		return uuid.Nil, errors.New("insufficient funds")
+	if reason := sender.sendBlock(); reason != "" {
+		return models.Payment{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: sender.UserID, WalletID: sender.WalletID, Action: "send", Amount: newPayment.Amount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+	if reason := receiver.receiveBlock(); reason != "" {
+		return models.Payment{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: receiver.UserID, WalletID: receiver.WalletID, Action: "receive", Amount: newPayment.Amount, Reason: reason,
+		}, ErrCounterpartyUnavailable)
+	}
+
+	err = s.checkLimits(ctx, tx, sender.UserID, "payment", newPayment.Currency, newPayment.Amount)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	if senderBalance < newPayment.Amount+newPayment.Fee {
+		return models.Payment{}, ErrInsufficientFunds
+	}
+
+	decision, err := s.fraud.Evaluate(ctx, tx, fraud.Candidate{
+		SenderID:       sender.UserID,
+		SenderWalletID: senderWalletId,
+		ReceiverID:     receiver.UserID,
+		Amount:         newPayment.Amount,
+		Currency:       newPayment.Currency,
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if decision.Action != fraud.ActionAllow {
+		return s.insertFlaggedPayment(ctx, tx, newPayment, senderWalletId, receiverWalletId, decision)
 	}
 
 	// create transaction itself
 	var newTransactionId uuid.UUID
 	err = tx.QueryRow(ctx,
 		`
-		insert into transactions (from_wallet_id, to_wallet_id, amount, status, type)
-		values ($1, $2, $3, 'pending', 'payment') RETURNING id;
-		`, senderWalletId, receiverWalletId, newPayment.Amount).Scan(&newTransactionId)
+		insert into transactions (from_wallet_id, to_wallet_id, amount, currency, status, type)
+		values ($1, $2, $3, $4, 'pending', 'payment') RETURNING id;
+		`, senderWalletId, receiverWalletId, newPayment.Amount, newPayment.Currency).Scan(&newTransactionId)
 
 	if err != nil {
-		return uuid.Nil, errors.New("Could not create transaction: " + err.Error())
+		return models.Payment{}, errors.New("Could not create transaction: " + err.Error())
 	}
 
-	var paymentId uuid.UUID
+	payment := models.Payment{PaymentInsert: *newPayment, TransactionID: &newTransactionId}
 	err = tx.QueryRow(ctx, `
-        INSERT INTO payments (sender_id, receiver_id, amount, status, transaction_id, note)
-        VALUES ($1, $2, $3, 'initiated', $4, $5)
-        RETURNING id;
-    `, newPayment.SenderID, newPayment.ReceiverID, newPayment.Amount,
-		newTransactionId, newPayment.Note).Scan(&paymentId)
+        INSERT INTO payments (sender_id, receiver_id, amount, currency, status, transaction_id, note)
+        VALUES ($1, $2, $3, $4, 'initiated', $5, $6)
+        RETURNING id, created_at;
+    `, newPayment.SenderID, newPayment.ReceiverID, newPayment.Amount, newPayment.Currency,
+		newTransactionId, newPayment.Note).Scan(&payment.ID, &payment.CreatedAt)
 
 	if err != nil {
-		return uuid.Nil, errors.New("Could not create payment: " + err.Error())
+		return models.Payment{}, errors.New("Could not create payment: " + err.Error())
 	}
 
-	batch := &pgx.Batch{}
+	if err = recordFraudDecision(ctx, tx, payment.ID, decision); err != nil {
+		return models.Payment{}, err
+	}
 
-	batch.Queue(`
-    UPDATE wallets SET balance = balance - $1, updated_at = CURRENT_TIMESTAMP
-    WHERE id = $2
-`, newPayment.Amount, senderWalletId)
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: newTransactionId,
+		Description:   "payment",
+		Postings:      ledger.Transfer(senderWalletId, receiverWalletId, newPayment.Amount),
+	})
+	if err != nil {
+		return models.Payment{}, fmt.Errorf("failed to record payment in ledger: %w", err)
+	}
 
-	batch.Queue(`
-        UPDATE wallets SET balance = balance + $1, updated_at = CURRENT_TIMESTAMP
-        WHERE id = $2
-    `, newPayment.Amount, receiverWalletId)
+	err = chargeFee(ctx, tx, senderWalletId, newPayment.Currency, newPayment.Fee, newTransactionId, "")
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	batch := &pgx.Batch{}
 
 	batch.Queue(`
         UPDATE transactions SET status = 'completed' WHERE id = $1
@@ -238,48 +374,70 @@ func (s *PaymentsStore) InsertNewPayment(ctx context.Context, newPayment *models
 
 	batch.Queue(`
         UPDATE payments SET status = 'completed' WHERE id = $1
-    `, paymentId)
+    `, payment.ID)
 
 	results := tx.SendBatch(ctx, batch)
 
-	for i := range 4 {
+	for i := range 2 {
 		_, err := results.Exec()
 		if err != nil {
 			results.Close()
-			return uuid.Nil, fmt.Errorf("batch operation %d failed: %w", i, err)
+			return models.Payment{}, fmt.Errorf("batch operation %d failed: %w", i, err)
 		}
 	}
 	err = results.Close()
 	if err != nil {
-		return uuid.Nil, errors.New("Could not close batch results: " + err.Error())
+		return models.Payment{}, errors.New("Could not close batch results: " + err.Error())
+	}
+
+	if err = idempotency.BindTx(ctx, tx, payment.ID); err != nil {
+		return models.Payment{}, err
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return uuid.Nil, errors.New("Could not commit transaction: " + err.Error())
+		return models.Payment{}, errors.New("Could not commit transaction: " + err.Error())
 	}
 
-	return paymentId, nil
+	payment.Status = "completed"
+	return payment, nil
 
 }
 
-func (s *PaymentsStore) ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) error {
+// ProcessDeposit credits the deposit, net of its fee, to the user's wallet and
+// returns the deposit transaction ID.
+func (s *PaymentsStore) ProcessDeposit(ctx context.Context, deposit *models.DepositInsert) (uuid.UUID, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var walletId uuid.UUID
-	err = tx.QueryRow(ctx, `
-		SELECT id FROM wallets WHERE user_id = $1 FOR UPDATE
-	`, deposit.UserID).Scan(&walletId)
+	var state walletState
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM wallets w JOIN users u ON u.id = w.user_id
+		WHERE w.user_id = $1 AND w.currency = $2
+		FOR UPDATE OF w FOR SHARE OF u
+	`, walletStateColumns("w", "u")), deposit.UserID, deposit.Currency).Scan(state.scanTargets()...)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrUserIdNotFound
+			return uuid.Nil, missingWalletError(ctx, tx, deposit.UserID)
 		}
-		return fmt.Errorf("failed to get wallet: %w", err)
+		return uuid.Nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+	walletId := state.WalletID
+
+	if reason := state.receiveBlock(); reason != "" {
+		return uuid.Nil, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: state.UserID, WalletID: walletId, Action: "deposit", Amount: deposit.Amount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+
+	err = s.checkLimits(ctx, tx, state.UserID, "deposit", deposit.Currency, deposit.Amount)
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	var transactionId uuid.UUID
@@ -288,31 +446,659 @@ func (s *PaymentsStore) ProcessDeposit(ctx context.Context, deposit *models.Depo
 			from_wallet_id,
 			to_wallet_id,
 			 amount,
+			 currency,
 			 status,
 			 type
 		)
-		VALUES (NULL, $1, $2, 'completed', 'deposit')
+		VALUES (NULL, $1, $2, $3, 'completed', 'deposit')
+		RETURNING id
+	`, walletId, deposit.Amount, deposit.Currency).Scan(&transactionId)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create deposit transaction: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: transactionId,
+		Description:   "deposit",
+		Postings: []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountDeposits, deposit.Currency, -deposit.Amount),
+			ledger.WalletPosting(walletId, deposit.Amount),
+		},
+	})
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to record deposit in ledger: %w", err)
+	}
+
+	if err = chargeFee(ctx, tx, walletId, deposit.Currency, deposit.Fee, transactionId, ""); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = idempotency.BindTx(ctx, tx, transactionId); err != nil {
+		return uuid.Nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit deposit transaction: %w", err)
+	}
+
+	return transactionId, nil
+}
+
+// CreateWithdrawal holds the funds and the fee on the user's wallet and
+// records a pending withdrawal. The hold is settled by CompleteWithdrawal or
+// returned to the wallet by FailWithdrawal once the payout processor answers.
+func (s *PaymentsStore) CreateWithdrawal(ctx context.Context, withdrawal *models.WithdrawalInsert) (models.Withdrawal, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Withdrawal{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		state   walletState
+		balance int64
+	)
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT w.balance, %s
+		FROM wallets w JOIN users u ON u.id = w.user_id
+		WHERE w.user_id = $1 AND w.currency = $2
+		FOR UPDATE OF w FOR SHARE OF u
+	`, walletStateColumns("w", "u")), withdrawal.UserID, withdrawal.Currency).Scan(append([]any{&balance}, state.scanTargets()...)...)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Withdrawal{}, missingWalletError(ctx, tx, withdrawal.UserID)
+		}
+		return models.Withdrawal{}, fmt.Errorf("failed to get wallet: %w", err)
+	}
+	walletId := state.WalletID
+
+	if reason := state.sendBlock(); reason != "" {
+		return models.Withdrawal{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: state.UserID, WalletID: walletId, Action: "withdrawal", Amount: withdrawal.Amount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+
+	err = s.checkLimits(ctx, tx, state.UserID, "withdrawal", withdrawal.Currency, withdrawal.Amount)
+	if err != nil {
+		return models.Withdrawal{}, err
+	}
+
+	if balance < withdrawal.Amount+withdrawal.Fee {
+		return models.Withdrawal{}, ErrInsufficientFunds
+	}
+
+	var transactionId uuid.UUID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, currency, status, type)
+		VALUES ($1, NULL, $2, $3, 'pending', 'withdrawal')
 		RETURNING id
-	`, walletId, deposit.Amount).Scan(&transactionId)
+	`, walletId, withdrawal.Amount, withdrawal.Currency).Scan(&transactionId)
 
 	if err != nil {
-		return fmt.Errorf("failed to create deposit transaction: %w", err)
+		return models.Withdrawal{}, fmt.Errorf("failed to create withdrawal transaction: %w", err)
 	}
 
 	_, err = tx.Exec(ctx, `
-		UPDATE wallets
-		SET balance = balance + $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
-	`, deposit.Amount, walletId)
+		INSERT INTO withdrawals (transaction_id, user_id, destination)
+		VALUES ($1, $2, $3)
+	`, transactionId, withdrawal.UserID, withdrawal.Destination)
 
 	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
+		return models.Withdrawal{}, fmt.Errorf("failed to record withdrawal: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: transactionId,
+		Description:   "withdrawal hold",
+		Postings: []ledger.Posting{
+			ledger.WalletPosting(walletId, -withdrawal.Amount),
+			ledger.SystemPosting(ledger.AccountPayoutsPending, withdrawal.Currency, withdrawal.Amount),
+		},
+	})
+
+	if err != nil {
+		return models.Withdrawal{}, fmt.Errorf("failed to hold withdrawal funds: %w", err)
+	}
+
+	err = chargeFee(ctx, tx, walletId, withdrawal.Currency, withdrawal.Fee, transactionId, ledger.AccountPayoutsPending)
+	if err != nil {
+		return models.Withdrawal{}, err
+	}
+
+	if err = idempotency.BindTx(ctx, tx, transactionId); err != nil {
+		return models.Withdrawal{}, err
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to commit deposit transaction: %w", err)
+		return models.Withdrawal{}, fmt.Errorf("failed to commit withdrawal transaction: %w", err)
+	}
+
+	return s.GetWithdrawal(ctx, transactionId)
+}
+
+// RecordPayoutReference saves the reference of a payout the processor made
+// for a pending withdrawal, so a settlement that fails afterwards can be
+// completed without paying out again.
+func (s *PaymentsStore) RecordPayoutReference(ctx context.Context, withdrawalId uuid.UUID, payoutReference string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE withdrawals SET payout_reference = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = $1
+	`, withdrawalId, payoutReference)
+	if err != nil {
+		return fmt.Errorf("failed to record payout reference: %w", err)
+	}
+	return nil
+}
+
+// ClaimStaleWithdrawal picks a pending withdrawal whose last payout attempt
+// is older than staleAfter and records a new attempt on it, which keeps other
+// sweeps off it for another staleAfter. ok is false when there is none.
+func (s *PaymentsStore) ClaimStaleWithdrawal(ctx context.Context, staleAfter time.Duration) (withdrawal models.Withdrawal, ok bool, err error) {
+	var withdrawalId uuid.UUID
+	err = s.db.QueryRow(ctx, `
+		UPDATE withdrawals
+		SET payout_attempts = payout_attempts + 1, payout_attempted_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = (
+			SELECT wd.transaction_id
+			FROM withdrawals wd
+			JOIN transactions t ON t.id = wd.transaction_id
+			WHERE t.type = 'withdrawal' AND t.status = 'pending'
+				AND wd.payout_attempted_at < CURRENT_TIMESTAMP - $1::interval
+			ORDER BY wd.payout_attempted_at
+			LIMIT 1
+			FOR UPDATE OF wd SKIP LOCKED
+		)
+		RETURNING transaction_id
+	`, staleAfter).Scan(&withdrawalId)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Withdrawal{}, false, nil
+	}
+	if err != nil {
+		return models.Withdrawal{}, false, fmt.Errorf("failed to claim stale withdrawal: %w", err)
+	}
+
+	withdrawal, err = s.GetWithdrawal(ctx, withdrawalId)
+	if err != nil {
+		return models.Withdrawal{}, false, err
+	}
+	return withdrawal, true, nil
+}
+
+func (s *PaymentsStore) CompleteWithdrawal(ctx context.Context, withdrawalId uuid.UUID, payoutReference string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, amount, currency, err := lockPendingWithdrawal(ctx, tx, withdrawalId)
+	if err != nil {
+		return err
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: withdrawalId,
+		Description:   "withdrawal payout",
+		Postings: []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountPayoutsPending, currency, -amount),
+			ledger.SystemPosting(ledger.AccountWithdrawals, currency, amount),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record payout in ledger: %w", err)
+	}
+
+	if err = settleFee(ctx, tx, withdrawalId, ledger.AccountPayoutsPending, true, false); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE transactions SET status = 'completed' WHERE id = $1`, withdrawalId)
+	batch.Queue(`
+		UPDATE withdrawals SET payout_reference = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = $2
+	`, payoutReference, withdrawalId)
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to complete withdrawal: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit withdrawal completion: %w", err)
+	}
+	return nil
+}
+
+// FailWithdrawal marks a pending withdrawal as failed and refunds the held
+// amount and fee to the wallet they were taken from.
+func (s *PaymentsStore) FailWithdrawal(ctx context.Context, withdrawalId uuid.UUID, reason string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	walletId, amount, currency, err := lockPendingWithdrawal(ctx, tx, withdrawalId)
+	if err != nil {
+		return err
 	}
 
+	_, err = tx.Exec(ctx, `SELECT 1 FROM wallets WHERE id = $1 FOR UPDATE`, walletId)
+	if err != nil {
+		return fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: withdrawalId,
+		Description:   "withdrawal release",
+		Postings: []ledger.Posting{
+			ledger.SystemPosting(ledger.AccountPayoutsPending, currency, -amount),
+			ledger.WalletPosting(walletId, amount),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record release in ledger: %w", err)
+	}
+
+	if err = settleFee(ctx, tx, withdrawalId, ledger.AccountPayoutsPending, false, false); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE transactions SET status = 'failed' WHERE id = $1`, withdrawalId)
+	batch.Queue(`
+		UPDATE withdrawals SET failure_reason = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE transaction_id = $2
+	`, reason, withdrawalId)
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to fail withdrawal: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit withdrawal failure: %w", err)
+	}
 	return nil
 }
+
+func (s *PaymentsStore) GetWithdrawal(ctx context.Context, withdrawalId uuid.UUID) (withdrawal models.Withdrawal, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT
+			t.id,
+			wd.user_id,
+			t.from_wallet_id,
+			t.amount,
+			w.currency,
+			wd.destination,
+			t.status,
+			wd.payout_reference,
+			wd.failure_reason,
+			t.created_at,
+			wd.updated_at
+		FROM transactions t
+		JOIN withdrawals wd ON wd.transaction_id = t.id
+		JOIN wallets w ON w.id = t.from_wallet_id
+		WHERE t.id = $1
+	`, withdrawalId).Scan(
+		&withdrawal.ID,
+		&withdrawal.UserID,
+		&withdrawal.WalletID,
+		&withdrawal.Amount,
+		&withdrawal.Currency,
+		&withdrawal.Destination,
+		&withdrawal.Status,
+		&withdrawal.PayoutReference,
+		&withdrawal.FailureReason,
+		&withdrawal.CreatedAt,
+		&withdrawal.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Withdrawal{}, ErrWithdrawalNotFound
+		}
+		return models.Withdrawal{}, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	return withdrawal, nil
+}
+
+func lockPendingWithdrawal(ctx context.Context, tx pgx.Tx, withdrawalId uuid.UUID) (walletId uuid.UUID, amount int64, currency string, err error) {
+	var status string
+	err = tx.QueryRow(ctx, `
+		SELECT from_wallet_id, amount, currency, status
+		FROM transactions
+		WHERE id = $1 AND type = 'withdrawal'
+		FOR UPDATE
+	`, withdrawalId).Scan(&walletId, &amount, &currency, &status)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, 0, "", ErrWithdrawalNotFound
+		}
+		return uuid.Nil, 0, "", fmt.Errorf("failed to lock withdrawal: %w", err)
+	}
+	if status != "pending" {
+		return uuid.Nil, 0, "", ErrWithdrawalNotPending
+	}
+	return walletId, amount, currency, nil
+}
+
+// missingWalletError tells apart a user that doesn't exist from one without a
+// wallet in the requested currency.
+func missingWalletError(ctx context.Context, tx pgx.Tx, userIds ...uuid.UUID) error {
+	var found int
+	err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE id = ANY($1)`, userIds).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("failed to look up users: %w", err)
+	}
+	if found < len(userIds) {
+		return ErrUserIdNotFound
+	}
+	return ErrWalletNotFound
+}
+
+// RefundPayment moves funds back from the receiver to the sender of a
+// completed payment. Partial refunds are allowed as long as the refunds linked
+// to the original transaction never add up to more than the payment amount.
+func (s *PaymentsStore) RefundPayment(ctx context.Context, refund *models.RefundInsert) (models.Refund, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		receiverId       uuid.UUID
+		paymentAmount    int64
+		currency         string
+		paymentStatus    string
+		originalTxId     uuid.UUID
+		senderWalletId   uuid.UUID
+		receiverWalletId uuid.UUID
+	)
+	// Held and blocked payments have no transaction; their status alone
+	// refuses the refund.
+	err = tx.QueryRow(ctx, `
+		SELECT p.receiver_id, p.amount, p.currency, p.status,
+			COALESCE(t.id, '00000000-0000-0000-0000-000000000000'),
+			COALESCE(t.from_wallet_id, '00000000-0000-0000-0000-000000000000'),
+			COALESCE(t.to_wallet_id, '00000000-0000-0000-0000-000000000000')
+		FROM payments p
+		LEFT JOIN transactions t ON t.id = p.transaction_id
+		WHERE p.id = $1
+		FOR UPDATE OF p
+	`, refund.PaymentID).Scan(&receiverId, &paymentAmount, &currency, &paymentStatus, &originalTxId, &senderWalletId, &receiverWalletId)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Refund{}, ErrPaymentNotFound
+		}
+		return models.Refund{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	if receiverId != refund.RequesterID {
+		return models.Refund{}, ErrRefundNotAllowed
+	}
+	if paymentStatus != "completed" && paymentStatus != "partially_refunded" {
+		return models.Refund{}, ErrPaymentNotRefundable
+	}
+
+	var alreadyRefunded int64
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE type = 'refund' AND status = 'completed' AND reference_id = $1
+	`, originalTxId).Scan(&alreadyRefunded)
+
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("failed to sum previous refunds: %w", err)
+	}
+
+	remaining := paymentAmount - alreadyRefunded
+	amount := refund.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if remaining <= 0 {
+		return models.Refund{}, ErrPaymentNotRefundable
+	}
+	if amount > remaining {
+		return models.Refund{}, ErrRefundExceedsPayment
+	}
+
+	var (
+		receiverBalance int64
+		refunder        walletState
+		refundee        walletState
+	)
+	if err = lockWallets(ctx, tx, `id IN ($1, $2)`, receiverWalletId, senderWalletId); err != nil {
+		return models.Refund{}, err
+	}
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT w1.balance, %s, %s
+		FROM wallets w1 JOIN users u1 ON u1.id = w1.user_id,
+		     wallets w2 JOIN users u2 ON u2.id = w2.user_id
+		WHERE w1.id = $1 AND w2.id = $2
+		FOR SHARE OF u1, u2
+	`, walletStateColumns("w1", "u1"), walletStateColumns("w2", "u2")), receiverWalletId, senderWalletId).Scan(
+		append(append([]any{&receiverBalance}, refunder.scanTargets()...), refundee.scanTargets()...)...,
+	)
+
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("failed to lock wallets: %w", err)
+	}
+
+	if reason := refunder.sendBlock(); reason != "" {
+		return models.Refund{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: refunder.UserID, WalletID: refunder.WalletID, Action: "refund", Amount: amount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+	if reason := refundee.receiveBlock(); reason != "" {
+		return models.Refund{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: refundee.UserID, WalletID: refundee.WalletID, Action: "receive", Amount: amount, Reason: reason,
+		}, ErrCounterpartyUnavailable)
+	}
+	if receiverBalance < amount {
+		return models.Refund{}, ErrInsufficientFunds
+	}
+
+	created := models.Refund{
+		PaymentID:     refund.PaymentID,
+		ReferenceID:   originalTxId,
+		Amount:        amount,
+		Currency:      currency,
+		RefundedTotal: alreadyRefunded + amount,
+		PaymentStatus: "partially_refunded",
+	}
+	if created.RefundedTotal == paymentAmount {
+		created.PaymentStatus = "refunded"
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, currency, status, type, reference_id)
+		VALUES ($1, $2, $3, $4, 'completed', 'refund', $5)
+		RETURNING id, created_at
+	`, receiverWalletId, senderWalletId, amount, currency, originalTxId).Scan(&created.ID, &created.CreatedAt)
+
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("failed to create refund transaction: %w", err)
+	}
+
+	_, err = ledger.Record(ctx, tx, ledger.Entry{
+		TransactionID: created.ID,
+		Description:   "refund",
+		Postings:      ledger.Transfer(receiverWalletId, senderWalletId, amount),
+	})
+	if err != nil {
+		return models.Refund{}, fmt.Errorf("failed to record refund in ledger: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE payments SET status = $1 WHERE id = $2`, created.PaymentStatus, refund.PaymentID)
+	if created.PaymentStatus == "refunded" {
+		batch.Queue(`UPDATE transactions SET status = 'refunded' WHERE id = $1`, originalTxId)
+	}
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return models.Refund{}, fmt.Errorf("failed to apply refund: %w", err)
+	}
+
+	if err = idempotency.BindTx(ctx, tx, created.ID); err != nil {
+		return models.Refund{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Refund{}, fmt.Errorf("failed to commit refund: %w", err)
+	}
+
+	return created, nil
+}
+
+// ConvertCurrency executes an FX quote: the quote is consumed and the sold
+// amount moves from the user's wallet in one currency to the bought amount on
+// their wallet in the other, through the platform's FX account. Each leg is a
+// transaction of its own, both referencing the quote.
+func (s *PaymentsStore) ConvertCurrency(ctx context.Context, userId, quoteId uuid.UUID) (models.Conversion, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Conversion{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		conversion = models.Conversion{QuoteID: quoteId}
+		used       bool
+		expired    bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT from_currency, to_currency, sell_amount, buy_amount, rate::TEXT, used_at IS NOT NULL, expires_at <= CURRENT_TIMESTAMP
+		FROM fx_quotes
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, quoteId, userId).Scan(&conversion.FromCurrency, &conversion.ToCurrency, &conversion.SellAmount,
+		&conversion.BuyAmount, &conversion.Rate, &used, &expired)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Conversion{}, ErrQuoteNotFound
+		}
+		return models.Conversion{}, fmt.Errorf("failed to lock fx quote: %w", err)
+	}
+	if used {
+		return models.Conversion{}, ErrQuoteUsed
+	}
+	if expired {
+		return models.Conversion{}, ErrQuoteExpired
+	}
+
+	var (
+		fromBalance int64
+		from, to    walletState
+	)
+	err = lockWallets(ctx, tx, `user_id = $1 AND currency IN ($2, $3)`,
+		userId, conversion.FromCurrency, conversion.ToCurrency)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT w1.balance, %s, %s
+		FROM wallets w1
+		JOIN users u ON u.id = w1.user_id
+		JOIN wallets w2 ON w2.user_id = u.id
+		WHERE u.id = $1 AND w1.currency = $2 AND w2.currency = $3
+		FOR SHARE OF u
+	`, walletStateColumns("w1", "u"), walletStateColumns("w2", "u")), userId, conversion.FromCurrency, conversion.ToCurrency).Scan(
+		append(append([]any{&fromBalance}, from.scanTargets()...), to.scanTargets()...)...,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Conversion{}, ErrWalletNotFound
+		}
+		return models.Conversion{}, fmt.Errorf("failed to get wallets: %w", err)
+	}
+
+	if reason := from.sendBlock(); reason != "" {
+		return models.Conversion{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: userId, WalletID: from.WalletID, Action: "fx", Amount: conversion.SellAmount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+	if reason := to.receiveBlock(); reason != "" {
+		return models.Conversion{}, s.recordBlockedAttempt(ctx, tx, blockedAttempt{
+			UserID: userId, WalletID: to.WalletID, Action: "fx", Amount: conversion.BuyAmount, Reason: reason,
+		}, ownAccountError(reason))
+	}
+
+	if fromBalance < conversion.SellAmount {
+		return models.Conversion{}, ErrInsufficientFunds
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, currency, status, type, reference_id)
+		VALUES ($1, NULL, $2, $3, 'completed', 'fx_sell', $4)
+		RETURNING id, created_at
+	`, from.WalletID, conversion.SellAmount, conversion.FromCurrency, quoteId).Scan(&conversion.SellTransactionID, &conversion.CreatedAt)
+
+	if err != nil {
+		return models.Conversion{}, fmt.Errorf("failed to create fx sell transaction: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transactions (from_wallet_id, to_wallet_id, amount, currency, status, type, reference_id)
+		VALUES (NULL, $1, $2, $3, 'completed', 'fx_buy', $4)
+		RETURNING id
+	`, to.WalletID, conversion.BuyAmount, conversion.ToCurrency, quoteId).Scan(&conversion.BuyTransactionID)
+
+	if err != nil {
+		return models.Conversion{}, fmt.Errorf("failed to create fx buy transaction: %w", err)
+	}
+
+	entries := []ledger.Entry{
+		{
+			TransactionID: conversion.SellTransactionID,
+			Description:   "fx sell " + conversion.FromCurrency,
+			Postings: []ledger.Posting{
+				ledger.WalletPosting(from.WalletID, -conversion.SellAmount),
+				ledger.SystemPosting(ledger.AccountFX, conversion.FromCurrency, conversion.SellAmount),
+			},
+		},
+		{
+			TransactionID: conversion.BuyTransactionID,
+			Description:   "fx buy " + conversion.ToCurrency,
+			Postings: []ledger.Posting{
+				ledger.SystemPosting(ledger.AccountFX, conversion.ToCurrency, -conversion.BuyAmount),
+				ledger.WalletPosting(to.WalletID, conversion.BuyAmount),
+			},
+		},
+	}
+	for _, entry := range entries {
+		if _, err = ledger.Record(ctx, tx, entry); err != nil {
+			return models.Conversion{}, fmt.Errorf("failed to record conversion in ledger: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE fx_quotes
+		SET used_at = CURRENT_TIMESTAMP, sell_transaction_id = $2, buy_transaction_id = $3
+		WHERE id = $1
+	`, quoteId, conversion.SellTransactionID, conversion.BuyTransactionID)
+
+	if err != nil {
+		return models.Conversion{}, fmt.Errorf("failed to mark fx quote used: %w", err)
+	}
+
+	if err = idempotency.BindTx(ctx, tx, quoteId); err != nil {
+		return models.Conversion{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Conversion{}, fmt.Errorf("failed to commit conversion: %w", err)
+	}
+
+	return conversion, nil
+}
@@ -0,0 +1,35 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"paygo/models"
+)
+
+type ReconcileServiceInterface interface {
+	Run(ctx context.Context) (models.ReconciliationReport, error)
+}
+
+type ReconcileHandler struct {
+	service ReconcileServiceInterface
+}
+
+func NewReconcileHandler(s ReconcileServiceInterface) *ReconcileHandler {
+	return &ReconcileHandler{service: s}
+}
+
+func (h *ReconcileHandler) RunReconciliation(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.Run(r.Context())
+	if err != nil {
+		log.Printf("handler: error running reconciliation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("handler: error encoding reconciliation report: %v", err)
+	}
+}
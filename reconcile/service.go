@@ -0,0 +1,97 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"paygo/models"
+	"time"
+)
+
+type ReconcileStoreInterface interface {
+	GetWalletBalances(ctx context.Context) ([]WalletBalance, error)
+	GetLedgerImbalance(ctx context.Context) (int64, error)
+}
+
+type ReconcileService struct {
+	store ReconcileStoreInterface
+}
+
+func NewReconcileService(store ReconcileStoreInterface) *ReconcileService {
+	return &ReconcileService{store: store}
+}
+
+func (s *ReconcileService) Run(ctx context.Context) (models.ReconciliationReport, error) {
+	report := models.ReconciliationReport{
+		StartedAt:  time.Now(),
+		Mismatches: []models.BalanceMismatch{},
+	}
+
+	balances, err := s.store.GetWalletBalances(ctx)
+	if err != nil {
+		return models.ReconciliationReport{}, fmt.Errorf("service: reconciling balances: %w", err)
+	}
+
+	for _, balance := range balances {
+		if balance.Actual == balance.Expected {
+			continue
+		}
+		report.Mismatches = append(report.Mismatches, models.BalanceMismatch{
+			WalletID: balance.WalletID,
+			Expected: balance.Expected,
+			Actual:   balance.Actual,
+			Drift:    balance.Actual - balance.Expected,
+		})
+	}
+
+	report.LedgerImbalance, err = s.store.GetLedgerImbalance(ctx)
+	if err != nil {
+		return models.ReconciliationReport{}, fmt.Errorf("service: checking ledger: %w", err)
+	}
+
+	report.WalletsChecked = len(balances)
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// StartScheduler runs the reconciliation every interval until ctx is
+// cancelled and logs every mismatch it finds. The returned channel is closed
+// once it has stopped. A zero interval disables it.
+func (s *ReconcileService) StartScheduler(ctx context.Context, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	if interval <= 0 {
+		close(stopped)
+		return stopped
+	}
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := s.Run(ctx)
+				if err != nil {
+					log.Printf("reconcile: run failed: %v", err)
+					continue
+				}
+				LogReport(report)
+			}
+		}
+	}()
+	return stopped
+}
+
+func LogReport(report models.ReconciliationReport) {
+	for _, m := range report.Mismatches {
+		log.Printf("reconcile: wallet %s expected %d actual %d drift %d", m.WalletID, m.Expected, m.Actual, m.Drift)
+	}
+	if report.LedgerImbalance != 0 {
+		log.Printf("reconcile: ledger postings sum to %d instead of 0", report.LedgerImbalance)
+	}
+	log.Printf("reconcile: checked %d wallets, %d mismatches", report.WalletsChecked, len(report.Mismatches))
+}
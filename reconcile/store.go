@@ -0,0 +1,84 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WalletBalance struct {
+	WalletID uuid.UUID
+	Expected int64
+	Actual   int64
+}
+
+type ReconcileStore struct {
+	db *pgxpool.Pool
+}
+
+func NewReconcileStore(db *pgxpool.Pool) *ReconcileStore {
+	return &ReconcileStore{db}
+}
+
+// GetWalletBalances recomputes every wallet's balance from the transaction
+// history. Completed movements count on both sides; a pending withdrawal or
+// held payment and its fee have already been taken off the wallet, so they
+// count on the sending side only.
+// Failed transactions never moved money.
+func (s *ReconcileStore) GetWalletBalances(ctx context.Context) ([]WalletBalance, error) {
+	rows, err := s.db.Query(ctx, `
+		WITH movements AS (
+			SELECT to_wallet_id AS wallet_id, amount
+			FROM transactions
+			WHERE to_wallet_id IS NOT NULL
+				AND status IN ('completed', 'refunded')
+			UNION ALL
+			SELECT from_wallet_id AS wallet_id, -amount
+			FROM transactions
+			WHERE from_wallet_id IS NOT NULL
+				AND (
+					status IN ('completed', 'refunded')
+					OR (type IN ('withdrawal', 'payment', 'fee') AND status = 'pending')
+				)
+		)
+		SELECT w.id, COALESCE(SUM(m.amount), 0), w.balance
+		FROM wallets w
+		LEFT JOIN movements m ON m.wallet_id = w.id
+		GROUP BY w.id, w.balance
+		ORDER BY w.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to recompute wallet balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []WalletBalance
+	for rows.Next() {
+		var balance WalletBalance
+		if err := rows.Scan(&balance.WalletID, &balance.Expected, &balance.Actual); err != nil {
+			return nil, fmt.Errorf("store: failed to scan wallet balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating wallet balances: %w", err)
+	}
+	return balances, nil
+}
+
+// GetLedgerImbalance sums the postings of each currency and adds up how far
+// each is from zero. Amounts in different currencies must not cancel out, so
+// the result is zero only if every currency balances on its own.
+func (s *ReconcileStore) GetLedgerImbalance(ctx context.Context) (imbalance int64, err error) {
+	err = s.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(ABS(total)), 0)::BIGINT
+		FROM (SELECT SUM(amount) AS total FROM postings GROUP BY currency) per_currency
+	`).Scan(&imbalance)
+	if err != nil {
+		return 0, fmt.Errorf("store: failed to sum postings: %w", err)
+	}
+	return imbalance, nil
+}
@@ -0,0 +1,11 @@
+package roles
+
+import "errors"
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrRoleAlreadyGranted = errors.New("role already granted to user")
+	ErrRoleNotGranted     = errors.New("role is not granted to user")
+	ErrSelfRevoke         = errors.New("cannot revoke your own role")
+)
@@ -0,0 +1,156 @@
+package roles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"paygo/models"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+type RoleServiceInterface interface {
+	GetAllRoles(ctx context.Context) ([]models.Role, error)
+	GetUserRoles(ctx context.Context, userId uuid.UUID) ([]string, error)
+	GrantRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error
+	RevokeRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error
+	GetAuditLog(ctx context.Context, userId *uuid.UUID, limit int) ([]models.RoleAuditEntry, error)
+}
+
+type RoleHandler struct {
+	service RoleServiceInterface
+}
+
+func NewRoleHandler(s RoleServiceInterface) *RoleHandler {
+	return &RoleHandler{service: s}
+}
+
+func (h *RoleHandler) GetAllRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.GetAllRoles(r.Context())
+	if err != nil {
+		log.Printf("handler: error fetching roles: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+func (h *RoleHandler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := h.service.GetUserRoles(r.Context(), userId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"user_id": userId, "roles": roles})
+}
+
+func (h *RoleHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	actorId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Role == "" {
+		http.Error(w, "role is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.GrantRole(r.Context(), &actorId, userId, body.Role); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RoleHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	actorId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeRole(r.Context(), &actorId, userId, r.PathValue("role")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAuditLog lists role changes, newest first. ?user_id= narrows it to one
+// user and ?limit= caps the number of entries (default 100).
+func (h *RoleHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	var userId *uuid.UUID
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userId = &parsed
+	}
+
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := h.service.GetAuditLog(r.Context(), userId, limit)
+	if err != nil {
+		log.Printf("handler: error fetching role audit log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrRoleAlreadyGranted), errors.Is(err, ErrRoleNotGranted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrSelfRevoke):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("handler: error changing roles: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,69 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+	"paygo/models"
+
+	"github.com/google/uuid"
+)
+
+type RoleStoreInterface interface {
+	GetAllRoles(ctx context.Context) ([]models.Role, error)
+	GetUserRoles(ctx context.Context, userId uuid.UUID) ([]string, error)
+	GrantRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error
+	RevokeRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error
+	GetAuditLog(ctx context.Context, userId *uuid.UUID, limit int) ([]models.RoleAuditEntry, error)
+	GetUserIdByEmail(ctx context.Context, email string) (uuid.UUID, error)
+}
+
+type RoleService struct {
+	store RoleStoreInterface
+}
+
+func NewRoleService(store RoleStoreInterface) *RoleService {
+	return &RoleService{store: store}
+}
+
+func (s *RoleService) GetAllRoles(ctx context.Context) ([]models.Role, error) {
+	roles, err := s.store.GetAllRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *RoleService) GetUserRoles(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	return s.store.GetUserRoles(ctx, userId)
+}
+
+func (s *RoleService) GrantRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error {
+	return s.store.GrantRole(ctx, actorId, userId, role)
+}
+
+// RevokeRole refuses to let an admin strip their own roles so the last admin
+// cannot lock everyone out by accident.
+func (s *RoleService) RevokeRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error {
+	if actorId != nil && *actorId == userId {
+		return ErrSelfRevoke
+	}
+	return s.store.RevokeRole(ctx, actorId, userId, role)
+}
+
+func (s *RoleService) GetAuditLog(ctx context.Context, userId *uuid.UUID, limit int) ([]models.RoleAuditEntry, error) {
+	entries, err := s.store.GetAuditLog(ctx, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get role audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// GrantRoleByEmail is used by the `grant-role` CLI command to bootstrap the
+// first admin.
+func (s *RoleService) GrantRoleByEmail(ctx context.Context, email, role string) error {
+	userId, err := s.store.GetUserIdByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	return s.store.GrantRole(ctx, nil, userId, role)
+}
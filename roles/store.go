@@ -0,0 +1,210 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RoleStore struct {
+	db *pgxpool.Pool
+}
+
+func NewRoleStore(db *pgxpool.Pool) *RoleStore {
+	return &RoleStore{db}
+}
+
+func (s *RoleStore) GetAllRoles(ctx context.Context) ([]models.Role, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.name, r.description, COALESCE(ARRAY_AGG(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name, r.description
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.Permissions); err != nil {
+			return nil, fmt.Errorf("store: failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *RoleStore) GetUserRoles(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userId).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to check user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	var roles []string
+	err = s.db.QueryRow(ctx, `
+		SELECT COALESCE(ARRAY_AGG(role ORDER BY role), '{}') FROM user_roles WHERE user_id = $1
+	`, userId).Scan(&roles)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch user roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GrantRole gives role to the user and records the change in the audit log
+// within the same transaction. actorId is nil for changes made from the CLI.
+func (s *RoleStore) GrantRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkRoleAndUser(ctx, tx, userId, role); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role) DO NOTHING
+	`, userId, role, actorId)
+	if err != nil {
+		return fmt.Errorf("store: failed to grant role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleAlreadyGranted
+	}
+
+	if err := insertAudit(ctx, tx, actorId, userId, role, "grant"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit role grant: %w", err)
+	}
+	return nil
+}
+
+func (s *RoleStore) RevokeRole(ctx context.Context, actorId *uuid.UUID, userId uuid.UUID, role string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkRoleAndUser(ctx, tx, userId, role); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userId, role)
+	if err != nil {
+		return fmt.Errorf("store: failed to revoke role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotGranted
+	}
+
+	if err := insertAudit(ctx, tx, actorId, userId, role, "revoke"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit role revocation: %w", err)
+	}
+	return nil
+}
+
+func (s *RoleStore) GetAuditLog(ctx context.Context, userId *uuid.UUID, limit int) ([]models.RoleAuditEntry, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, actor_id, target_user_id, role, action, created_at
+		FROM role_audit_log
+		WHERE $1::uuid IS NULL OR target_user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch role audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.RoleAuditEntry{}
+	for rows.Next() {
+		var entry models.RoleAuditEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.TargetUserID,
+			&entry.Role,
+			&entry.Action,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("store: failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// GetUserIdByEmail lets the CLI address users by email.
+func (s *RoleStore) GetUserIdByEmail(ctx context.Context, email string) (userId uuid.UUID, err error) {
+	err = s.db.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrUserNotFound
+		}
+		return uuid.Nil, fmt.Errorf("store: failed to fetch user: %w", err)
+	}
+	return userId, nil
+}
+
+func checkRoleAndUser(ctx context.Context, tx pgx.Tx, userId uuid.UUID, role string) error {
+	var roleExists, userExists bool
+	err := tx.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM roles WHERE name = $1),
+			EXISTS (SELECT 1 FROM users WHERE id = $2)
+	`, role, userId).Scan(&roleExists, &userExists)
+	if err != nil {
+		return fmt.Errorf("store: failed to check role and user: %w", err)
+	}
+	if !roleExists {
+		return ErrRoleNotFound
+	}
+	if !userExists {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func insertAudit(ctx context.Context, tx pgx.Tx, actorId *uuid.UUID, userId uuid.UUID, role, action string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO role_audit_log (actor_id, target_user_id, role, action)
+		VALUES ($1, $2, $3, $4)
+	`, actorId, userId, role, action)
+	if err != nil {
+		return fmt.Errorf("store: failed to write role audit log: %w", err)
+	}
+	return nil
+}
@@ -3,39 +3,177 @@ package routes
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"paygo/aml"
+	"paygo/auth"
 	"paygo/config"
 	database "paygo/db"
+	"paygo/fraud"
+	"paygo/fx"
+	"paygo/idempotency"
+	"paygo/mailer"
 	"paygo/md"
 	"paygo/payments"
+	"paygo/reconcile"
+	"paygo/roles"
+	"paygo/screening"
 	"paygo/users"
 )
 
-func CreateRouter(ctx context.Context, mux *http.ServeMux, config config.Config) *http.ServeMux {
+// Services are the services running background jobs, which main starts and
+// stops cleanly on shutdown.
+type Services struct {
+	Payments  *payments.PaymentService
+	Reconcile *reconcile.ReconcileService
+	AML       *aml.AMLService
+}
+
+// CreateRouter wires the stores, services and handlers onto mux. It also
+// returns the services whose background jobs main runs.
+func CreateRouter(ctx context.Context, mux *http.ServeMux, config config.Config) (*http.ServeMux, Services) {
 
 	db := database.Connect(ctx, config.DatabaseURL)
 
-	paymentsStore := payments.NewPaymentsStore(db)
-	paymentsService := payments.NewPaymentService(paymentsStore)
-	paymentHandler := payments.NewPaymentsHandler(paymentsService)
+	screener, err := screening.NewScreener(config.Screening)
+	if err != nil {
+		log.Fatalf("Invalid sanctions watchlist: %v", err)
+	}
+
+	fxRates, err := fx.NewRateProvider(config.FX)
+	if err != nil {
+		log.Fatalf("Invalid FX rate provider: %v", err)
+	}
 
-	userStore := users.NewUserStore(db)
-	userService := users.NewUserService(userStore)
+	paymentsStore := payments.NewPaymentsStore(db, config.Limits, fraud.NewEngine(config.Fraud), config.Review.SLA, screener, fxRates)
+	paymentsService := payments.NewPaymentService(paymentsStore, payments.NewFakePayoutProcessor(), config.Fees, config.Schedules, config.Withdrawals)
+
+	authStore := auth.NewAuthStore(db, screener)
+	authService := auth.NewAuthService(authStore, mailer.New(config.Mail), config.PublicURL, config.LoginThrottle)
+	authHandler := auth.NewAuthHandler(authService, config.TrustProxyHeaders)
+	paymentHandler := payments.NewPaymentsHandler(paymentsService, authService, config.StepUpThresholds)
+
+	userStore := users.NewUserStore(db, screener)
+	userService := users.NewUserService(userStore, authService, config.Limits.Tiers())
 	userHandler := users.NewUserHandler(userService)
+	auth.SetRevocationList(authStore)
+
+	keySet, err := auth.NewKeySet(config.JWT)
+	if err != nil {
+		log.Fatalf("Invalid JWT signing keys: %v", err)
+	}
+	auth.SetKeySet(keySet)
+
+	reconcileStore := reconcile.NewReconcileStore(db)
+	reconcileService := reconcile.NewReconcileService(reconcileStore)
+	reconcileHandler := reconcile.NewReconcileHandler(reconcileService)
+
+	roleStore := roles.NewRoleStore(db)
+	roleService := roles.NewRoleService(roleStore)
+	roleHandler := roles.NewRoleHandler(roleService)
+
+	fxStore := fx.NewFXStore(db)
+	fxService := fx.NewFXService(fxStore, fxRates, config.FX)
+	fxHandler := fx.NewFXHandler(fxService)
+
+	screeningStore := screening.NewScreeningStore(db)
+	screeningService := screening.NewScreeningService(screeningStore)
+	screeningHandler := screening.NewScreeningHandler(screeningService)
+
+	amlStore := aml.NewAMLStore(db)
+	amlService := aml.NewAMLService(amlStore, config.AML)
+	amlHandler := aml.NewAMLHandler(amlService)
+
+	idempotencyStore := idempotency.NewIdempotencyStore(db)
+	idempotent := md.IdempotencyMiddleware(idempotencyStore)
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Welcome to PayGo API!")
 	})
 
-	mux.HandleFunc("GET /payments", paymentHandler.GetAllPayments)
-	mux.HandleFunc("GET /user/payments", paymentHandler.GetPaymentsByUserId)
+	mux.HandleFunc("GET /.well-known/jwks.json", authHandler.HandleJWKS)
+	mux.HandleFunc("POST /auth/register", authHandler.HandleRegister)
+	mux.HandleFunc("POST /auth/login", authHandler.HandleLogin)
+	mux.HandleFunc("POST /auth/login/totp", authHandler.HandleLoginTOTP)
+	mux.HandleFunc("POST /auth/refresh", authHandler.HandleRefresh)
+	mux.Handle("POST /auth/totp/enroll", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleEnrollTOTP)))
+	mux.Handle("POST /auth/totp/confirm", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleConfirmTOTP)))
+	mux.Handle("POST /auth/totp/disable", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleDisableTOTP)))
+	mux.Handle("POST /auth/verify-email/resend", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleResendVerification)))
+	mux.HandleFunc("POST /auth/verify-email", authHandler.HandleVerifyEmail)
+	mux.HandleFunc("POST /auth/password-reset", authHandler.HandleRequestPasswordReset)
+	mux.HandleFunc("POST /auth/password-reset/confirm", authHandler.HandleResetPassword)
+	mux.Handle("POST /auth/logout", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleLogout)))
+	mux.Handle("POST /auth/logout-all", md.AuthMiddleware(http.HandlerFunc(authHandler.HandleLogoutAll)))
+
+	mux.Handle("GET /payments", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReadAll)(http.HandlerFunc(paymentHandler.GetAllPayments))))
+	mux.Handle("GET /user/payments", md.AuthMiddleware(http.HandlerFunc(paymentHandler.GetPaymentsByUserId)))
+
+	mux.Handle("GET /limits", md.AuthMiddleware(http.HandlerFunc(paymentHandler.GetLimits)))
+	mux.Handle("POST /payments/quote", md.AuthMiddleware(http.HandlerFunc(paymentHandler.QuoteFee)))
+	mux.Handle("POST /pay", md.AuthMiddleware(idempotent(http.HandlerFunc(paymentHandler.InsertPayment))))
+	mux.Handle("POST /deposit", md.AuthMiddleware(idempotent(http.HandlerFunc(paymentHandler.Deposit))))
+	mux.Handle("POST /payments/{id}/refund", md.AuthMiddleware(idempotent(http.HandlerFunc(paymentHandler.RefundPayment))))
+	mux.Handle("POST /withdraw", md.AuthMiddleware(idempotent(http.HandlerFunc(paymentHandler.Withdraw))))
+
+	mux.Handle("GET /schedules", md.AuthMiddleware(http.HandlerFunc(paymentHandler.GetSchedules)))
+	mux.Handle("POST /schedules", md.AuthMiddleware(http.HandlerFunc(paymentHandler.CreateSchedule)))
+	mux.Handle("POST /schedules/{id}/pause", md.AuthMiddleware(http.HandlerFunc(paymentHandler.PauseSchedule)))
+	mux.Handle("POST /schedules/{id}/resume", md.AuthMiddleware(http.HandlerFunc(paymentHandler.ResumeSchedule)))
+	mux.Handle("POST /schedules/{id}/cancel", md.AuthMiddleware(http.HandlerFunc(paymentHandler.CancelSchedule)))
+
+	mux.Handle("POST /fx/quotes", md.AuthMiddleware(http.HandlerFunc(fxHandler.CreateQuote)))
+	mux.Handle("GET /fx/quotes/{id}", md.AuthMiddleware(http.HandlerFunc(fxHandler.GetQuote)))
+	mux.Handle("POST /fx/convert", md.AuthMiddleware(idempotent(http.HandlerFunc(paymentHandler.Convert))))
+
+	mux.Handle("GET /admin/payments/{id}/fraud", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReadAll)(http.HandlerFunc(paymentHandler.GetFraudDecision))))
+
+	mux.Handle("GET /admin/reviews", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReview)(http.HandlerFunc(paymentHandler.ListReviews))))
+	mux.Handle("POST /admin/reviews/{id}/claim", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReview)(http.HandlerFunc(paymentHandler.ClaimReview))))
+	mux.Handle("POST /admin/reviews/{id}/approve", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReview)(http.HandlerFunc(paymentHandler.ApproveReview))))
+	mux.Handle("POST /admin/reviews/{id}/reject", md.AuthMiddleware(md.RequirePermission(auth.PermPaymentsReview)(http.HandlerFunc(paymentHandler.RejectReview))))
+
+	mux.Handle("GET /admin/screening/hits", md.AuthMiddleware(md.RequirePermission(auth.PermComplianceReview)(http.HandlerFunc(screeningHandler.ListHits))))
+	mux.Handle("POST /admin/screening/hits/{id}/clear", md.AuthMiddleware(md.RequirePermission(auth.PermComplianceReview)(http.HandlerFunc(screeningHandler.ClearHit))))
+	mux.Handle("POST /admin/screening/hits/{id}/confirm", md.AuthMiddleware(md.RequirePermission(auth.PermComplianceReview)(http.HandlerFunc(screeningHandler.ConfirmHit))))
+
+	mux.Handle("POST /admin/aml/scan", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.RunScan))))
+	mux.Handle("GET /admin/aml/cases", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.ListCases))))
+	mux.Handle("GET /admin/aml/cases/{id}", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.GetCase))))
+	mux.Handle("GET /admin/aml/cases/{id}/report", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.ExportCase))))
+	mux.Handle("POST /admin/aml/cases/{id}/notes", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.AddNote))))
+	mux.Handle("POST /admin/aml/cases/{id}/escalate", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.EscalateCase))))
+	mux.Handle("POST /admin/aml/cases/{id}/close", md.AuthMiddleware(md.RequirePermission(auth.PermAMLCases)(http.HandlerFunc(amlHandler.CloseCase))))
+
+	mux.Handle("GET /admin/reconcile", md.AuthMiddleware(md.RequirePermission(auth.PermReconcileRun)(http.HandlerFunc(reconcileHandler.RunReconciliation))))
+
+	mux.Handle("GET /admin/roles", md.AuthMiddleware(md.RequirePermission(auth.PermRolesRead)(http.HandlerFunc(roleHandler.GetAllRoles))))
+	mux.Handle("GET /admin/roles/audit", md.AuthMiddleware(md.RequirePermission(auth.PermRolesRead)(http.HandlerFunc(roleHandler.GetAuditLog))))
+	mux.Handle("GET /admin/users/{id}/roles", md.AuthMiddleware(md.RequirePermission(auth.PermRolesRead)(http.HandlerFunc(roleHandler.GetUserRoles))))
+	mux.Handle("POST /admin/users/{id}/roles", md.AuthMiddleware(md.RequirePermission(auth.PermRolesManage)(http.HandlerFunc(roleHandler.GrantRole))))
+	mux.Handle("DELETE /admin/users/{id}/roles/{role}", md.AuthMiddleware(md.RequirePermission(auth.PermRolesManage)(http.HandlerFunc(roleHandler.RevokeRole))))
+
+	mux.Handle("POST /admin/users/{id}/unlock", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(authHandler.HandleUnlockLogin))))
 
-	mux.Handle("POST /pay", md.AuthMiddleware(http.HandlerFunc(paymentHandler.InsertPayment)))
-	mux.Handle("POST /deposit", md.AuthMiddleware(http.HandlerFunc(paymentHandler.Deposit)))
+	mux.Handle("GET /admin/users/{id}/limits", md.AuthMiddleware(md.RequirePermission(auth.PermUsersReadAll)(http.HandlerFunc(userHandler.GetLimitOverrides))))
+	mux.Handle("PUT /admin/users/{id}/limits", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.SetLimitOverride))))
+	mux.Handle("DELETE /admin/users/{id}/limits/{type}/{currency}", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.DeleteLimitOverride))))
+	mux.Handle("POST /admin/users/{id}/kyc-tier", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.SetKYCTier))))
+	mux.Handle("POST /admin/users/{id}/freeze", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.FreezeUser))))
+	mux.Handle("POST /admin/users/{id}/unfreeze", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.UnfreezeUser))))
+	mux.Handle("POST /admin/users/{id}/close", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.CloseUser))))
+	mux.Handle("GET /admin/users/{id}/status-log", md.AuthMiddleware(md.RequirePermission(auth.PermUsersReadAll)(http.HandlerFunc(userHandler.GetStatusLog))))
+	mux.Handle("POST /admin/wallets/{id}/freeze", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.FreezeWallet))))
+	mux.Handle("POST /admin/wallets/{id}/unfreeze", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.UnfreezeWallet))))
+	mux.Handle("POST /admin/wallets/{id}/close", md.AuthMiddleware(md.RequirePermission(auth.PermUsersManage)(http.HandlerFunc(userHandler.CloseWallet))))
+	mux.Handle("GET /admin/blocked-attempts", md.AuthMiddleware(md.RequirePermission(auth.PermUsersReadAll)(http.HandlerFunc(userHandler.GetBlockedAttempts))))
 
-	mux.HandleFunc("GET /users", userHandler.GetAllUsers)
-	mux.HandleFunc("GET /user", userHandler.GetUserById)
+	mux.Handle("GET /users", md.AuthMiddleware(md.RequirePermission(auth.PermUsersReadAll)(http.HandlerFunc(userHandler.GetAllUsers))))
+	mux.Handle("GET /user", md.AuthMiddleware(http.HandlerFunc(userHandler.GetUserById)))
 	mux.HandleFunc("POST /user", userHandler.CreateUser)
+	mux.Handle("GET /wallets", md.AuthMiddleware(http.HandlerFunc(userHandler.GetWallets)))
+	mux.Handle("POST /wallets", md.AuthMiddleware(http.HandlerFunc(userHandler.CreateWallet)))
+	mux.HandleFunc("GET /currencies", userHandler.GetCurrencies)
 
-	return mux
+	return mux, Services{Payments: paymentsService, Reconcile: reconcileService, AML: amlService}
 }
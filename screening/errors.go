@@ -0,0 +1,11 @@
+package screening
+
+import "errors"
+
+var (
+	ErrHitNotFound      = errors.New("No screening hit found with the ID passed")
+	ErrHitResolved      = errors.New("Screening hit has already been reviewed")
+	ErrInvalidHitStatus = errors.New("status must be pending, cleared or confirmed")
+	ErrNoteRequired     = errors.New("A note explaining the decision is required")
+	ErrSelfReview       = errors.New("Reviewers can't resolve screening hits against themselves")
+)
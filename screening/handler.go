@@ -0,0 +1,108 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"paygo/models"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+type ScreeningServiceInterface interface {
+	ListHits(ctx context.Context, status string, limit int) ([]models.ScreeningHit, error)
+	ClearHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, note string) (models.ScreeningHit, error)
+	ConfirmHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, note string) (models.ScreeningHit, error)
+}
+
+type ScreeningHandler struct {
+	service ScreeningServiceInterface
+}
+
+func NewScreeningHandler(s ScreeningServiceInterface) *ScreeningHandler {
+	return &ScreeningHandler{service: s}
+}
+
+// ListHits shows compliance the screening hits in ?status=, pending ones by
+// default.
+func (h *ScreeningHandler) ListHits(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	hits, err := h.service.ListHits(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidHitStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("handler: error listing screening hits: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
+
+// ClearHit dismisses a hit as a false positive, releasing the user if
+// nothing else holds them.
+func (h *ScreeningHandler) ClearHit(w http.ResponseWriter, r *http.Request) {
+	h.resolve(w, r, h.service.ClearHit)
+}
+
+// ConfirmHit upholds a hit and freezes the user.
+func (h *ScreeningHandler) ConfirmHit(w http.ResponseWriter, r *http.Request) {
+	h.resolve(w, r, h.service.ConfirmHit)
+}
+
+func (h *ScreeningHandler) resolve(w http.ResponseWriter, r *http.Request,
+	resolve func(ctx context.Context, hitId int64, reviewerId uuid.UUID, note string) (models.ScreeningHit, error)) {
+
+	reviewerId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	hitId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid screening hit ID", http.StatusBadRequest)
+		return
+	}
+
+	var body models.ScreeningReview
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed parsing review", http.StatusBadRequest)
+		return
+	}
+
+	hit, err := resolve(r.Context(), hitId, reviewerId, body.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoteRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrHitNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrHitResolved):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrSelfReview):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("handler: error reviewing screening hit: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hit)
+}
@@ -0,0 +1,62 @@
+package screening
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"accents and case", "MÜLLER, Hans", "hans muller"},
+		{"already normalized", "hans muller", "hans muller"},
+		{"precomposed and combining accents alike", "José García", "garcia jose"},
+		{"punctuation splits words", "O'Brien-Smith, Seán", "brien o sean smith"},
+		{"ligature folded", "ﬁsher", "fisher"},
+		{"fullwidth folded", "ＡＢＣ Trading", "abc trading"},
+		{"digits kept", "Unit 42 Holdings", "42 holdings unit"},
+		{"whitespace collapsed", "  Ivan\t\tPetrov  ", "ivan petrov"},
+		{"empty", "", ""},
+		{"only punctuation", "-- ,. --", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalize(tt.in); got != tt.want {
+				t.Errorf("normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"identical", "hans muller", "hans muller", 1},
+		{"one empty", "hans", "", 0},
+		{"nothing in common", "abc", "xyz", 0},
+		{"one transposition", "martha", "marhta", 0.9611},
+		{"odd number of out-of-order matches", "abcxyz", "bcaxyz", 0.9167},
+		{"substitution and deletion", "dwayne", "duane", 0.84},
+		{"insertions", "dixon", "dicksonx", 0.8133},
+		{"common prefix rewarded", "jellyfish", "smellyfish", 0.8963},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := similarity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-4 {
+				t.Errorf("similarity(%q, %q) = %.4f, want %.4f", tt.a, tt.b, got, tt.want)
+			}
+			if reverse := similarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+				t.Errorf("similarity(%q, %q) = %.4f, not symmetric with %.4f", tt.b, tt.a, reverse, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package screening
+
+import (
+	"fmt"
+	"paygo/config"
+	"sort"
+)
+
+// Match is a watchlist entry a screened name resembles.
+type Match struct {
+	EntryUID   string
+	ListedName string // the name or alias of the entry that matched best
+	Programs   string
+	Score      float64 // similarity from 0 to 1
+}
+
+// Screener matches names against a watchlist. Without one configured it
+// matches nothing.
+type Screener struct {
+	entries   []indexedEntry
+	threshold float64
+}
+
+type indexedEntry struct {
+	Entry
+	normalized []string // Names, normalized
+}
+
+func NewScreener(cfg config.ScreeningConfig) (*Screener, error) {
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		return nil, fmt.Errorf("screening threshold must be above 0 and at most 1, got %v", cfg.Threshold)
+	}
+
+	s := &Screener{threshold: cfg.Threshold}
+	if cfg.WatchlistFile == "" {
+		return s, nil
+	}
+
+	entries, err := LoadWatchlist(cfg.WatchlistFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		indexed := indexedEntry{Entry: entry}
+		for _, name := range entry.Names {
+			indexed.normalized = append(indexed.normalized, normalize(name))
+		}
+		s.entries = append(s.entries, indexed)
+	}
+	return s, nil
+}
+
+// Enabled reports whether a watchlist is loaded.
+func (s *Screener) Enabled() bool {
+	return len(s.entries) > 0
+}
+
+// Screen returns the entries whose best-matching name scores at least the
+// threshold against name, best first.
+func (s *Screener) Screen(name string) []Match {
+	screened := normalize(name)
+	if screened == "" {
+		return nil
+	}
+
+	var matches []Match
+	for _, entry := range s.entries {
+		best := Match{EntryUID: entry.UID, Programs: entry.Programs}
+		for i, listed := range entry.normalized {
+			if score := similarity(screened, listed); score > best.Score {
+				best.Score, best.ListedName = score, entry.Names[i]
+			}
+		}
+		if best.Score >= s.threshold {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
@@ -0,0 +1,52 @@
+package screening
+
+import (
+	"context"
+	"paygo/models"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type ScreeningStoreInterface interface {
+	ListHits(ctx context.Context, status string, limit int) ([]models.ScreeningHit, error)
+	ResolveHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, confirm bool, note string) (models.ScreeningHit, error)
+}
+
+type ScreeningService struct {
+	store ScreeningStoreInterface
+}
+
+func NewScreeningService(store ScreeningStoreInterface) *ScreeningService {
+	return &ScreeningService{store: store}
+}
+
+// ListHits returns the hits in status, pending ones by default.
+func (s *ScreeningService) ListHits(ctx context.Context, status string, limit int) ([]models.ScreeningHit, error) {
+	if status == "" {
+		status = "pending"
+	}
+	if !slices.Contains([]string{"pending", "cleared", "confirmed"}, status) {
+		return nil, ErrInvalidHitStatus
+	}
+	return s.store.ListHits(ctx, status, limit)
+}
+
+// ClearHit marks a hit as a false positive.
+func (s *ScreeningService) ClearHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, note string) (models.ScreeningHit, error) {
+	return s.resolve(ctx, hitId, reviewerId, false, note)
+}
+
+// ConfirmHit marks a hit as a true sanctions match.
+func (s *ScreeningService) ConfirmHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, note string) (models.ScreeningHit, error) {
+	return s.resolve(ctx, hitId, reviewerId, true, note)
+}
+
+func (s *ScreeningService) resolve(ctx context.Context, hitId int64, reviewerId uuid.UUID, confirm bool, note string) (models.ScreeningHit, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return models.ScreeningHit{}, ErrNoteRequired
+	}
+	return s.store.ResolveHit(ctx, hitId, reviewerId, confirm, note)
+}
@@ -0,0 +1,263 @@
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paygo/models"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Status reasons of users frozen by screening: pending review, and after
+// compliance confirmed the match.
+const (
+	ReasonPending   = "screening"
+	ReasonConfirmed = "sanctions_match"
+)
+
+// DB is satisfied by both the pool and a transaction.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Hit is a match to record against a user.
+type Hit struct {
+	Match
+	UserID       uuid.UUID
+	Context      string     // 'registration' or 'payment'
+	InitiatorID  *uuid.UUID // the payer, for payments
+	ScreenedName string
+}
+
+// RecordHits stores hits for compliance review. A user already pending review
+// for the same entry isn't recorded twice.
+func RecordHits(ctx context.Context, db DB, hits []Hit) error {
+	for _, hit := range hits {
+		_, err := db.Exec(ctx, `
+			INSERT INTO screening_hits (user_id, context, initiator_id, screened_name, entry_uid, listed_name, programs, score)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_id, entry_uid) WHERE status = 'pending' DO NOTHING
+		`, hit.UserID, hit.Context, hit.InitiatorID, hit.ScreenedName, hit.EntryUID, hit.ListedName, hit.Programs, hit.Score)
+
+		if err != nil {
+			return fmt.Errorf("failed to record screening hit: %w", err)
+		}
+	}
+	return nil
+}
+
+// HoldNewUser screens a user being registered in tx. On a hit it records it
+// and freezes the user, incoming funds included, until compliance reviews
+// it. It reports whether the user was frozen.
+func (s *Screener) HoldNewUser(ctx context.Context, tx pgx.Tx, userId uuid.UUID, name string) (bool, error) {
+	matches := s.Screen(name)
+	if len(matches) == 0 {
+		return false, nil
+	}
+
+	hits := make([]Hit, len(matches))
+	for i, match := range matches {
+		hits[i] = Hit{Match: match, UserID: userId, Context: "registration", ScreenedName: name}
+	}
+	if err := RecordHits(ctx, tx, hits); err != nil {
+		return false, err
+	}
+	if err := setUserStatus(ctx, tx, userId, "active", "frozen", ReasonPending, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ScreenUser screens an existing user, typically someone about to be paid.
+// Entries compliance already cleared the user of don't match again.
+func (s *Screener) ScreenUser(ctx context.Context, db DB, userId uuid.UUID) (name string, matches []Match, err error) {
+	if !s.Enabled() {
+		return "", nil, nil
+	}
+
+	var cleared []string
+	err = db.QueryRow(ctx, `
+		SELECT u.name, ARRAY(SELECT entry_uid FROM screening_hits h WHERE h.user_id = u.id AND h.status = 'cleared')
+		FROM users u
+		WHERE u.id = $1
+	`, userId).Scan(&name, &cleared)
+
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load user for screening: %w", err)
+	}
+
+	for _, match := range s.Screen(name) {
+		if !slices.Contains(cleared, match.EntryUID) {
+			matches = append(matches, match)
+		}
+	}
+	return name, matches, nil
+}
+
+// setUserStatus changes a user's status for screening and logs the change.
+// Frozen users are blocked from receiving too.
+func setUserStatus(ctx context.Context, db DB, userId uuid.UUID, oldStatus, newStatus, reason string, actorId *uuid.UUID) error {
+	blockIncoming := newStatus == "frozen"
+
+	_, err := db.Exec(ctx, `
+		UPDATE users SET status = $2, status_reason = NULLIF($3, ''), block_incoming = $4 WHERE id = $1
+	`, userId, newStatus, reason, blockIncoming)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO account_status_log (subject_type, subject_id, old_status, new_status, reason, block_incoming, actor_id)
+		VALUES ('user', $1, $2, $3, $4, $5, $6)
+	`, userId, oldStatus, newStatus, reason, blockIncoming, actorId)
+	if err != nil {
+		return fmt.Errorf("failed to log status change: %w", err)
+	}
+	return nil
+}
+
+type ScreeningStore struct {
+	db *pgxpool.Pool
+}
+
+func NewScreeningStore(db *pgxpool.Pool) *ScreeningStore {
+	return &ScreeningStore{db: db}
+}
+
+const hitColumns = `id, user_id, context, initiator_id, screened_name, entry_uid, listed_name, programs,
+	score, status, reviewed_by, review_note, reviewed_at, created_at`
+
+func scanHit(row pgx.Row) (hit models.ScreeningHit, err error) {
+	err = row.Scan(
+		&hit.ID,
+		&hit.UserID,
+		&hit.Context,
+		&hit.InitiatorID,
+		&hit.ScreenedName,
+		&hit.EntryUID,
+		&hit.ListedName,
+		&hit.Programs,
+		&hit.Score,
+		&hit.Status,
+		&hit.ReviewedBy,
+		&hit.ReviewNote,
+		&hit.ReviewedAt,
+		&hit.CreatedAt,
+	)
+	return hit, err
+}
+
+// ListHits returns hits in status, oldest first, so the review queue is
+// worked in order.
+func (s *ScreeningStore) ListHits(ctx context.Context, status string, limit int) ([]models.ScreeningHit, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+hitColumns+`
+		FROM screening_hits
+		WHERE status = $1
+		ORDER BY created_at, id
+		LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list screening hits: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []models.ScreeningHit{}
+	for rows.Next() {
+		hit, err := scanHit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan screening hit: %w", err)
+		}
+		hits = append(hits, hit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating screening hits: %w", err)
+	}
+	return hits, nil
+}
+
+// ResolveHit records compliance's verdict on a pending hit. Confirming it
+// freezes the user for the sanctions match. Clearing it lets the user be
+// screened clean of that entry from now on, and unfreezes a user frozen at
+// registration once no other hit against them is pending or confirmed.
+// Reviewers can't resolve hits against themselves.
+func (s *ScreeningStore) ResolveHit(ctx context.Context, hitId int64, reviewerId uuid.UUID, confirm bool, note string) (models.ScreeningHit, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userId    uuid.UUID
+		hitStatus string
+	)
+	err = tx.QueryRow(ctx, `SELECT user_id, status FROM screening_hits WHERE id = $1 FOR UPDATE`, hitId).Scan(&userId, &hitStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ScreeningHit{}, ErrHitNotFound
+	}
+	if err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to lock screening hit: %w", err)
+	}
+	if hitStatus != "pending" {
+		return models.ScreeningHit{}, ErrHitResolved
+	}
+	if userId == reviewerId {
+		return models.ScreeningHit{}, ErrSelfReview
+	}
+
+	var userStatus, reason string
+	err = tx.QueryRow(ctx, `
+		SELECT status, COALESCE(status_reason, '') FROM users WHERE id = $1 FOR UPDATE
+	`, userId).Scan(&userStatus, &reason)
+	if err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to lock screened user: %w", err)
+	}
+
+	verdict := "cleared"
+	if confirm {
+		verdict = "confirmed"
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE screening_hits
+		SET status = $2, reviewed_by = $3, review_note = NULLIF($4, ''), reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, hitId, verdict, reviewerId, note)
+	if err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to resolve screening hit: %w", err)
+	}
+
+	switch {
+	case confirm && userStatus != "closed" && reason != ReasonConfirmed:
+		err = setUserStatus(ctx, tx, userId, userStatus, "frozen", ReasonConfirmed, &reviewerId)
+	case !confirm && userStatus == "frozen" && reason == ReasonPending:
+		var open bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM screening_hits WHERE user_id = $1 AND status IN ('pending', 'confirmed'))
+		`, userId).Scan(&open)
+		if err != nil {
+			return models.ScreeningHit{}, fmt.Errorf("failed to check open screening hits: %w", err)
+		}
+		if !open {
+			err = setUserStatus(ctx, tx, userId, userStatus, "active", "", &reviewerId)
+		}
+	}
+	if err != nil {
+		return models.ScreeningHit{}, err
+	}
+
+	hit, err := scanHit(tx.QueryRow(ctx, `SELECT `+hitColumns+` FROM screening_hits WHERE id = $1`, hitId))
+	if err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to read screening hit: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return models.ScreeningHit{}, fmt.Errorf("failed to commit screening review: %w", err)
+	}
+	return hit, nil
+}
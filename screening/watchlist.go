@@ -0,0 +1,150 @@
+package screening
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Entry is a listed party with every name it is known by.
+type Entry struct {
+	UID      string
+	Names    []string // the primary name first, then aliases
+	Type     string   // 'individual', 'entity', 'vessel', ...
+	Programs string   // sanctions programs, e.g. "SDGT; IRGC"
+}
+
+// LoadWatchlist reads a watchlist in the layout of OFAC's SDN list, as CSV
+// (sdn.csv) or XML (sdn.xml), depending on the file extension.
+func LoadWatchlist(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening watchlist: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		entries, err = parseCSV(file)
+	case ".xml":
+		entries, err = parseXML(file)
+	default:
+		return nil, fmt.Errorf("watchlist %s: expected a .csv or .xml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing watchlist %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// akaPattern finds the aliases OFAC lists in the remarks column of sdn.csv,
+// e.g. "a.k.a. 'ACME TRADING'; a.k.a. 'ACME LTD'".
+var akaPattern = regexp.MustCompile(`a\.k\.a\. '([^']+)'`)
+
+// parseCSV reads rows of ent_num, SDN_Name, SDN_Type, Program, Title,
+// Call_Sign, Vess_type, Tonnage, GRT, Vess_flag, Vess_owner, Remarks. Only the
+// first two columns are required and a header row is skipped. OFAC writes
+// "-0-" for empty fields.
+func parseCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	field := func(record []string, i int) string {
+		if i >= len(record) {
+			return ""
+		}
+		value := strings.TrimSpace(record[i])
+		if value == "-0-" {
+			return ""
+		}
+		return value
+	}
+
+	var entries []Entry
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first := strings.TrimSpace(record[0]); len(record) == 1 && (first == "" || first == "\x1a") {
+			continue // blank line or the DOS end-of-file marker OFAC appends
+		}
+		if line == 1 && strings.EqualFold(field(record, 0), "ent_num") {
+			continue
+		}
+
+		entry := Entry{UID: field(record, 0), Type: strings.ToLower(field(record, 2)), Programs: field(record, 3)}
+		name := field(record, 1)
+		if entry.UID == "" || name == "" {
+			return nil, fmt.Errorf("line %d: ent_num and name are required", line)
+		}
+		entry.Names = append(entry.Names, name)
+		for _, aka := range akaPattern.FindAllStringSubmatch(field(record, 11), -1) {
+			entry.Names = append(entry.Names, aka[1])
+		}
+		entries = append(entries, entry)
+	}
+}
+
+type sdnList struct {
+	Entries []sdnEntry `xml:"sdnEntry"`
+}
+
+type sdnName struct {
+	FirstName string `xml:"firstName"`
+	LastName  string `xml:"lastName"`
+}
+
+// full writes the name the way sdn.csv does: "LAST, First".
+func (n sdnName) full() string {
+	if n.FirstName == "" {
+		return n.LastName
+	}
+	return n.LastName + ", " + n.FirstName
+}
+
+type sdnEntry struct {
+	UID  string `xml:"uid"`
+	Type string `xml:"sdnType"`
+	sdnName
+	Programs []string  `xml:"programList>program"`
+	Akas     []sdnName `xml:"akaList>aka"`
+}
+
+func parseXML(r io.Reader) ([]Entry, error) {
+	var list sdnList
+	if err := xml.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(list.Entries))
+	for i, sdn := range list.Entries {
+		name := strings.TrimSpace(sdn.full())
+		if sdn.UID == "" || name == "" {
+			return nil, fmt.Errorf("entry %d: uid and lastName are required", i)
+		}
+		entry := Entry{
+			UID:      sdn.UID,
+			Names:    []string{name},
+			Type:     strings.ToLower(sdn.Type),
+			Programs: strings.Join(sdn.Programs, "; "),
+		}
+		for _, aka := range sdn.Akas {
+			if alias := strings.TrimSpace(aka.full()); alias != "" {
+				entry.Names = append(entry.Names, alias)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
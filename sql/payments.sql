@@ -3,6 +3,11 @@ CREATE TABLE users (
   name TEXT NOT NULL,
   email TEXT UNIQUE NOT NULL,
   password_hash TEXT NOT NULL,
+  email_verified_at TIMESTAMP,
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'frozen', 'closed')),
+  status_reason TEXT,
+  block_incoming BOOLEAN NOT NULL DEFAULT FALSE, -- a frozen user refuses incoming funds too
+  kyc_tier TEXT NOT NULL DEFAULT 'basic', -- selects the transaction limits that apply
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -10,12 +15,16 @@ CREATE TABLE users (
 CREATE TABLE wallets (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
   user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
-  balance BIGINT NOT NULL DEFAULT 0, -- stored in cents
-  currency TEXT NOT NULL DEFAULT 'USD',
+  balance BIGINT NOT NULL DEFAULT 0, -- stored in minor units of currency
+  currency TEXT NOT NULL DEFAULT 'USD', -- ISO 4217 code
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'frozen', 'closed')),
+  status_reason TEXT,
+  block_incoming BOOLEAN NOT NULL DEFAULT FALSE, -- a frozen wallet refuses incoming funds too
   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE UNIQUE INDEX idx_wallets_user_id ON wallets (user_id);
+-- A user holds at most one wallet per currency.
+CREATE UNIQUE INDEX idx_wallets_user_id_currency ON wallets (user_id, currency);
 
 -- Create accountants see
 CREATE TABLE transactions (
@@ -23,6 +32,7 @@ CREATE TABLE transactions (
   from_wallet_id UUID REFERENCES wallets (id),
   to_wallet_id UUID REFERENCES wallets (id),
   amount BIGINT NOT NULL,
+  currency TEXT NOT NULL DEFAULT 'USD',
   status TEXT NOT NULL CHECK (
     status IN ('pending', 'completed', 'failed', 'refunded')
   ),
@@ -32,10 +42,13 @@ CREATE TABLE transactions (
       'refund',
       'adjustment',
       'deposit',
-      'withdrawal'
+      'withdrawal',
+      'fx_sell',
+      'fx_buy',
+      'fee'
     )
   ),
-  reference_id UUID, -- optional: could link to payments or refunds
+  reference_id UUID, -- optional: could link to payments or refunds; fees link to what they were charged on
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   CONSTRAINT transactions_deposit_check CHECK (
     (
@@ -44,10 +57,15 @@ CREATE TABLE transactions (
       AND to_wallet_id IS NOT NULL
     )
     OR (
-      type = 'withdrawal'
+      type IN ('withdrawal', 'fx_sell', 'fee')
       AND from_wallet_id IS NOT NULL
       AND to_wallet_id IS NULL
     )
+    OR (
+      type = 'fx_buy'
+      AND from_wallet_id IS NULL
+      AND to_wallet_id IS NOT NULL
+    )
     OR (
       type IN ('payment', 'refund', 'adjustment')
       AND from_wallet_id IS NOT NULL
@@ -60,14 +78,521 @@ CREATE INDEX idx_transactions_from_wallet_id ON transactions (from_wallet_id);
 
 CREATE INDEX idx_transactions_to_wallet_id ON transactions (to_wallet_id);
 
+CREATE INDEX idx_transactions_reference_id ON transactions (reference_id);
+
+CREATE INDEX idx_transactions_created_at ON transactions (created_at);
+
+-- Payout details of withdrawal transactions (to_wallet_id is NULL for them)
+CREATE TABLE withdrawals (
+  transaction_id UUID PRIMARY KEY REFERENCES transactions (id),
+  user_id UUID NOT NULL REFERENCES users (id),
+  destination TEXT NOT NULL,
+  payout_reference TEXT, -- saved as soon as the processor returns it, before settlement
+  failure_reason TEXT,
+  payout_attempts INT NOT NULL DEFAULT 1,
+  payout_attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- when the processor was last called
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Finds withdrawals whose payout was interrupted before they were settled.
+CREATE INDEX idx_transactions_pending_withdrawals ON transactions (created_at)
+WHERE
+  type = 'withdrawal'
+  AND status = 'pending';
+
 -- What the users see
 CREATE TABLE payments (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
   sender_id UUID NOT NULL REFERENCES users (id),
   receiver_id UUID NOT NULL REFERENCES users (id),
   amount BIGINT NOT NULL,
-  status TEXT NOT NULL CHECK (status IN ('initiated', 'completed', 'failed')),
-  transaction_id UUID REFERENCES transactions (id),
+  currency TEXT NOT NULL DEFAULT 'USD',
+  status TEXT NOT NULL CHECK (
+    status IN (
+      'initiated',
+      'completed',
+      'failed',
+      'partially_refunded',
+      'refunded',
+      'held', -- by the fraud rules, funds reserved in system:holds until reviewed
+      'in_review', -- held and claimed by a reviewer
+      'blocked' -- by the fraud rules, no funds moved
+    )
+  ),
+  transaction_id UUID REFERENCES transactions (id), -- NULL when blocked
   note TEXT,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE INDEX idx_payments_sender_id_created_at ON payments (sender_id, created_at DESC, id DESC);
+
+CREATE INDEX idx_payments_receiver_id_created_at ON payments (receiver_id, created_at DESC, id DESC);
+
+CREATE INDEX idx_payments_created_at ON payments (created_at DESC, id DESC);
+
+-- Replay protection for money-moving endpoints (Idempotency-Key header)
+CREATE TABLE idempotency_keys (
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  resource_id UUID, -- payment or transaction created under this key
+  status_code INT,
+  response_content_type TEXT,
+  response_body BYTEA,
+  locked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  completed_at TIMESTAMP,
+  PRIMARY KEY (user_id, key)
+);
+
+-- Double-entry ledger: wallets.balance is a cached projection of the postings
+-- on the wallet's account. Positive postings credit an account, negative ones
+-- debit it, and every journal entry sums to zero.
+-- Every account holds a single currency; system accounts exist once per
+-- currency and are opened on their first posting.
+CREATE TABLE ledger_accounts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  wallet_id UUID UNIQUE REFERENCES wallets (id) ON DELETE RESTRICT,
+  code TEXT, -- system accounts, e.g. 'system:deposits'
+  currency TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT ledger_accounts_owner_check CHECK ((wallet_id IS NULL) <> (code IS NULL)),
+  UNIQUE (code, currency),
+  UNIQUE (id, currency)
+);
+
+CREATE TABLE journal_entries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  transaction_id UUID REFERENCES transactions (id),
+  description TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_journal_entries_transaction_id ON journal_entries (transaction_id);
+
+CREATE TABLE postings (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  journal_entry_id UUID NOT NULL REFERENCES journal_entries (id),
+  account_id UUID NOT NULL REFERENCES ledger_accounts (id),
+  currency TEXT NOT NULL, -- copied from the account
+  amount BIGINT NOT NULL CHECK (amount <> 0), -- in minor units of currency
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (account_id, currency) REFERENCES ledger_accounts (id, currency)
+);
+
+CREATE INDEX idx_postings_journal_entry_id ON postings (journal_entry_id);
+
+CREATE INDEX idx_postings_account_id ON postings (account_id);
+
+-- Checked at commit so an entry's postings can be inserted one at a time.
+-- Since every entry balances in each currency, so does the whole ledger.
+CREATE FUNCTION check_journal_entry_balanced () RETURNS TRIGGER AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM postings
+    WHERE journal_entry_id = NEW.journal_entry_id
+    GROUP BY currency
+    HAVING SUM(amount) <> 0
+  ) THEN
+    RAISE EXCEPTION 'journal entry % is not balanced', NEW.journal_entry_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+AFTER INSERT ON postings DEFERRABLE INITIALLY DEFERRED FOR EACH ROW
+EXECUTE FUNCTION check_journal_entry_balanced ();
+
+-- Postings are append-only; corrections are new, reversing entries.
+CREATE FUNCTION reject_posting_changes () RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'postings are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER postings_append_only BEFORE
+UPDATE
+OR DELETE ON postings FOR EACH ROW
+EXECUTE FUNCTION reject_posting_changes ();
+
+-- Role-based access control. Every user can act on their own wallet and
+-- history; roles grant the extra permissions carried in access tokens.
+CREATE TABLE roles (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+CREATE TABLE permissions (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions (
+  role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  permission TEXT NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  granted_by UUID REFERENCES users (id),
+  granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE role_audit_log (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  actor_id UUID REFERENCES users (id), -- NULL when changed from the CLI
+  target_user_id UUID NOT NULL REFERENCES users (id),
+  role TEXT NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('grant', 'revoke')),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_role_audit_log_target_user_id ON role_audit_log (target_user_id, created_at DESC);
+
+INSERT INTO
+  roles (name, description)
+VALUES
+  ('admin', 'Full administrative access'),
+  ('support', 'Reads users and payments to help customers'),
+  ('auditor', 'Read-only access to financial records and role changes'),
+  ('compliance', 'Reviews held payments, sanctions screening hits and AML cases');
+
+INSERT INTO
+  permissions (name, description)
+VALUES
+  ('payments:read_all', 'List and read every payment'),
+  ('users:read_all', 'List and read every user'),
+  ('reconcile:run', 'Run balance reconciliation'),
+  ('roles:read', 'Read roles and the role audit log'),
+  ('roles:manage', 'Grant and revoke roles'),
+  ('users:manage', 'Unlock and freeze user accounts'),
+  ('payments:review', 'Work the review queue of held payments'),
+  ('compliance:review', 'Clear or confirm sanctions screening hits'),
+  ('aml:cases', 'Work anti-money-laundering cases and run the AML scan');
+
+INSERT INTO
+  role_permissions (role, permission)
+VALUES
+  ('admin', 'payments:read_all'),
+  ('admin', 'users:read_all'),
+  ('admin', 'reconcile:run'),
+  ('admin', 'roles:read'),
+  ('admin', 'roles:manage'),
+  ('admin', 'users:manage'),
+  ('admin', 'payments:review'),
+  ('admin', 'compliance:review'),
+  ('admin', 'aml:cases'),
+  ('support', 'payments:read_all'),
+  ('support', 'users:read_all'),
+  ('support', 'users:manage'),
+  ('support', 'payments:review'),
+  ('auditor', 'payments:read_all'),
+  ('auditor', 'users:read_all'),
+  ('auditor', 'reconcile:run'),
+  ('auditor', 'roles:read'),
+  ('compliance', 'payments:read_all'),
+  ('compliance', 'users:read_all'),
+  ('compliance', 'payments:review'),
+  ('compliance', 'compliance:review'),
+  ('compliance', 'aml:cases');
+
+-- Opaque refresh tokens, stored hashed. Tokens rotated from the same login
+-- share a family_id so a replayed token revokes the whole session.
+CREATE TABLE refresh_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  family_id UUID NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  access_jti TEXT NOT NULL, -- access token issued together with this refresh token
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP, -- set once rotated
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Access tokens revoked before expiring, keyed by their jti. Rows can be
+-- purged once expires_at has passed.
+CREATE TABLE revoked_tokens (
+  jti TEXT PRIMARY KEY,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- TOTP second factor (RFC 6238). The secret only takes effect once
+-- confirmed_at is set; last_used_step stops a code being used twice.
+CREATE TABLE user_totp (
+  user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  confirmed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE totp_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, code_hash)
+);
+
+-- Pending second step of a login for users with TOTP enabled.
+CREATE TABLE login_challenges (
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP NOT NULL,
+  consumed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single-use tokens mailed to users, stored hashed.
+CREATE TABLE user_tokens (
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'password_reset')),
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id, purpose);
+
+-- Failed login counters per email and per client IP, see auth/throttle.go.
+CREATE TABLE login_attempts (
+  kind TEXT NOT NULL CHECK (kind IN ('email', 'ip', 'step_up')),
+  key TEXT NOT NULL,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  locked_until TIMESTAMP,
+  PRIMARY KEY (kind, key)
+);
+
+-- Limits set for a single user. A user's limits for a transaction type
+-- replace their KYC tier's rules for it; amounts are in minor units of currency
+-- and a zero leaves that limit off.
+CREATE TABLE user_limits (
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  type TEXT NOT NULL CHECK (type IN ('payment', 'deposit', 'withdrawal')),
+  currency TEXT NOT NULL,
+  per_transaction BIGINT NOT NULL DEFAULT 0 CHECK (per_transaction >= 0),
+  daily_volume BIGINT NOT NULL DEFAULT 0 CHECK (daily_volume >= 0),
+  monthly_volume BIGINT NOT NULL DEFAULT 0 CHECK (monthly_volume >= 0),
+  daily_count BIGINT NOT NULL DEFAULT 0 CHECK (daily_count >= 0),
+  monthly_count BIGINT NOT NULL DEFAULT 0 CHECK (monthly_count >= 0),
+  actor_id UUID REFERENCES users (id),
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, type, currency)
+);
+
+-- Every freeze, unfreeze and closure of a user or wallet.
+CREATE TABLE account_status_log (
+  id BIGSERIAL PRIMARY KEY,
+  subject_type TEXT NOT NULL CHECK (subject_type IN ('user', 'wallet')),
+  subject_id UUID NOT NULL,
+  old_status TEXT NOT NULL,
+  new_status TEXT NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  block_incoming BOOLEAN NOT NULL DEFAULT FALSE,
+  actor_id UUID REFERENCES users (id) ON DELETE SET NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_account_status_log_subject ON account_status_log (subject_id, created_at);
+
+-- Money movements refused because an account was frozen or closed. Written
+-- after the refused transaction is rolled back.
+CREATE TABLE blocked_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL,
+  wallet_id UUID NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('send', 'receive', 'deposit', 'withdrawal', 'refund', 'fx')),
+  amount BIGINT NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_blocked_attempts_user_id ON blocked_attempts (user_id, created_at);
+
+-- A locked FX rate for one user. Executing the quote sets used_at and links
+-- the two legs of the conversion; both legs reference the quote too.
+CREATE TABLE fx_quotes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  from_currency TEXT NOT NULL,
+  to_currency TEXT NOT NULL,
+  sell_amount BIGINT NOT NULL CHECK (sell_amount > 0), -- in minor units of from_currency
+  buy_amount BIGINT NOT NULL CHECK (buy_amount > 0), -- in minor units of to_currency
+  mid_rate NUMERIC(30, 10) NOT NULL,
+  spread_bps BIGINT NOT NULL,
+  rate NUMERIC(30, 10) NOT NULL, -- mid_rate less the spread
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  sell_transaction_id UUID REFERENCES transactions (id),
+  buy_transaction_id UUID REFERENCES transactions (id),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CHECK (from_currency <> to_currency)
+);
+
+CREATE INDEX idx_fx_quotes_user_id ON fx_quotes (user_id, created_at);
+
+-- The fraud rules' verdict on each payment and the rules it triggered.
+CREATE TABLE fraud_decisions (
+  payment_id UUID PRIMARY KEY REFERENCES payments (id) ON DELETE CASCADE,
+  action TEXT NOT NULL CHECK (action IN ('allow', 'hold', 'block')),
+  score INT NOT NULL,
+  triggered JSONB NOT NULL DEFAULT '[]',
+  review TEXT CHECK (review IN ('approved', 'rejected', 'expired')), -- outcome of a hold, which turns action into allow or block
+  reviewed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_fraud_decisions_action ON fraud_decisions (action, created_at);
+
+-- Review of a held payment. The payment row carries the state ('held',
+-- 'in_review', then 'completed' or 'failed'); this row records who claimed and
+-- decided it and why. Open reviews past due_at are expired, returning the funds.
+CREATE TABLE payment_reviews (
+  payment_id UUID PRIMARY KEY REFERENCES payments (id) ON DELETE CASCADE,
+  due_at TIMESTAMP NOT NULL,
+  claimed_by UUID REFERENCES users (id),
+  claimed_at TIMESTAMP,
+  decision TEXT CHECK (decision IN ('approved', 'rejected', 'expired')),
+  reason TEXT,
+  decided_by UUID REFERENCES users (id), -- NULL when expired
+  decided_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_reviews_due_at ON payment_reviews (decision, due_at);
+
+-- Users whose name matched the sanctions watchlist, at registration or when
+-- someone tried to pay them. A pending hit blocks the user until compliance
+-- clears it as a false positive or confirms it.
+CREATE TABLE screening_hits (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  context TEXT NOT NULL CHECK (context IN ('registration', 'payment')),
+  initiator_id UUID REFERENCES users (id) ON DELETE SET NULL, -- the payer, for payments
+  screened_name TEXT NOT NULL,
+  entry_uid TEXT NOT NULL, -- watchlist entry, e.g. the SDN ent_num
+  listed_name TEXT NOT NULL, -- the entry's name or alias that matched
+  programs TEXT NOT NULL DEFAULT '',
+  score DOUBLE PRECISION NOT NULL, -- name similarity from 0 to 1
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'cleared', 'confirmed')),
+  reviewed_by UUID REFERENCES users (id),
+  review_note TEXT,
+  reviewed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_screening_hits_pending ON screening_hits (user_id, entry_uid)
+WHERE
+  status = 'pending';
+
+CREATE INDEX idx_screening_hits_status ON screening_hits (status, created_at);
+
+-- Suspicious activity the AML scan found on a wallet. One case per pattern
+-- and wallet is worked at a time: later findings are linked to it until it
+-- is closed.
+CREATE TABLE aml_cases (
+  id BIGSERIAL PRIMARY KEY,
+  pattern TEXT NOT NULL CHECK (
+    pattern IN ('structuring', 'fan_in', 'fan_out', 'circular')
+  ),
+  wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE, -- the wallet's owner
+  currency TEXT NOT NULL,
+  summary TEXT NOT NULL, -- what the latest finding saw
+  total_amount BIGINT NOT NULL DEFAULT 0, -- of the linked transactions
+  transaction_count INT NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'escalated', 'closed')),
+  resolution TEXT CHECK (resolution IN ('reported', 'no_action')),
+  escalated_by UUID REFERENCES users (id),
+  escalated_at TIMESTAMP,
+  closed_by UUID REFERENCES users (id),
+  closed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CHECK ((status = 'closed') = (resolution IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX idx_aml_cases_active ON aml_cases (pattern, wallet_id)
+WHERE
+  status IN ('open', 'escalated');
+
+CREATE INDEX idx_aml_cases_status ON aml_cases (status, created_at);
+
+CREATE TABLE aml_case_transactions (
+  case_id BIGINT NOT NULL REFERENCES aml_cases (id) ON DELETE CASCADE,
+  transaction_id UUID NOT NULL REFERENCES transactions (id),
+  PRIMARY KEY (case_id, transaction_id)
+);
+
+CREATE INDEX idx_aml_case_transactions_transaction_id ON aml_case_transactions (transaction_id);
+
+-- History of a case: the scan opening and updating it, and compliance's
+-- notes, escalation and closure.
+CREATE TABLE aml_case_events (
+  id BIGSERIAL PRIMARY KEY,
+  case_id BIGINT NOT NULL REFERENCES aml_cases (id) ON DELETE CASCADE,
+  actor_id UUID REFERENCES users (id), -- NULL for the scan
+  action TEXT NOT NULL CHECK (
+    action IN ('opened', 'updated', 'note', 'escalated', 'closed')
+  ),
+  note TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_aml_case_events_case_id ON aml_case_events (case_id, created_at);
+
+-- Payments to make later, once or on a recurrence. next_run_at is when the
+-- next occurrence falls due; occurrences counts those paid or given up on.
+-- A worker leases a due row with claim_token and claimed_until, and pays the
+-- occurrence under the idempotency key schedule:<id>:<occurrences>, so it is
+-- paid at most once even if the lease runs out mid-payment.
+CREATE TABLE scheduled_payments (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+  sender_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  receiver_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  currency TEXT NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  frequency TEXT NOT NULL CHECK (
+    frequency IN ('once', 'daily', 'weekly', 'monthly')
+  ),
+  interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+  start_at TIMESTAMP NOT NULL,
+  end_at TIMESTAMP,
+  max_runs INT CHECK (max_runs > 0),
+  status TEXT NOT NULL DEFAULT 'active' CHECK (
+    status IN ('active', 'paused', 'completed', 'cancelled', 'failed')
+  ),
+  next_run_at TIMESTAMP, -- NULL once the schedule ended
+  occurrences INT NOT NULL DEFAULT 0,
+  attempts INT NOT NULL DEFAULT 0, -- failed attempts at the next occurrence
+  retry_at TIMESTAMP, -- set after a failed attempt, overrides next_run_at
+  claim_token UUID,
+  claimed_until TIMESTAMP,
+  last_payment_id UUID REFERENCES payments (id) ON DELETE SET NULL,
+  last_error TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CHECK (sender_id <> receiver_id)
+);
+
+CREATE INDEX idx_scheduled_payments_due ON scheduled_payments (COALESCE(retry_at, next_run_at))
+WHERE
+  status = 'active';
+
+CREATE INDEX idx_scheduled_payments_sender_id ON scheduled_payments (sender_id, created_at);
@@ -3,6 +3,17 @@ package users
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrNoUsersFound = errors.New("no users found")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrNoUsersFound   = errors.New("no users found")
+	ErrWalletNotFound = errors.New("wallet not found")
+	ErrWalletExists   = errors.New("a wallet in this currency already exists")
+	ErrReasonRequired = errors.New("a reason is required")
+	ErrInvalidStatus  = errors.New("status must be active, frozen or closed")
+	ErrAccountClosed  = errors.New("account is closed")
+	ErrAccountFrozen  = errors.New("account is frozen")
+	ErrBalanceNotZero = errors.New("only accounts with a zero balance can be closed")
+	ErrUnknownKYCTier = errors.New("unknown kyc tier")
+	ErrInvalidLimit   = errors.New("type must be payment, deposit or withdrawal and limits must not be negative")
+	ErrLimitNotFound  = errors.New("user has no limit for this type and currency")
+	ErrScreeningHold  = errors.New("account is frozen by sanctions screening, compliance must resolve the screening hit")
 )
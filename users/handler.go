@@ -1,11 +1,16 @@
 package users
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"paygo/auth"
+	"paygo/currency"
+	"paygo/md"
 	"paygo/models"
+	"strconv"
 
 	"github.com/google/uuid"
 )
@@ -40,16 +45,28 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetUserById returns the authenticated user's profile. Callers holding
+// users:read_all may read any profile by passing ?id=.
 func (h *UserHandler) GetUserById(w http.ResponseWriter, r *http.Request) {
-	var userId uuid.UUID
-	userIdStr := r.URL.Query().Get("id") // Assuming the URL is /users?id=<uuid>
-	userId, err := uuid.Parse(userIdStr)
-
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
 		return
 	}
 
+	if userIdStr := r.URL.Query().Get("id"); userIdStr != "" {
+		requested, err := uuid.Parse(userIdStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if requested != userId && !md.HasPermission(r.Context(), auth.PermUsersReadAll) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userId = requested
+	}
+
 	user, err := h.userService.GetUserById(r.Context(), userId)
 	if err != nil {
 		switch {
@@ -97,3 +114,336 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// GetWallets lists the authenticated user's wallets.
+func (h *UserHandler) GetWallets(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	wallets, err := h.userService.GetWallets(r.Context(), userId)
+	if err != nil {
+		log.Printf("handler: error fetching wallets: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wallets)
+}
+
+// CreateWallet opens a wallet for the authenticated user in the currency
+// given in the body.
+func (h *UserHandler) CreateWallet(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Currency == "" {
+		http.Error(w, "currency is required", http.StatusBadRequest)
+		return
+	}
+
+	wallet, err := h.userService.CreateWallet(r.Context(), userId, body.Currency)
+	if err != nil {
+		switch {
+		case errors.Is(err, currency.ErrUnsupported):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrWalletExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrAccountClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrUserNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("handler: error creating wallet: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wallet)
+}
+
+// GetCurrencies lists the currencies wallets can be opened in, with the
+// number of decimals amounts in each are scaled by.
+func (h *UserHandler) GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currency.All())
+}
+
+// GetLimitOverrides lists the limits set for the user alone.
+func (h *UserHandler) GetLimitOverrides(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	overrides, err := h.userService.GetLimitOverrides(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("handler: error fetching user limits: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overrides)
+}
+
+// SetLimitOverride sets a limit for the user alone, replacing their tier's
+// rules for the transaction type.
+func (h *UserHandler) SetLimitOverride(w http.ResponseWriter, r *http.Request) {
+	actorId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var override models.LimitOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, "failed parsing request body", http.StatusBadRequest)
+		return
+	}
+	override.ActorID = &actorId
+
+	saved, err := h.userService.SetLimitOverride(r.Context(), userId, override)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidLimit), errors.Is(err, currency.ErrUnsupported):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			log.Printf("handler: error setting user limit: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("users: %s limit in %s of user %s set by %s", saved.Type, saved.Currency, userId, actorId)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DeleteLimitOverride removes a limit set for the user alone; once they have
+// none left for the type their tier's rules apply again.
+func (h *UserHandler) DeleteLimitOverride(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.DeleteLimitOverride(r.Context(), userId, r.PathValue("type"), r.PathValue("currency"))
+	if err != nil {
+		switch {
+		case errors.Is(err, currency.ErrUnsupported):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrLimitNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("handler: error deleting user limit: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetKYCTier changes which transaction limits apply to the user.
+func (h *UserHandler) SetKYCTier(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Tier string `json:"tier"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "failed parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.SetKYCTier(r.Context(), userId, body.Tier)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownKYCTier):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			log.Printf("handler: error setting kyc tier: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FreezeUser blocks the user from moving funds out of any of their wallets.
+// With block_incoming set they can't receive funds either.
+func (h *UserHandler) FreezeUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "frozen", h.userService.SetUserStatus)
+}
+
+func (h *UserHandler) UnfreezeUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "active", h.userService.SetUserStatus)
+}
+
+// CloseUser permanently closes an account whose wallets are all empty.
+func (h *UserHandler) CloseUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "closed", h.userService.SetUserStatus)
+}
+
+func (h *UserHandler) FreezeWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "frozen", h.userService.SetWalletStatus)
+}
+
+func (h *UserHandler) UnfreezeWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "active", h.userService.SetWalletStatus)
+}
+
+func (h *UserHandler) CloseWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, "closed", h.userService.SetWalletStatus)
+}
+
+// changeStatus applies status to the user or wallet identified by the {id}
+// path value. The body carries the reason and, for freezes, block_incoming.
+func (h *UserHandler) changeStatus(
+	w http.ResponseWriter,
+	r *http.Request,
+	status string,
+	apply func(ctx context.Context, id uuid.UUID, change models.StatusChange) error,
+) {
+	actorId, ok := r.Context().Value("user_id").(uuid.UUID)
+	if !ok {
+		http.Error(w, "Unauthorized: user not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var change models.StatusChange
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+	change.Status = status
+	change.ActorID = &actorId
+	change.Compliance = md.HasPermission(r.Context(), auth.PermComplianceReview)
+
+	if err := apply(r.Context(), id, change); err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrWalletNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrReasonRequired), errors.Is(err, ErrInvalidStatus):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrAccountClosed), errors.Is(err, ErrBalanceNotZero):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrScreeningHold):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("handler: error changing account status: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStatusLog lists the status changes of a user and their wallets.
+func (h *UserHandler) GetStatusLog(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.userService.GetStatusLog(r.Context(), userId, limit)
+	if err != nil {
+		log.Printf("handler: error fetching status log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetBlockedAttempts lists money movements refused because of a frozen or
+// closed account. ?user_id= narrows it to one user.
+func (h *UserHandler) GetBlockedAttempts(w http.ResponseWriter, r *http.Request) {
+	var userId *uuid.UUID
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userId = &parsed
+	}
+
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	attempts, err := h.userService.GetBlockedAttempts(r.Context(), userId, limit)
+	if err != nil {
+		log.Printf("handler: error fetching blocked attempts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempts)
+}
+
+// parseLimit reads ?limit= (default 100, at most 1000).
+func parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return 0, false
+		}
+		limit = parsed
+	}
+	return limit, true
+}
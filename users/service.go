@@ -4,19 +4,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"paygo/currency"
 	"paygo/models"
 	"paygo/utils"
+	"slices"
 
 	"github.com/google/uuid"
 )
 
+// EmailVerifier sends a new user the link to verify their email address.
+type EmailVerifier interface {
+	SendVerificationEmail(ctx context.Context, userId string) error
+}
+
 type UserService struct {
 	userStore *UserStore
+	verifier  EmailVerifier
+	kycTiers  []string // tiers the configured limits know about
 }
 
-func NewUserService(userStore *UserStore) *UserService {
+func NewUserService(userStore *UserStore, verifier EmailVerifier, kycTiers []string) *UserService {
 	return &UserService{
 		userStore,
+		verifier,
+		kycTiers,
 	}
 }
 
@@ -60,6 +72,101 @@ func (s *UserService) CreateUser(ctx context.Context, newUser models.CreateUser)
 		return user, err
 	}
 
+	if err := s.verifier.SendVerificationEmail(ctx, user.ID.String()); err != nil {
+		log.Printf("service: failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	return user, nil
 
 }
+
+func (s *UserService) GetWallets(ctx context.Context, userId uuid.UUID) ([]models.Wallet, error) {
+	return s.userStore.GetWallets(ctx, userId)
+}
+
+// CreateWallet opens a wallet in another currency. A user holds at most one
+// wallet per currency.
+func (s *UserService) CreateWallet(ctx context.Context, userId uuid.UUID, code string) (models.Wallet, error) {
+	c, err := currency.Lookup(code)
+	if err != nil {
+		return models.Wallet{}, err
+	}
+	return s.userStore.CreateWallet(ctx, userId, c.Code)
+}
+
+// SetKYCTier moves the user to another tier of transaction limits.
+func (s *UserService) SetKYCTier(ctx context.Context, userId uuid.UUID, tier string) error {
+	if !slices.Contains(s.kycTiers, tier) {
+		return fmt.Errorf("%w: %q", ErrUnknownKYCTier, tier)
+	}
+	return s.userStore.SetKYCTier(ctx, userId, tier)
+}
+
+func (s *UserService) GetLimitOverrides(ctx context.Context, userId uuid.UUID) ([]models.LimitOverride, error) {
+	return s.userStore.GetLimitOverrides(ctx, userId)
+}
+
+// SetLimitOverride sets one of the user's own limits, replacing their tier's
+// rules for the type.
+func (s *UserService) SetLimitOverride(ctx context.Context, userId uuid.UUID, override models.LimitOverride) (models.LimitOverride, error) {
+	if !slices.Contains([]string{"payment", "deposit", "withdrawal"}, override.Type) ||
+		override.PerTransaction < 0 || override.DailyVolume < 0 || override.MonthlyVolume < 0 ||
+		override.DailyCount < 0 || override.MonthlyCount < 0 {
+		return models.LimitOverride{}, ErrInvalidLimit
+	}
+	c, err := currency.Lookup(override.Currency)
+	if err != nil {
+		return models.LimitOverride{}, err
+	}
+	override.Currency = c.Code
+	return s.userStore.SetLimitOverride(ctx, userId, override)
+}
+
+func (s *UserService) DeleteLimitOverride(ctx context.Context, userId uuid.UUID, txType, code string) error {
+	c, err := currency.Lookup(code)
+	if err != nil {
+		return err
+	}
+	return s.userStore.DeleteLimitOverride(ctx, userId, txType, c.Code)
+}
+
+func (s *UserService) SetUserStatus(ctx context.Context, userId uuid.UUID, change models.StatusChange) error {
+	if err := validateStatusChange(&change); err != nil {
+		return err
+	}
+	return s.userStore.SetUserStatus(ctx, userId, change)
+}
+
+func (s *UserService) SetWalletStatus(ctx context.Context, walletId uuid.UUID, change models.StatusChange) error {
+	if err := validateStatusChange(&change); err != nil {
+		return err
+	}
+	return s.userStore.SetWalletStatus(ctx, walletId, change)
+}
+
+func (s *UserService) GetStatusLog(ctx context.Context, userId uuid.UUID, limit int) ([]models.StatusLogEntry, error) {
+	return s.userStore.GetStatusLog(ctx, userId, limit)
+}
+
+func (s *UserService) GetBlockedAttempts(ctx context.Context, userId *uuid.UUID, limit int) ([]models.BlockedAttempt, error) {
+	return s.userStore.GetBlockedAttempts(ctx, userId, limit)
+}
+
+// validateStatusChange requires a reason for freezing and closing. Only a
+// freeze can block incoming funds.
+func validateStatusChange(change *models.StatusChange) error {
+	switch change.Status {
+	case "active":
+		change.BlockIncoming = false
+	case "frozen", "closed":
+		if change.Reason == "" {
+			return ErrReasonRequired
+		}
+		if change.Status == "closed" {
+			change.BlockIncoming = false
+		}
+	default:
+		return ErrInvalidStatus
+	}
+	return nil
+}
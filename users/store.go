@@ -2,43 +2,48 @@ package users
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"paygo/models"
+	"paygo/screening"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserStore struct {
-	db *pgxpool.Pool
+	db       *pgxpool.Pool
+	screener *screening.Screener
 }
 
-func NewUserStore(db *pgxpool.Pool) *UserStore {
+func NewUserStore(db *pgxpool.Pool, screener *screening.Screener) *UserStore {
 	return &UserStore{
 		db,
+		screener,
 	}
 }
 
 func (s *UserStore) GetUserById(ctx context.Context, userId uuid.UUID) (user models.User, err error) {
-	wantCols := []string{"u.id", "u.name", "u.email", "u.created_at", "w.id", "w.balance", "w.currency", "w.updated_at"}
+	wantCols := []string{"id", "name", "email", "email_verified_at", "status", "status_reason", "kyc_tier", "created_at"}
 	query := fmt.Sprintf(
 		`
 		SELECT %s
-	 	FROM users u
-		LEFT JOIN wallets w ON u.id = w.user_id
-		WHERE u.id = $1`,
+	 	FROM users
+		WHERE id = $1`,
 		strings.Join(wantCols, ", "),
 	)
 	err = s.db.QueryRow(ctx, query, userId).Scan(
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Status,
+		&user.StatusReason,
+		&user.KYCTier,
 		&user.CreatedAt,
-		&user.Wallet.ID,
-		&user.Wallet.Balance,
-		&user.Wallet.Currency,
-		&user.Wallet.UpdatedAt,
 	)
 	if err != nil {
 		if err.Error() == "no rows in result set" {
@@ -46,9 +51,85 @@ func (s *UserStore) GetUserById(ctx context.Context, userId uuid.UUID) (user mod
 		}
 		return user, fmt.Errorf("store: failed to fetch user by ID: %w", err)
 	}
+
+	user.Wallets, err = s.GetWallets(ctx, userId)
+	if err != nil {
+		return user, err
+	}
 	return user, nil
 }
 
+// GetWallets returns the user's wallets, one per currency.
+func (s *UserStore) GetWallets(ctx context.Context, userId uuid.UUID) ([]models.Wallet, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, balance, currency, status, updated_at
+		FROM wallets
+		WHERE user_id = $1
+		ORDER BY currency
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch wallets: %w", err)
+	}
+	defer rows.Close()
+
+	wallets := []models.Wallet{}
+	for rows.Next() {
+		var wallet models.Wallet
+		if err := rows.Scan(&wallet.ID, &wallet.UserID, &wallet.Balance, &wallet.Currency, &wallet.Status, &wallet.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("store: failed to scan wallet row: %w", err)
+		}
+		wallets = append(wallets, wallet)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("store: error iterating over wallets: %w", rows.Err())
+	}
+	return wallets, nil
+}
+
+// CreateWallet opens an empty wallet in currency for the user. The user row
+// is locked so a freeze or closure can't land between the check and the
+// insert.
+func (s *UserStore) CreateWallet(ctx context.Context, userId uuid.UUID, currency string) (wallet models.Wallet, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.Wallet{}, fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, `SELECT status FROM users WHERE id = $1 FOR UPDATE`, userId).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Wallet{}, ErrUserNotFound
+		}
+		return models.Wallet{}, fmt.Errorf("store: failed to lock user: %w", err)
+	}
+	switch status {
+	case "frozen":
+		return models.Wallet{}, ErrAccountFrozen
+	case "closed":
+		return models.Wallet{}, ErrAccountClosed
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO wallets (user_id, currency)
+		VALUES ($1, $2)
+		RETURNING id, user_id, balance, currency, status, updated_at
+	`, userId, currency).Scan(&wallet.ID, &wallet.UserID, &wallet.Balance, &wallet.Currency, &wallet.Status, &wallet.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return models.Wallet{}, ErrWalletExists
+		}
+		return models.Wallet{}, fmt.Errorf("store: failed to create wallet: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Wallet{}, fmt.Errorf("store: failed to commit wallet: %w", err)
+	}
+	return wallet, nil
+}
+
 func (s *UserStore) GetAllUsers(ctx context.Context) (users []models.User, err error) {
 	wantCols := []string{"id", "name", "email", "created_at"}
 	query := fmt.Sprintf(
@@ -83,17 +164,298 @@ func (s *UserStore) GetAllUsers(ctx context.Context) (users []models.User, err e
 	return usersContainer, nil
 }
 
+// CreateUser inserts the user and screens their name against the sanctions
+// watchlist; a user matching it is created frozen pending compliance review.
 func (s *UserStore) CreateUser(ctx context.Context, newUser *models.CreateUser) (createdUser models.User, err error) {
-	row := s.db.QueryRow(ctx, `
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return models.User{}, fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	row := tx.QueryRow(ctx, `
 		INSERT INTO users (name, email, password_hash)
 		VALUES ($1, $2, $3)
-		RETURNING id, email, name, created_at;
+		RETURNING id, email, name, status, created_at;
 		`, newUser.Name, newUser.Email, newUser.Password)
 
-	err = row.Scan(&createdUser.ID, &createdUser.Email, &createdUser.Name, &createdUser.CreatedAt)
+	err = row.Scan(&createdUser.ID, &createdUser.Email, &createdUser.Name, &createdUser.Status, &createdUser.CreatedAt)
 	if err != nil {
 		return models.User{}, fmt.Errorf("store: failed to insert user %v ", err)
 	}
 
+	frozen, err := s.screener.HoldNewUser(ctx, tx, createdUser.ID, createdUser.Name)
+	if err != nil {
+		return models.User{}, fmt.Errorf("store: failed to screen user: %w", err)
+	}
+	if frozen {
+		reason := screening.ReasonPending
+		createdUser.Status, createdUser.StatusReason = "frozen", &reason
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.User{}, fmt.Errorf("store: failed to commit user: %w", err)
+	}
 	return createdUser, nil
 }
+
+func (s *UserStore) SetKYCTier(ctx context.Context, userId uuid.UUID, tier string) error {
+	tag, err := s.db.Exec(ctx, `UPDATE users SET kyc_tier = $2 WHERE id = $1`, userId, tier)
+	if err != nil {
+		return fmt.Errorf("store: failed to set kyc tier: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) GetLimitOverrides(ctx context.Context, userId uuid.UUID) ([]models.LimitOverride, error) {
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userId).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("store: failed to look up user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT `+limitOverrideColumns+`
+		FROM user_limits
+		WHERE user_id = $1
+		ORDER BY type, currency
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch user limits: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []models.LimitOverride{}
+	for rows.Next() {
+		override, err := scanLimitOverride(rows)
+		if err != nil {
+			return nil, fmt.Errorf("store: failed to scan user limit: %w", err)
+		}
+		overrides = append(overrides, override)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating user limits: %w", err)
+	}
+	return overrides, nil
+}
+
+func (s *UserStore) SetLimitOverride(ctx context.Context, userId uuid.UUID, override models.LimitOverride) (models.LimitOverride, error) {
+	saved, err := scanLimitOverride(s.db.QueryRow(ctx, `
+		INSERT INTO user_limits (user_id, type, currency, per_transaction, daily_volume, monthly_volume,
+			daily_count, monthly_count, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, type, currency) DO UPDATE
+		SET per_transaction = EXCLUDED.per_transaction,
+			daily_volume = EXCLUDED.daily_volume,
+			monthly_volume = EXCLUDED.monthly_volume,
+			daily_count = EXCLUDED.daily_count,
+			monthly_count = EXCLUDED.monthly_count,
+			actor_id = EXCLUDED.actor_id,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING `+limitOverrideColumns,
+		userId, override.Type, override.Currency, override.PerTransaction, override.DailyVolume, override.MonthlyVolume,
+		override.DailyCount, override.MonthlyCount, override.ActorID))
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return models.LimitOverride{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.LimitOverride{}, fmt.Errorf("store: failed to set user limit: %w", err)
+	}
+	return saved, nil
+}
+
+func (s *UserStore) DeleteLimitOverride(ctx context.Context, userId uuid.UUID, txType, currency string) error {
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM user_limits WHERE user_id = $1 AND type = $2 AND currency = $3
+	`, userId, txType, currency)
+	if err != nil {
+		return fmt.Errorf("store: failed to delete user limit: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLimitNotFound
+	}
+	return nil
+}
+
+const limitOverrideColumns = `type, currency, per_transaction, daily_volume, monthly_volume, daily_count, monthly_count,
+	actor_id, updated_at`
+
+func scanLimitOverride(row pgx.Row) (o models.LimitOverride, err error) {
+	err = row.Scan(&o.Type, &o.Currency, &o.PerTransaction, &o.DailyVolume, &o.MonthlyVolume, &o.DailyCount,
+		&o.MonthlyCount, &o.ActorID, &o.UpdatedAt)
+	return o, err
+}
+
+// SetUserStatus changes the status of a user and logs the change in the same
+// transaction. A user can only be closed once all their wallets are empty.
+// Payments share-lock the user row, so none is in flight once it is locked.
+func (s *UserStore) SetUserStatus(ctx context.Context, userId uuid.UUID, change models.StatusChange) error {
+	return s.setStatus(ctx, "user", userId, change,
+		`SELECT status, COALESCE(status_reason, '') FROM users WHERE id = $1 FOR UPDATE`,
+		`SELECT COALESCE(BOOL_AND(balance = 0), TRUE) FROM wallets WHERE user_id = $1`,
+		`UPDATE users SET status = $2, status_reason = $3, block_incoming = $4 WHERE id = $1`,
+	)
+}
+
+func (s *UserStore) SetWalletStatus(ctx context.Context, walletId uuid.UUID, change models.StatusChange) error {
+	return s.setStatus(ctx, "wallet", walletId, change,
+		`SELECT status, COALESCE(status_reason, '') FROM wallets WHERE id = $1 FOR UPDATE`,
+		`SELECT balance = 0 FROM wallets WHERE id = $1`,
+		`UPDATE wallets SET status = $2, status_reason = $3, block_incoming = $4 WHERE id = $1`,
+	)
+}
+
+// setStatus locks the subject with lockQuery, which returns its current
+// status and reason, and applies change with updateQuery. emptyQuery tells
+// whether the subject holds no funds, which closing requires.
+func (s *UserStore) setStatus(ctx context.Context, subjectType string, id uuid.UUID, change models.StatusChange, lockQuery, emptyQuery, updateQuery string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("store: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current, currentReason string
+	if err := tx.QueryRow(ctx, lockQuery, id).Scan(&current, &currentReason); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if subjectType == "wallet" {
+				return ErrWalletNotFound
+			}
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("store: failed to lock %s: %w", subjectType, err)
+	}
+
+	if current == "closed" {
+		return ErrAccountClosed
+	}
+	if err := screeningHold(currentReason, change); err != nil {
+		return err
+	}
+	if change.Status == "closed" {
+		var empty bool
+		if err := tx.QueryRow(ctx, emptyQuery, id).Scan(&empty); err != nil {
+			return fmt.Errorf("store: failed to check %s balance: %w", subjectType, err)
+		}
+		if !empty {
+			return ErrBalanceNotZero
+		}
+	}
+
+	var reason *string
+	if change.Reason != "" {
+		reason = &change.Reason
+	}
+	if _, err := tx.Exec(ctx, updateQuery, id, change.Status, reason, change.BlockIncoming); err != nil {
+		return fmt.Errorf("store: failed to update %s status: %w", subjectType, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO account_status_log (subject_type, subject_id, old_status, new_status, reason, block_incoming, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, subjectType, id, current, change.Status, change.Reason, change.BlockIncoming, change.ActorID)
+	if err != nil {
+		return fmt.Errorf("store: failed to log status change: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("store: failed to commit status change: %w", err)
+	}
+	return nil
+}
+
+// screeningHold refuses to change the status of an account frozen by
+// sanctions screening unless the actor is in compliance. The freeze is
+// otherwise only lifted by resolving the screening hit.
+func screeningHold(currentReason string, change models.StatusChange) error {
+	if (currentReason == screening.ReasonPending || currentReason == screening.ReasonConfirmed) && !change.Compliance {
+		return ErrScreeningHold
+	}
+	return nil
+}
+
+// GetStatusLog lists status changes of a user and their wallets, newest first.
+func (s *UserStore) GetStatusLog(ctx context.Context, userId uuid.UUID, limit int) ([]models.StatusLogEntry, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, subject_type, subject_id, old_status, new_status, reason, block_incoming, actor_id, created_at
+		FROM account_status_log
+		WHERE subject_id = $1 OR subject_id IN (SELECT id FROM wallets WHERE user_id = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch status log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.StatusLogEntry{}
+	for rows.Next() {
+		var entry models.StatusLogEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.SubjectType,
+			&entry.SubjectID,
+			&entry.OldStatus,
+			&entry.NewStatus,
+			&entry.Reason,
+			&entry.BlockIncoming,
+			&entry.ActorID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("store: failed to scan status log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating status log: %w", err)
+	}
+	return entries, nil
+}
+
+// GetBlockedAttempts lists money movements refused because of an account
+// status, newest first. userId nil lists them for everyone.
+func (s *UserStore) GetBlockedAttempts(ctx context.Context, userId *uuid.UUID, limit int) ([]models.BlockedAttempt, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, wallet_id, action, amount, reason, created_at
+		FROM blocked_attempts
+		WHERE $1::uuid IS NULL OR user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to fetch blocked attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []models.BlockedAttempt{}
+	for rows.Next() {
+		var attempt models.BlockedAttempt
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.UserID,
+			&attempt.WalletID,
+			&attempt.Action,
+			&attempt.Amount,
+			&attempt.Reason,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("store: failed to scan blocked attempt: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: error iterating blocked attempts: %w", err)
+	}
+	return attempts, nil
+}
@@ -0,0 +1,42 @@
+package users
+
+import (
+	"errors"
+	"paygo/models"
+	"paygo/screening"
+	"testing"
+)
+
+func TestScreeningHold(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		change models.StatusChange
+		want   error
+	}{
+		{"support unfreezing a pending screening freeze", screening.ReasonPending,
+			models.StatusChange{Status: "active"}, ErrScreeningHold},
+		{"support unfreezing a sanctions match", screening.ReasonConfirmed,
+			models.StatusChange{Status: "active"}, ErrScreeningHold},
+		{"support refreezing over a sanctions match", screening.ReasonConfirmed,
+			models.StatusChange{Status: "frozen", Reason: "fraud"}, ErrScreeningHold},
+		{"support closing a sanctions match", screening.ReasonConfirmed,
+			models.StatusChange{Status: "closed", Reason: "offboarded"}, ErrScreeningHold},
+		{"compliance unfreezing a pending screening freeze", screening.ReasonPending,
+			models.StatusChange{Status: "active", Compliance: true}, nil},
+		{"compliance closing a sanctions match", screening.ReasonConfirmed,
+			models.StatusChange{Status: "closed", Reason: "offboarded", Compliance: true}, nil},
+		{"support unfreezing another freeze", "chargeback dispute",
+			models.StatusChange{Status: "active"}, nil},
+		{"support freezing an active account", "",
+			models.StatusChange{Status: "frozen", Reason: "fraud"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := screeningHold(tt.reason, tt.change); !errors.Is(err, tt.want) {
+				t.Errorf("screeningHold(%q, %+v) = %v, want %v", tt.reason, tt.change, err, tt.want)
+			}
+		})
+	}
+}